@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type EventKind string
+
+const (
+	EventDeploy       EventKind = "deploy"
+	EventConfigChange EventKind = "config"
+	EventIncident     EventKind = "incident"
+)
+
+var ErrUnknownEventKind = errors.New("event kind must be one of deploy, config and incident")
+var ErrMissingEventTime = errors.New("event time is required")
+var ErrInvalidAttributionWindow = errors.New("attribution window must be positive")
+
+// An Event is something that happened to a service and may have burned its error budget
+type Event struct {
+	Time        time.Time
+	Kind        EventKind
+	Name        string // e.g. the version deployed or the incident id
+	Description string
+}
+
+// The budget burned in the window after an event
+type Attribution struct {
+	Event        Event
+	From, To     time.Time // the (From, To] interval attributed to the event
+	Good, Total  float64
+	BudgetBurned float64 // fraction of the error budget of the SLO window ending at To
+	ShareOfBad   float64 // fraction of all bad events in the series
+	Alerts       []AlertTransition
+}
+
+type AttributionReport struct {
+	Attributions []Attribution // ranked by budget burned, highest first
+	TotalBad     float64
+	Unattributed float64 // bad events outside of every event's window
+}
+
+// Attributes the budget burned by the series to the events. Each event gets the window after it,
+// cut short by the next event so that no bad event is attributed twice. Events at the same time share
+// their window, each getting an equal part of its events. Alerts that started firing inside an event's
+// window (e.g. from Backtest) are listed with the event.
+func Attribute(series Series, events []Event, slo float64, window time.Duration, transitions []AlertTransition) (*AttributionReport, error) {
+	if slo < MinSLO || slo > MaxSLO {
+		return nil, ErrSLOOutOfRange
+	}
+	if window <= 0 {
+		return nil, ErrInvalidAttributionWindow
+	}
+	events = append([]Event(nil), events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+
+	report := &AttributionReport{}
+	for _, s := range series {
+		report.TotalBad += s.Total - s.Good
+	}
+	attributedBad := 0.0
+	for i := 0; i < len(events); {
+		simultaneous := 1
+		for i+simultaneous < len(events) && events[i+simultaneous].Time.Equal(events[i].Time) {
+			simultaneous++
+		}
+		from, to := events[i].Time, events[i].Time.Add(window)
+		if next := i + simultaneous; next < len(events) && events[next].Time.Before(to) {
+			to = events[next].Time
+		}
+		good, total := series.Window(from, to)
+		share := 1 / float64(simultaneous)
+		a := Attribution{From: from, To: to, Good: good * share, Total: total * share}
+		bad := a.Total - a.Good
+		attributedBad += bad * float64(simultaneous)
+		if report.TotalBad > 0 {
+			a.ShareOfBad = bad / report.TotalBad
+		}
+		if _, periodTotal := series.Window(to.Add(-SLOWindowSize), to); periodTotal > 0 && slo < MaxSLO {
+			a.BudgetBurned = bad / ((1 - slo) * periodTotal)
+		}
+		for _, t := range transitions {
+			if t.Firing && t.StartsAt.After(from) && !t.StartsAt.After(to) {
+				a.Alerts = append(a.Alerts, t)
+			}
+		}
+		for _, event := range events[i : i+simultaneous] {
+			a.Event = event
+			report.Attributions = append(report.Attributions, a)
+		}
+		i += simultaneous
+	}
+	report.Unattributed = report.TotalBad - attributedBad
+	sort.SliceStable(report.Attributions, func(i, j int) bool {
+		return report.Attributions[i].BudgetBurned > report.Attributions[j].BudgetBurned
+	})
+	return report, nil
+}
+
+// Writes the ranked attributions as a table, with the alerts each event set off
+func WriteAttributionReport(w io.Writer, report *AttributionReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "rank\ttime\tkind\tname\tbudget burned\tshare of bad\talerts fired")
+	for i, a := range report.Attributions {
+		fired := []string{"-"}
+		if len(a.Alerts) > 0 {
+			fired = fired[:0]
+		}
+		for _, t := range a.Alerts {
+			fired = append(fired, fmt.Sprintf("%s/%gx at %s", t.Alert.AlertWindowSize, t.Alert.BurnRate, t.StartsAt.Format(time.RFC3339)))
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%.2f%%\t%.1f%%\t%s\n", i+1, a.Event.Time.Format(time.RFC3339), a.Event.Kind, a.Event.Name,
+			a.BudgetBurned*100, a.ShareOfBad*100, strings.Join(fired, ", "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	unattributed := 0.0
+	if report.TotalBad > 0 {
+		unattributed = report.Unattributed / report.TotalBad
+	}
+	_, err := fmt.Fprintf(w, "unattributed: %.1f%% of %g bad events\n", unattributed*100, report.TotalBad)
+	return err
+}
+
+type eventDto struct {
+	Time        string `json:"time"`
+	Kind        string `json:"kind"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Loads events from a JSON list, e.g. [{"time": "2023-01-01T10:00:00Z", "kind": "deploy", "name": "v1.4.2"}].
+// Times are either RFC3339 or unix seconds, like in series files.
+func LoadEvents(path string) ([]Event, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var dtos []eventDto
+	if err := json.Unmarshal(data, &dtos); err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(dtos))
+	for i, dto := range dtos {
+		if dto.Time == "" {
+			return nil, fmt.Errorf("%s: [%d].time: %w", path, i, ErrMissingEventTime)
+		}
+		t, err := parseTimestamp(dto.Time)
+		if err != nil {
+			return nil, fmt.Errorf("%s: [%d].time: %w", path, i, err)
+		}
+		kind := EventKind(dto.Kind)
+		if kind != EventDeploy && kind != EventConfigChange && kind != EventIncident {
+			return nil, fmt.Errorf("%s: [%d].kind: %w", path, i, ErrUnknownEventKind)
+		}
+		events = append(events, Event{Time: t, Kind: kind, Name: dto.Name, Description: dto.Description})
+	}
+	return events, nil
+}
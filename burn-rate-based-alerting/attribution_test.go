@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func outageEvents() []Event {
+	return []Event{
+		{Time: seriesStart.Add(160 * time.Minute), Kind: EventConfigChange, Name: "raise-timeouts"},
+		{Time: seriesStart.Add(30 * time.Minute), Kind: EventDeploy, Name: "v1.0.0"},
+		{Time: seriesStart.Add(120 * time.Minute), Kind: EventDeploy, Name: "v1.1.0"},
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.99, time.Hour, 2.0)
+	series := outageSeries()
+	transitions, _ := Backtest("checkout", []*SLOAlert{alert}, series, time.Minute)
+	report, err := Attribute(series, outageEvents(), 0.99, time.Hour, transitions)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if len(report.Attributions) != 3 {
+		t.Fatalf("Expected 3 attributions but got %d", len(report.Attributions))
+	}
+	tests := []struct {
+		name         string
+		to           time.Duration
+		bad          float64
+		budgetBurned float64
+		alerts       int
+	}{
+		// cut short by the config change, budget of the 160 minutes of events so far: 200 / (0.01 * 16000)
+		{"v1.1.0", 160 * time.Minute, 200, 1.25, 1},
+		{"raise-timeouts", 220 * time.Minute, 100, 100.0 / 220, 0},
+		{"v1.0.0", 90 * time.Minute, 0, 0, 0},
+	}
+	for i, test := range tests {
+		a := report.Attributions[i]
+		if a.Event.Name != test.name {
+			t.Fatalf("Expected %s at rank %d but got %s", test.name, i+1, a.Event.Name)
+		}
+		if !a.To.Equal(seriesStart.Add(test.to)) {
+			t.Errorf("Expected the window of %s to end at %v but got %v", test.name, seriesStart.Add(test.to), a.To)
+		}
+		if bad := a.Total - a.Good; bad != test.bad {
+			t.Errorf("Expected %v bad events after %s but got %v", test.bad, test.name, bad)
+		}
+		if math.Abs(a.BudgetBurned-test.budgetBurned) > 1e-9 {
+			t.Errorf("Expected %s to burn %v of the budget but got %v", test.name, test.budgetBurned, a.BudgetBurned)
+		}
+		if len(a.Alerts) != test.alerts {
+			t.Errorf("Expected %d alerts after %s but got %+v", test.alerts, test.name, a.Alerts)
+		}
+	}
+	if report.TotalBad != 300 || report.Unattributed != 0 {
+		t.Errorf("Expected all 300 bad events to be attributed but got %+v", report)
+	}
+	if share := report.Attributions[0].ShareOfBad; math.Abs(share-2.0/3) > 1e-9 {
+		t.Errorf("Expected the deploy to account for 2/3 of the bad events but got %v", share)
+	}
+}
+
+func TestAttributeSimultaneousEvents(t *testing.T) {
+	events := append(outageEvents(), Event{Time: seriesStart.Add(120 * time.Minute), Kind: EventConfigChange, Name: "new-pool"})
+	report, err := Attribute(outageSeries(), events, 0.99, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(report.Attributions) != 4 {
+		t.Fatalf("Expected 4 attributions but got %d", len(report.Attributions))
+	}
+	// the deploy and the config change share the 200 bad events until the next config change
+	for i, name := range []string{"v1.1.0", "new-pool"} {
+		a := report.Attributions[i]
+		if a.Event.Name != name {
+			t.Fatalf("Expected %s at rank %d but got %s", name, i+1, a.Event.Name)
+		}
+		if !a.From.Equal(seriesStart.Add(120*time.Minute)) || !a.To.Equal(seriesStart.Add(160*time.Minute)) {
+			t.Errorf("Expected %s to get the window from 120m to 160m but got %v to %v", name, a.From, a.To)
+		}
+		if bad := a.Total - a.Good; bad != 100 {
+			t.Errorf("Expected half of the 200 bad events after %s but got %v", name, bad)
+		}
+		if math.Abs(a.BudgetBurned-0.625) > 1e-9 {
+			t.Errorf("Expected %s to burn 0.625 of the budget but got %v", name, a.BudgetBurned)
+		}
+	}
+	if report.TotalBad != 300 || report.Unattributed != 0 {
+		t.Errorf("Expected all 300 bad events to be attributed once but got %+v", report)
+	}
+}
+
+func TestAttributeUnattributed(t *testing.T) {
+	report, err := Attribute(outageSeries(), outageEvents(), 0.99, 10*time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if report.Unattributed != 200 {
+		t.Errorf("Expected 200 bad events outside of the 10m windows but got %v", report.Unattributed)
+	}
+
+	report, _ = Attribute(outageSeries(), nil, 0.99, time.Hour, nil)
+	if len(report.Attributions) != 0 || report.Unattributed != 300 {
+		t.Errorf("Expected everything to be unattributed without events but got %+v", report)
+	}
+}
+
+func TestAttributeErrors(t *testing.T) {
+	if _, err := Attribute(outageSeries(), outageEvents(), 1.5, time.Hour, nil); err != ErrSLOOutOfRange {
+		t.Errorf("Expected ErrSLOOutOfRange but got %v", err)
+	}
+	if _, err := Attribute(outageSeries(), outageEvents(), 0.99, 0, nil); err != ErrInvalidAttributionWindow {
+		t.Errorf("Expected ErrInvalidAttributionWindow but got %v", err)
+	}
+}
+
+func TestWriteAttributionReport(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.99, time.Hour, 2.0)
+	transitions, _ := Backtest("checkout", []*SLOAlert{alert}, outageSeries(), time.Minute)
+	report, _ := Attribute(outageSeries(), outageEvents(), 0.99, time.Hour, transitions)
+	var buf bytes.Buffer
+	if err := WriteAttributionReport(&buf, report); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected a header, 3 events and a summary but got:\n%s", buf.String())
+	}
+	if !strings.HasPrefix(lines[1], "1 ") || !strings.Contains(lines[1], "v1.1.0") || !strings.Contains(lines[1], "125.00%") || !strings.Contains(lines[1], "1h0m0s/2x") {
+		t.Errorf("Unexpected first rank: %s", lines[1])
+	}
+	if lines[4] != "unattributed: 0.0% of 300 bad events" {
+		t.Errorf("Unexpected summary: %s", lines[4])
+	}
+}
+
+func TestLoadEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	os.WriteFile(path, []byte(`[{"time": "2023-01-01T02:00:00Z", "kind": "deploy", "name": "v1.1.0"}, {"time": "1672545600", "kind": "incident", "name": "INC-42"}]`), 0o644)
+	events, err := LoadEvents(path)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(events) != 2 || !events[0].Time.Equal(seriesStart.Add(2*time.Hour)) || events[1].Kind != EventIncident || !events[1].Time.Equal(seriesStart.Add(4*time.Hour)) {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+
+	tests := []struct {
+		json string
+		err  error
+	}{
+		{`[{"kind": "deploy"}]`, ErrMissingEventTime},
+		{`[{"time": "2023-01-01T02:00:00Z", "kind": "release"}]`, ErrUnknownEventKind},
+	}
+	for _, test := range tests {
+		os.WriteFile(path, []byte(test.json), 0o644)
+		if _, err := LoadEvents(path); !errors.Is(err, test.err) {
+			t.Errorf("Expected %v for %s but got %v", test.err, test.json, err)
+		}
+	}
+}
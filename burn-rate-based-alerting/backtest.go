@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrBacktestStepTooSmall = errors.New("backtest step must be positive")
+
+// An AlertTransition records an SLOAlert of a service starting or stopping to fire
+type AlertTransition struct {
+	Service  string
+	Alert    *SLOAlert
+	Firing   bool
+	StartsAt time.Time // when the alert started firing
+	EndsAt   time.Time // when the alert resolved, zero while it is firing
+	Seen     time.Time // when the alert was evaluated, later than At() for alerts reported as still firing
+}
+
+// The time at which the transition happened
+func (t AlertTransition) At() time.Time {
+	if t.Firing {
+		return t.StartsAt
+	}
+	return t.EndsAt
+}
+
+// An AlertTracker remembers which of a service's alerts are firing, so that evaluating them repeatedly
+// (live, or while replaying a series) only reports the changes
+type AlertTracker struct {
+	service string
+	alerts  []*SLOAlert
+	firing  map[*SLOAlert]time.Time // alert -> time it started firing
+}
+
+func NewAlertTracker(service string, alerts ...*SLOAlert) *AlertTracker {
+	return &AlertTracker{service: service, alerts: alerts, firing: make(map[*SLOAlert]time.Time)}
+}
+
+// Evaluates all alerts at the given time and returns the ones that started or stopped firing since the last evaluation
+func (t *AlertTracker) Evaluate(c EventCounter, at time.Time) []AlertTransition {
+	var transitions []AlertTransition
+	for _, alert := range t.alerts {
+		startsAt, wasFiring := t.firing[alert]
+		firing := alert.Firing(c, at)
+		if firing && !wasFiring {
+			t.firing[alert] = at
+			transitions = append(transitions, AlertTransition{Service: t.service, Alert: alert, Firing: true, StartsAt: at, Seen: at})
+		} else if !firing && wasFiring {
+			delete(t.firing, alert)
+			transitions = append(transitions, AlertTransition{Service: t.service, Alert: alert, Firing: false, StartsAt: startsAt, EndsAt: at, Seen: at})
+		}
+	}
+	return transitions
+}
+
+// The alerts that are currently firing, as seen at the given time
+func (t *AlertTracker) Active(at time.Time) []AlertTransition {
+	var active []AlertTransition
+	for _, alert := range t.alerts {
+		if startsAt, ok := t.firing[alert]; ok {
+			active = append(active, AlertTransition{Service: t.service, Alert: alert, Firing: true, StartsAt: startsAt, Seen: at})
+		}
+	}
+	return active
+}
+
+// Replays the series, evaluating the alerts every step, and returns all transitions in order
+func Backtest(service string, alerts []*SLOAlert, series Series, step time.Duration) ([]AlertTransition, error) {
+	if step <= 0 {
+		return nil, ErrBacktestStepTooSmall
+	}
+	if len(series) == 0 {
+		return nil, nil
+	}
+	tracker := NewAlertTracker(service, alerts...)
+	var transitions []AlertTransition
+	for at := series[0].Time; !at.After(series.End()); at = at.Add(step) {
+		transitions = append(transitions, tracker.Evaluate(series, at)...)
+	}
+	return transitions, nil
+}
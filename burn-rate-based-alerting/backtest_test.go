@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 2 hours without errors, 1 hour of 5% errors, 2 hours without errors
+func outageSeries() Series {
+	series := constantSeries(300, 100, 0)
+	for i := 120; i < 180; i++ {
+		series[i].Good = 95
+	}
+	return series
+}
+
+func TestAlertTracker(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.99, 1*time.Hour, 2.0)
+	series := outageSeries()
+	tracker := NewAlertTracker("checkout", alert)
+
+	if transitions := tracker.Evaluate(series, seriesStart.Add(2*time.Hour)); len(transitions) != 0 {
+		t.Errorf("Expected no transitions before the outage but got %+v", transitions)
+	}
+	transitions := tracker.Evaluate(series, seriesStart.Add(150*time.Minute))
+	if len(transitions) != 1 || !transitions[0].Firing || transitions[0].Service != "checkout" {
+		t.Fatalf("Expected the alert to start firing but got %+v", transitions)
+	}
+	if transitions := tracker.Evaluate(series, seriesStart.Add(160*time.Minute)); len(transitions) != 0 {
+		t.Errorf("Expected no transitions while still firing but got %+v", transitions)
+	}
+	if active := tracker.Active(seriesStart.Add(160 * time.Minute)); len(active) != 1 || !active[0].StartsAt.Equal(seriesStart.Add(150*time.Minute)) || !active[0].Seen.Equal(seriesStart.Add(160*time.Minute)) {
+		t.Errorf("Expected one active alert but got %+v", active)
+	}
+	transitions = tracker.Evaluate(series, seriesStart.Add(4*time.Hour))
+	if len(transitions) != 1 || transitions[0].Firing || !transitions[0].EndsAt.Equal(seriesStart.Add(4*time.Hour)) {
+		t.Errorf("Expected the alert to resolve but got %+v", transitions)
+	}
+	if active := tracker.Active(seriesStart.Add(4 * time.Hour)); len(active) != 0 {
+		t.Errorf("Expected no active alerts but got %+v", active)
+	}
+}
+
+func TestBacktest(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.99, 1*time.Hour, 2.0)
+	if _, err := Backtest("checkout", []*SLOAlert{alert}, outageSeries(), 0); err != ErrBacktestStepTooSmall {
+		t.Errorf("Expected ErrBacktestStepTooSmall but got %v", err)
+	}
+
+	transitions, err := Backtest("checkout", []*SLOAlert{alert}, outageSeries(), time.Minute)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(transitions) != 2 {
+		t.Fatalf("Expected the alert to fire and resolve once but got %+v", transitions)
+	}
+	// more than 2% errors in the alert window (2x the 1% budget) takes more than 24 minutes of 5% errors
+	if expected := seriesStart.Add(2*time.Hour + 25*time.Minute); !transitions[0].StartsAt.Equal(expected) {
+		t.Errorf("Expected the alert to fire at %s but it fired at %s", expected, transitions[0].StartsAt)
+	}
+	if expected := seriesStart.Add(3*time.Hour + 36*time.Minute); !transitions[1].EndsAt.Equal(expected) {
+		t.Errorf("Expected the alert to resolve at %s but it resolved at %s", expected, transitions[1].EndsAt)
+	}
+}
+
+func TestBacktestCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "series.csv")
+	var csvBuf bytes.Buffer
+	WriteSeriesCSV(&csvBuf, outageSeries())
+	os.WriteFile(path, csvBuf.Bytes(), 0644)
+
+	var buf bytes.Buffer
+	err := runCommand(&buf, "backtest", []string{"-series", path, "-service", "checkout", "-slo", "0.99", "-window", "1h", "-burn-rate", "2"})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || lines[0] != "2023-01-01T02:25:00Z checkout window=1h0m0s burnRate=2 firing" || !strings.HasSuffix(lines[1], "resolved") {
+		t.Errorf("Unexpected command output:\n%s", buf.String())
+	}
+}
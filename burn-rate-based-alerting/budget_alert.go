@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const MinBudgetThreshold = 0.0 // exclusive
+const MaxBudgetThreshold = 1.0
+
+var ErrBudgetThresholdOutOfRange = fmt.Errorf("budget threshold must be above %f and at most %f", MinBudgetThreshold, MaxBudgetThreshold)
+
+// The budget consumption thresholds that policy usually asks to be notified about
+var DefaultBudgetThresholds = []float64{0.5, 0.75, 0.9}
+
+// A BudgetAlert fires once a given fraction of the error budget has been consumed within the SLO window.
+// Unlike an SLOAlert it doesn't care how fast the budget was burned, only how much of it is left.
+type BudgetAlert struct {
+	SLO       float64
+	Threshold float64 // fraction of the error budget consumed
+}
+
+// A budget scenario models how long it takes a BudgetAlert to fire when a certain error rate starts being observed
+type BudgetScenario struct {
+	Alert     *BudgetAlert
+	ErrorRate float64
+}
+
+func NewBudgetAlert(slo float64, threshold float64) (*BudgetAlert, error) {
+	if slo < MinSLO || slo > MaxSLO {
+		return nil, ErrSLOOutOfRange
+	}
+	if threshold <= MinBudgetThreshold || threshold > MaxBudgetThreshold {
+		return nil, ErrBudgetThresholdOutOfRange
+	}
+	return &BudgetAlert{SLO: slo, Threshold: threshold}, nil
+}
+
+// Creates one BudgetAlert per threshold, e.g. NewBudgetAlerts(0.999, DefaultBudgetThresholds...)
+func NewBudgetAlerts(slo float64, thresholds ...float64) ([]*BudgetAlert, error) {
+	alerts := make([]*BudgetAlert, 0, len(thresholds))
+	for _, threshold := range thresholds {
+		alert, err := NewBudgetAlert(slo, threshold)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+// Whether the budget consumed over the SLO window ending at `at` has reached the threshold
+func (a *BudgetAlert) Firing(c EventCounter, at time.Time) bool {
+	return budgetConsumed(c, a.SLO, at) >= a.Threshold
+}
+
+func NewBudgetScenario(alert *BudgetAlert, errorRate float64) (*BudgetScenario, error) {
+	if errorRate < MinErrorRate || errorRate > MaxErrorRate {
+		return nil, ErrErrorRateOutOfRange
+	}
+	return &BudgetScenario{
+		Alert:     alert,
+		ErrorRate: errorRate,
+	}, nil
+}
+
+// Whether the threshold is reached within the SLO window (assuming no errors before the scenario started)
+func (s *BudgetScenario) Check() bool {
+	errorBudgetPercentage := 1.0 - s.Alert.SLO
+	return s.ErrorRate > 0 && s.ErrorRate >= s.Alert.Threshold*errorBudgetPercentage
+}
+
+func (s *BudgetScenario) DetectionTime() time.Duration {
+	if !s.Check() { // equivalent to duration > SLOWindowSize
+		return -1
+	}
+	duration := s.Alert.Threshold * (1.0 - s.Alert.SLO) / s.ErrorRate * float64(SLOWindowSize)
+	return time.Duration(duration)
+}
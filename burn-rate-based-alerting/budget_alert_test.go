@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreatingBudgetAlert(t *testing.T) {
+	tests := []struct {
+		slo           float64
+		threshold     float64
+		expectedError error
+	}{
+		{0.99, 0.5, nil},
+		{0.99, 1.0, nil},
+		{1.1, 0.5, ErrSLOOutOfRange},
+		{0.99, 0.0, ErrBudgetThresholdOutOfRange},
+		{0.99, 1.5, ErrBudgetThresholdOutOfRange},
+	}
+	for _, test := range tests {
+		_, err := NewBudgetAlert(test.slo, test.threshold)
+		if err != test.expectedError {
+			t.Errorf("NewBudgetAlert(%f, %f) returned error: %v", test.slo, test.threshold, err)
+		}
+	}
+
+	alerts, err := NewBudgetAlerts(0.999, DefaultBudgetThresholds...)
+	if err != nil || len(alerts) != 3 || alerts[2].Threshold != 0.9 {
+		t.Errorf("NewBudgetAlerts returned %v, %v", alerts, err)
+	}
+}
+
+func TestBudgetScenario(t *testing.T) {
+	alert, _ := NewBudgetAlert(0.99, 0.5)
+	tests := []struct {
+		errorRate             float64
+		expectedCheck         bool
+		expectedDetectionTime time.Duration
+	}{
+		{0.0, false, -1},
+		{0.004, false, -1},
+		{0.02, true, SLOWindowSize / 4},
+		{0.01, true, SLOWindowSize / 2},
+		{1.0, true, 3*time.Hour + 21*time.Minute + 36*time.Second},
+	}
+	for _, test := range tests {
+		scenario, err := NewBudgetScenario(alert, test.errorRate)
+		if err != nil {
+			t.Fatalf("NewBudgetScenario(%f) returned error: %v", test.errorRate, err)
+		}
+		if scenario.Check() != test.expectedCheck {
+			t.Errorf("BudgetScenario.Check() for error rate %f should have been %t", test.errorRate, test.expectedCheck)
+		}
+		if detectionTime := scenario.DetectionTime(); (detectionTime - test.expectedDetectionTime).Abs() > time.Millisecond {
+			t.Errorf("BudgetScenario.DetectionTime() for error rate %f was %s, expected %s", test.errorRate, detectionTime, test.expectedDetectionTime)
+		}
+	}
+	if _, err := NewBudgetScenario(alert, 1.1); err != ErrErrorRateOutOfRange {
+		t.Errorf("Expected ErrErrorRateOutOfRange but got %v", err)
+	}
+}
+
+func TestBudgetAlertEvaluation(t *testing.T) {
+	alerts, _ := NewBudgetAlerts(0.99, DefaultBudgetThresholds...)
+	// 1000 events in total, so an error budget of 10 bad events
+	series := constantSeries(1000, 1, 0.0)
+	for i := 0; i < 6; i++ {
+		series[i*100].Good = 0
+	}
+	e := newTestEvaluator(t, series)
+
+	expectedFiring := []bool{true, false, false} // 60% of the budget consumed
+	for i, alert := range alerts {
+		if alert.Firing(series, series.End()) != expectedFiring[i] || alert.Firing(e, series.End()) != expectedFiring[i] {
+			t.Errorf("Budget alert for threshold %f should have firing=%t", alert.Threshold, expectedFiring[i])
+		}
+	}
+}
+
+func TestBudgetCommand(t *testing.T) {
+	var buf bytes.Buffer
+	if err := runCommand(&buf, "budget", []string{"-slo", "0.99", "-threshold", "0.5,1", "-error-rate", "0.006"}); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "50% of the error budget consumed after: 560h0m0s") || !strings.Contains(output, "100% of the error budget is not consumed") {
+		t.Errorf("Unexpected command output:\n%s", output)
+	}
+}
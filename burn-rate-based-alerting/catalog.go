@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrMissingName = errors.New("name is required")
+var ErrMissingTarget = errors.New("target is required")
+var ErrDuplicateName = errors.New("name is already used")
+var ErrUnknownSLI = errors.New("sli is not defined for the service")
+var ErrImpossibleTarget = errors.New("target must leave some error budget, i.e. be below 1")
+var ErrInvalidPeriod = errors.New("period must be positive")
+var ErrNoAlertTiers = errors.New("at least one alert tier is needed")
+var ErrAmbiguousAlertTier = errors.New("exactly one of burnRate and budgetConsumed must be set")
+var ErrDetectionTooSlow = errors.New("the fastest alert tier is slower than the max detection time")
+var ErrNeverFires = errors.New("none of the alert tiers fires, even during a total outage")
+
+// A Catalog describes the SLIs, SLOs and alert tiers of a fleet of services
+type Catalog struct {
+	MaxDetectionTime time.Duration // for a total outage, 0 when not enforced
+	Services         []CatalogService
+}
+
+type CatalogService struct {
+	Name   string
+	Period time.Duration // length of the SLO window
+	SLIs   []SLI
+	SLOs   []CatalogSLO
+}
+
+// An SLI is defined by queries for its good and total events
+type SLI struct {
+	Name        string
+	Description string
+	GoodQuery   string
+	TotalQuery  string
+}
+
+type CatalogSLO struct {
+	Name   string
+	SLI    string
+	Target float64
+	Tiers  []AlertTier
+}
+
+type AlertTier struct {
+	Name     string
+	Severity string
+	Alert    *SLOAlert
+}
+
+// A ValidationError points at the place in the catalog file that is invalid, e.g. services[2].slos[0].target
+type ValidationError struct {
+	File string
+	Path string
+	Err  error
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.File, e.Path, e.Err)
+}
+
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// All the problems found in a catalog
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+type catalogDto struct {
+	MaxDetectionTime string              `json:"maxDetectionTime" yaml:"maxDetectionTime"`
+	Services         []catalogServiceDto `json:"services" yaml:"services"`
+}
+
+type catalogServiceDto struct {
+	Name   string          `json:"name" yaml:"name"`
+	Period string          `json:"period" yaml:"period"`
+	SLIs   []sliDto        `json:"slis" yaml:"slis"`
+	SLOs   []catalogSLODto `json:"slos" yaml:"slos"`
+}
+
+type sliDto struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	Good        string `json:"good" yaml:"good"`
+	Total       string `json:"total" yaml:"total"`
+}
+
+type catalogSLODto struct {
+	Name   string         `json:"name" yaml:"name"`
+	SLI    string         `json:"sli" yaml:"sli"`
+	Target *float64       `json:"target" yaml:"target"`
+	Alerts []alertTierDto `json:"alerts" yaml:"alerts"`
+}
+
+type alertTierDto struct {
+	Name           string   `json:"name" yaml:"name"`
+	Severity       string   `json:"severity" yaml:"severity"`
+	Window         string   `json:"window" yaml:"window"`
+	BurnRate       *float64 `json:"burnRate" yaml:"burnRate"`
+	BudgetConsumed *float64 `json:"budgetConsumed" yaml:"budgetConsumed"`
+}
+
+// Reads and validates a catalog file: YAML if its extension is .yaml or .yml, JSON otherwise
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCatalog(path, data)
+}
+
+// Parses and validates a catalog, as YAML if the file's extension is .yaml or .yml and as JSON otherwise.
+// Validation doesn't stop at the first problem: the returned error is a ValidationErrors with everything that is wrong in the file.
+func ParseCatalog(file string, data []byte) (*Catalog, error) {
+	var dto catalogDto
+	var err error
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&dto)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&dto)
+	}
+	if err != nil {
+		return nil, ValidationErrors{{File: file, Path: "$", Err: err}}
+	}
+
+	v := catalogValidator{file: file}
+	catalog := &Catalog{}
+	if dto.MaxDetectionTime != "" {
+		catalog.MaxDetectionTime = v.duration("maxDetectionTime", dto.MaxDetectionTime)
+	}
+	serviceNames := make(map[string]bool)
+	for i, s := range dto.Services {
+		path := fmt.Sprintf("services[%d]", i)
+		v.uniqueName(path, s.Name, serviceNames)
+		catalog.Services = append(catalog.Services, v.service(path, s, catalog.MaxDetectionTime))
+	}
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+	return catalog, nil
+}
+
+type catalogValidator struct {
+	file string
+	errs ValidationErrors
+}
+
+func (v *catalogValidator) fail(path string, err error) {
+	v.errs = append(v.errs, ValidationError{File: v.file, Path: path, Err: err})
+}
+
+func (v *catalogValidator) uniqueName(path, name string, seen map[string]bool) {
+	if name == "" {
+		v.fail(path+".name", ErrMissingName)
+		return
+	}
+	if seen[name] {
+		v.fail(path+".name", fmt.Errorf("%w: %q", ErrDuplicateName, name))
+	}
+	seen[name] = true
+}
+
+func (v *catalogValidator) duration(path, s string) time.Duration {
+	d, err := parseCatalogDuration(s)
+	if err != nil {
+		v.fail(path, err)
+	}
+	return d
+}
+
+func (v *catalogValidator) service(path string, dto catalogServiceDto, maxDetectionTime time.Duration) CatalogService {
+	service := CatalogService{Name: dto.Name, Period: SLOWindowSize}
+	if dto.Period != "" {
+		period, err := parseCatalogDuration(dto.Period)
+		if err != nil {
+			v.fail(path+".period", err)
+		} else if period <= 0 {
+			v.fail(path+".period", ErrInvalidPeriod)
+		}
+		service.Period = period
+	}
+
+	sliNames := make(map[string]bool)
+	for i, s := range dto.SLIs {
+		v.uniqueName(fmt.Sprintf("%s.slis[%d]", path, i), s.Name, sliNames)
+		service.SLIs = append(service.SLIs, SLI{Name: s.Name, Description: s.Description, GoodQuery: s.Good, TotalQuery: s.Total})
+	}
+
+	sloNames := make(map[string]bool)
+	for i, s := range dto.SLOs {
+		sloPath := fmt.Sprintf("%s.slos[%d]", path, i)
+		v.uniqueName(sloPath, s.Name, sloNames)
+		if !sliNames[s.SLI] {
+			v.fail(sloPath+".sli", fmt.Errorf("%w: %q", ErrUnknownSLI, s.SLI))
+		}
+		slo := CatalogSLO{Name: s.Name, SLI: s.SLI}
+		targetValid := true
+		if s.Target == nil {
+			v.fail(sloPath+".target", ErrMissingTarget)
+			targetValid = false
+		} else if slo.Target = *s.Target; slo.Target < MinSLO || slo.Target > MaxSLO {
+			v.fail(sloPath+".target", ErrSLOOutOfRange)
+			targetValid = false
+		} else if slo.Target == MaxSLO {
+			v.fail(sloPath+".target", ErrImpossibleTarget)
+			targetValid = false
+		}
+		if len(s.Alerts) == 0 {
+			v.fail(sloPath+".alerts", ErrNoAlertTiers)
+		}
+		tierNames := make(map[string]bool)
+		for j, t := range s.Alerts {
+			tierPath := fmt.Sprintf("%s.alerts[%d]", sloPath, j)
+			v.uniqueName(tierPath, t.Name, tierNames)
+			if tier, ok := v.alertTier(tierPath, t, slo.Target, targetValid, service.Period); ok {
+				slo.Tiers = append(slo.Tiers, tier)
+			}
+		}
+		if len(slo.Tiers) > 0 && len(slo.Tiers) == len(s.Alerts) {
+			if fastest := slo.FastestDetectionTime(); fastest < 0 {
+				v.fail(sloPath+".alerts", ErrNeverFires)
+			} else if maxDetectionTime > 0 && fastest > maxDetectionTime {
+				v.fail(sloPath+".alerts", fmt.Errorf("%w: %s > %s", ErrDetectionTooSlow, fastest, maxDetectionTime))
+			}
+		}
+		service.SLOs = append(service.SLOs, slo)
+	}
+	return service
+}
+
+func (v *catalogValidator) alertTier(path string, dto alertTierDto, target float64, targetValid bool, period time.Duration) (AlertTier, bool) {
+	valid := targetValid
+	window, err := parseCatalogDuration(dto.Window)
+	if err != nil {
+		v.fail(path+".window", err)
+		valid = false
+	} else if window < MinAlertTimeWindow || window > MaxAlertTimeWindow {
+		v.fail(path+".window", ErrAlertTimeWindowOutOfRange)
+		valid = false
+	}
+	if (dto.BurnRate == nil) == (dto.BudgetConsumed == nil) {
+		v.fail(path, ErrAmbiguousAlertTier)
+		return AlertTier{}, false
+	}
+
+	var burnRate float64
+	if dto.BurnRate != nil {
+		burnRate = *dto.BurnRate
+		if burnRate < MinBurnRate || burnRate > MaxBurnRate {
+			v.fail(path+".burnRate", ErrBurnRateOutOfRange)
+			valid = false
+		}
+	} else if *dto.BudgetConsumed < MinErrorBudgetUsed || *dto.BudgetConsumed > MaxErrorBudgetUsed {
+		v.fail(path+".budgetConsumed", ErrErrorBudgetUsedOutOfRange)
+		valid = false
+	} else if window > 0 && period > 0 {
+		// budget consumed is relative to the service's own period rather than SLOWindowSize
+		burnRate = *dto.BudgetConsumed * float64(period) / float64(window)
+		if burnRate < MinBurnRate || burnRate > MaxBurnRate {
+			v.fail(path+".budgetConsumed", ErrBurnRateOutOfRange)
+			valid = false
+		}
+	} else {
+		valid = false // the window or period is already reported
+	}
+	if period <= 0 {
+		valid = false // already reported
+	}
+	if !valid {
+		return AlertTier{}, false
+	}
+	alert, err := NewSLOAlertForPeriod(target, window, burnRate, period)
+	if err != nil {
+		v.fail(path, err)
+		return AlertTier{}, false
+	}
+	return AlertTier{Name: dto.Name, Severity: dto.Severity, Alert: alert}, true
+}
+
+// How long the fastest of the SLO's alert tiers takes to detect a total outage, or -1 if none of them fires
+func (s CatalogSLO) FastestDetectionTime() time.Duration {
+	fastest := time.Duration(-1)
+	for _, tier := range s.Tiers {
+		scenario, _ := NewScenario(tier.Alert, MaxErrorRate)
+		if d := scenario.DetectionTime(); d >= 0 && (fastest < 0 || d < fastest) {
+			fastest = d
+		}
+	}
+	return fastest
+}
+
+// Like time.ParseDuration, but also accepts whole days, e.g. "28d"
+func parseCatalogDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const validCatalog = `{
+  "maxDetectionTime": "15m",
+  "services": [
+    {
+      "name": "checkout",
+      "period": "30d",
+      "slis": [
+        {"name": "availability", "good": "http_requests_total{code!~\"5..\"}", "total": "http_requests_total"}
+      ],
+      "slos": [
+        {
+          "name": "availability-999",
+          "sli": "availability",
+          "target": 0.999,
+          "alerts": [
+            {"name": "fast", "severity": "page", "window": "1h", "burnRate": 14.4},
+            {"name": "slow", "severity": "ticket", "window": "6h", "budgetConsumed": 0.05}
+          ]
+        }
+      ]
+    }
+  ]
+}`
+
+func TestParsingValidCatalog(t *testing.T) {
+	catalog, err := ParseCatalog("catalog.json", []byte(validCatalog))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if catalog.MaxDetectionTime != 15*time.Minute || len(catalog.Services) != 1 {
+		t.Fatalf("Unexpected catalog: %+v", catalog)
+	}
+	service := catalog.Services[0]
+	if service.Period != 30*24*time.Hour || len(service.SLIs) != 1 || service.SLIs[0].TotalQuery != "http_requests_total" {
+		t.Errorf("Unexpected service: %+v", service)
+	}
+	tiers := service.SLOs[0].Tiers
+	if len(tiers) != 2 || tiers[0].Severity != "page" || tiers[0].Alert.BurnRate != 14.4 {
+		t.Fatalf("Unexpected tiers: %+v", tiers)
+	}
+	// 5% of a 30 day budget in 6h
+	if tiers[1].Alert.BurnRate != 6 || tiers[1].Alert.AlertWindowSize != 6*time.Hour {
+		t.Errorf("Expected the budget tier to have a burn rate of 6 but got %+v", tiers[1].Alert)
+	}
+	// the share of the budget is relative to the service's period too
+	if consumed := tiers[0].Alert.PercentErrorBudgetConsumed; math.Abs(consumed-0.02) > 1e-9 {
+		t.Errorf("Expected the fast tier to consume 2%% of the 30 day budget but got %g", consumed)
+	}
+	if consumed := tiers[1].Alert.PercentErrorBudgetConsumed; math.Abs(consumed-0.05) > 1e-9 {
+		t.Errorf("Expected the slow tier to consume 5%% of the 30 day budget but got %g", consumed)
+	}
+	if fastest := service.SLOs[0].FastestDetectionTime(); fastest != 51*time.Second+840*time.Millisecond {
+		t.Errorf("Unexpected fastest detection time %s", fastest)
+	}
+}
+
+func TestParsingYAMLCatalog(t *testing.T) {
+	yamlCatalog := `
+maxDetectionTime: 15m
+services:
+  - name: checkout
+    period: 30d
+    slis:
+      - name: availability
+        good: http_requests_total{code!~"5.."}
+        total: http_requests_total
+    slos:
+      - name: availability-999
+        sli: availability
+        target: 0.999
+        alerts:
+          - {name: fast, severity: page, window: 1h, burnRate: 14.4}
+          - {name: slow, severity: ticket, window: 6h, budgetConsumed: 0.05}
+`
+	fromYAML, err := ParseCatalog("catalog.yaml", []byte(yamlCatalog))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	fromJSON, _ := ParseCatalog("catalog.json", []byte(validCatalog))
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Errorf("Expected the YAML catalog to match the JSON one but got %+v", fromYAML)
+	}
+
+	if _, err := ParseCatalog("catalog.yml", []byte("services:\n  - name: checkout\n    owner: payments\n")); err == nil {
+		t.Errorf("Expected unknown fields to be rejected")
+	}
+}
+
+func TestCatalogValidationReportsEveryError(t *testing.T) {
+	catalog := `{
+  "maxDetectionTime": "1m",
+  "services": [
+    {
+      "name": "checkout",
+      "slis": [{"name": "availability"}, {"name": "availability"}],
+      "slos": [
+        {
+          "name": "a",
+          "sli": "latency",
+          "target": 1.0,
+          "alerts": [{"name": "fast", "window": "1m", "burnRate": 200}]
+        },
+        {
+          "name": "a",
+          "sli": "availability",
+          "target": 0.999,
+          "alerts": [
+            {"name": "slow", "window": "6h", "burnRate": 6},
+            {"name": "slow", "window": "1h", "burnRate": 2, "budgetConsumed": 0.1}
+          ]
+        },
+        {
+          "name": "b",
+          "sli": "availability",
+          "target": 0.999,
+          "alerts": [{"name": "slow", "window": "6h", "budgetConsumed": 0.05}]
+        },
+        {"name": "c", "sli": "availability", "target": 0.999},
+        {
+          "name": "d",
+          "sli": "availability",
+          "target": 0.9,
+          "alerts": [{"name": "fast", "window": "1h", "burnRate": 20}]
+        },
+        {"name": "e", "sli": "availability", "alerts": [{"name": "fast", "window": "1h", "burnRate": 14.4}]}
+      ]
+    },
+    {"name": "checkout", "period": "soon"}
+  ]
+}`
+	_, err := ParseCatalog("fleet/catalog.json", []byte(catalog))
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ValidationErrors but got %v", err)
+	}
+	expected := []struct {
+		path string
+		err  error
+	}{
+		{"services[0].slis[1].name", ErrDuplicateName},
+		{"services[0].slos[0].sli", ErrUnknownSLI},
+		{"services[0].slos[0].target", ErrImpossibleTarget},
+		{"services[0].slos[0].alerts[0].window", ErrAlertTimeWindowOutOfRange},
+		{"services[0].slos[0].alerts[0].burnRate", ErrBurnRateOutOfRange},
+		{"services[0].slos[1].name", ErrDuplicateName},
+		{"services[0].slos[1].alerts[1].name", ErrDuplicateName},
+		{"services[0].slos[1].alerts[1]", ErrAmbiguousAlertTier},
+		{"services[0].slos[2].alerts", ErrDetectionTooSlow},
+		{"services[0].slos[3].alerts", ErrNoAlertTiers},
+		{"services[0].slos[4].alerts", ErrNeverFires},
+		{"services[0].slos[5].target", ErrMissingTarget},
+		{"services[1].name", ErrDuplicateName},
+		{"services[1].period", nil},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors but got %d:\n%v", len(expected), len(errs), errs)
+	}
+	for i, e := range expected {
+		if errs[i].File != "fleet/catalog.json" || errs[i].Path != e.path || (e.err != nil && !errors.Is(errs[i], e.err)) {
+			t.Errorf("Expected error %d to be %v at %s but got %v", i, e.err, e.path, errs[i])
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "fleet/catalog.json: services[0].slis[1].name: name is already used") {
+		t.Errorf("Unexpected error message: %s", err)
+	}
+}
+
+func TestCatalogRejectsMalformedJSON(t *testing.T) {
+	for _, input := range []string{`{"services": [}`, `{"unknown": true}`} {
+		if _, err := ParseCatalog("catalog.json", []byte(input)); err == nil {
+			t.Errorf("Expected error parsing %s", input)
+		}
+	}
+}
+
+func TestCatalogCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	os.WriteFile(path, []byte(validCatalog), 0644)
+	var buf bytes.Buffer
+	if err := runCommand(&buf, "catalog", []string{"-file", path}); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "checkout") || !strings.Contains(lines[2], "ticket") {
+		t.Errorf("Unexpected command output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const MinChartWidth = 40
+const DefaultChartWidth = 80
+const chartHeight = 11    // odd, so the middle row gets a label of exactly half the y range
+const chartLabelWidth = 8 // y axis labels, e.g. "  100% |"
+
+// The width of the terminal that stdout is attached to. When stdout isn't a terminal (e.g. it is piped),
+// $COLUMNS is used instead, and DefaultChartWidth if that isn't set either.
+func TerminalWidth() int {
+	return terminalWidth(int(os.Stdout.Fd()))
+}
+
+func terminalWidth(fd int) int {
+	if columns, _, err := term.GetSize(fd); err == nil && columns >= MinChartWidth {
+		return columns
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns >= MinChartWidth {
+		return columns
+	}
+	return DefaultChartWidth
+}
+
+// Renders two ASCII charts for the scenario, each at most width characters wide:
+// the burn rate observed over the alert window against the alert's threshold, with the detection time marked,
+// and the share of the error budget burned over the SLO window.
+// The error rate is assumed to start at time 0, after a period without errors.
+func RenderScenarioChart(w io.Writer, s *Scenario, width int) error {
+	if width < MinChartWidth {
+		width = MinChartWidth
+	}
+	errorBudgetPercentage := 1.0 - s.Alert.SLO
+	window := s.Alert.AlertWindowSize
+
+	burnRateAt := func(x float64) float64 { // x is the fraction of the alert window since the errors started
+		if errorBudgetPercentage == 0 {
+			return 0
+		}
+		return s.ErrorRate * x / errorBudgetPercentage
+	}
+	detection := -1.0
+	if s.Check() {
+		detection = float64(s.DetectionTime()) / float64(window)
+	}
+	maxBurnRate := math.Max(burnRateAt(1), s.Alert.BurnRate) * 1.1
+	summary := "never fires"
+	if detection >= 0 {
+		summary = fmt.Sprintf("fires after %s", s.DetectionTime().Round(time.Second))
+	}
+	title := []string{
+		fmt.Sprintf("Burn rate over the %s alert window", window),
+		fmt.Sprintf("threshold %.2f, %s", s.Alert.BurnRate, summary),
+	}
+	err := plot(w, plotSpec{
+		title:     title,
+		width:     width,
+		yMax:      maxBurnRate,
+		yFormat:   func(y float64) string { return fmt.Sprintf("%.1f", y) },
+		xEnd:      window,
+		f:         burnRateAt,
+		threshold: s.Alert.BurnRate,
+		marker:    detection,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+
+	budgetAt := func(x float64) float64 { // x is the fraction of the SLO window since the errors started
+		if errorBudgetPercentage == 0 {
+			if s.ErrorRate > 0 {
+				return 1
+			}
+			return 0
+		}
+		return math.Min(s.ErrorRate*x/errorBudgetPercentage, 1)
+	}
+	exhausted := -1.0
+	if s.ErrorRate > 0 && s.ErrorRate >= errorBudgetPercentage {
+		exhausted = errorBudgetPercentage / s.ErrorRate
+	}
+	title = []string{fmt.Sprintf("Error budget burned over the %s SLO window", SLOWindowSize)}
+	if exhausted >= 0 {
+		title = append(title, fmt.Sprintf("exhausted after %s", time.Duration(exhausted*float64(SLOWindowSize)).Round(time.Second)))
+	}
+	return plot(w, plotSpec{
+		title:     title,
+		width:     width,
+		yMax:      1,
+		yFormat:   func(y float64) string { return fmt.Sprintf("%.0f%%", y*100) },
+		xEnd:      SLOWindowSize,
+		f:         budgetAt,
+		threshold: -1,
+		marker:    exhausted,
+	})
+}
+
+type plotSpec struct {
+	title     []string
+	width     int
+	yMax      float64
+	yFormat   func(y float64) string
+	xEnd      time.Duration
+	f         func(x float64) float64 // x goes from 0 to 1
+	threshold float64                 // drawn as a horizontal line, unless negative
+	marker    float64                 // x drawn as a vertical line, unless negative
+}
+
+func plot(w io.Writer, spec plotSpec) error {
+	cols := spec.width - chartLabelWidth
+	grid := make([][]byte, chartHeight)
+	for row := range grid {
+		grid[row] = []byte(strings.Repeat(" ", cols))
+	}
+	rowOf := func(y float64) int {
+		row := chartHeight - 1 - int(math.Round(y/spec.yMax*float64(chartHeight-1)))
+		if row < 0 {
+			return 0
+		}
+		return row
+	}
+
+	if spec.threshold >= 0 {
+		row := rowOf(spec.threshold)
+		for col := 0; col < cols; col++ {
+			grid[row][col] = '-'
+		}
+	}
+	if spec.marker >= 0 {
+		col := int(math.Round(spec.marker * float64(cols-1)))
+		for row := 0; row < chartHeight; row++ {
+			grid[row][col] = '|'
+		}
+	}
+	for col := 0; col < cols; col++ {
+		x := float64(col) / float64(cols-1)
+		grid[rowOf(spec.f(x))][col] = '*'
+	}
+
+	for _, line := range spec.title {
+		if _, err := fmt.Fprintln(w, truncate(line, spec.width)); err != nil {
+			return err
+		}
+	}
+	for row, line := range grid {
+		label := ""
+		if row == 0 || row == chartHeight-1 || row == chartHeight/2 {
+			label = spec.yFormat(spec.yMax * float64(chartHeight-1-row) / float64(chartHeight-1))
+		}
+		if _, err := fmt.Fprintf(w, "%*s |%s\n", chartLabelWidth-2, label, strings.TrimRight(string(line), " ")); err != nil {
+			return err
+		}
+	}
+	axis := strings.Repeat(" ", chartLabelWidth-1) + "+" + strings.Repeat("-", cols)
+	start := "0s"
+	end := spec.xEnd.String()
+	ticks := strings.Repeat(" ", chartLabelWidth) + start + strings.Repeat(" ", max(cols-len(start)-len(end), 1)) + end
+	_, err := fmt.Fprintf(w, "%s\n%s\n", axis, ticks)
+	return err
+}
+
+func truncate(s string, width int) string {
+	if len(s) > width {
+		return s[:width]
+	}
+	return s
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderingScenarioChart(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.99, 1*time.Hour, 2.0)
+
+	t.Run("fits the requested width and marks the detection time", func(t *testing.T) {
+		scenario, _ := NewScenario(alert, 0.05)
+		for _, width := range []int{MinChartWidth, 100} {
+			var buf bytes.Buffer
+			if err := RenderScenarioChart(&buf, scenario, width); err != nil {
+				t.Fatalf("Got unexpected error: %v", err)
+			}
+			output := buf.String()
+			for _, line := range strings.Split(output, "\n") {
+				if len(line) > width {
+					t.Errorf("Line longer than %d characters: %q", width, line)
+				}
+			}
+			if !strings.Contains(output, "fires after 24m0s") || !strings.Contains(output, "exhausted after 134h24m0s") {
+				t.Errorf("Chart titles missing detection and exhaustion times:\n%s", output)
+			}
+			if strings.Count(output, "|") < 2*chartHeight+chartHeight {
+				t.Errorf("Chart is missing the detection marker:\n%s", output)
+			}
+			if !strings.Contains(output, "---") {
+				t.Errorf("Chart is missing the threshold line:\n%s", output)
+			}
+		}
+	})
+
+	t.Run("narrow widths are widened to the minimum", func(t *testing.T) {
+		scenario, _ := NewScenario(alert, 0.05)
+		var buf bytes.Buffer
+		RenderScenarioChart(&buf, scenario, 10)
+		axis := strings.Split(buf.String(), "\n")[chartHeight+2]
+		if len(axis) != MinChartWidth {
+			t.Errorf("Expected axis of width %d but got %q", MinChartWidth, axis)
+		}
+	})
+
+	t.Run("scenarios that don't fire say so", func(t *testing.T) {
+		scenario, _ := NewScenario(alert, 0.001)
+		var buf bytes.Buffer
+		RenderScenarioChart(&buf, scenario, 60)
+		if !strings.Contains(buf.String(), "never fires") || strings.Contains(buf.String(), "exhausted") {
+			t.Errorf("Unexpected chart:\n%s", buf.String())
+		}
+	})
+}
+
+func TestChartCommand(t *testing.T) {
+	var buf bytes.Buffer
+	if err := runCommand(&buf, "chart", []string{"-slo", "0.99", "-burn-rate", "2", "-error-rate", "1", "-width", "60"}); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "fires after 1m12s") {
+		t.Errorf("Unexpected command output:\n%s", buf.String())
+	}
+}
+
+func TestTerminalWidthFallsBackWhenNotATerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	for _, c := range []struct {
+		columns  string
+		expected int
+	}{
+		{"120", 120},
+		{"10", DefaultChartWidth},
+		{"wide", DefaultChartWidth},
+		{"", DefaultChartWidth},
+	} {
+		t.Setenv("COLUMNS", c.columns)
+		if got := terminalWidth(int(f.Fd())); got != c.expected {
+			t.Errorf("Expected width %d for COLUMNS=%q but got %d", c.expected, c.columns, got)
+		}
+	}
+}
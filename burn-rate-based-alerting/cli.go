@@ -0,0 +1,641 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+type command func(w io.Writer, args []string) error
+
+var commands = map[string]command{
+	"attribute": runAttributeCommand,
+	"backtest":  runBacktestCommand,
+	"budget":    runBudgetCommand,
+	"catalog":   runCatalogCommand,
+	"chart":     runChartCommand,
+	"journey":   runJourneyCommand,
+	"probe":     runProbeCommand,
+	"promtool":  runPromtoolCommand,
+	"sweep":     runSweepCommand,
+	"tenants":   runTenantsCommand,
+}
+
+func runCommand(w io.Writer, name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		var names []string
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command %q, expected one of %v", name, names)
+	}
+	return cmd(w, args)
+}
+
+// Creates the file at path, or returns w when path is empty
+func outputFor(w io.Writer, path string) (io.Writer, func() error, error) {
+	if path == "" {
+		return w, func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+func runSweepCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	fs.SetOutput(w)
+	slos := fs.String("slo", "0.99,0.999,0.9995", "SLOs to sweep, as a list (a,b,c) or range (min:max:step)")
+	windows := fs.String("window", "10m:1h:10m", "Alert window sizes to sweep, as a list or range")
+	burnRates := fs.String("burn-rate", "1,2,5,10,14.4", "Burn rates to sweep, as a list or range")
+	errorRates := fs.String("error-rate", "0.01,0.05,0.1,0.5,1", "Error rates to sweep, as a list or range")
+	format := fs.String("format", "csv", "Output format: csv or json")
+	out := fs.String("out", "", "File to write results to (defaults to stdout)")
+	svg := fs.String("svg", "", "Optional file to render detection time heatmaps to")
+	workers := fs.Int("workers", 0, "Number of parallel workers (defaults to the number of CPUs)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("Positional arguments specified")
+	}
+
+	config := SweepConfig{Workers: *workers}
+	var err error
+	if config.SLOs, err = ParseFloatRange(*slos); err != nil {
+		return err
+	}
+	if config.AlertWindowSizes, err = ParseDurationRange(*windows); err != nil {
+		return err
+	}
+	if config.BurnRates, err = ParseFloatRange(*burnRates); err != nil {
+		return err
+	}
+	if config.ErrorRates, err = ParseFloatRange(*errorRates); err != nil {
+		return err
+	}
+	results, err := RunSweep(config)
+	if err != nil {
+		return err
+	}
+
+	output, closeOutput, err := outputFor(w, *out)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "csv":
+		err = WriteSweepCSV(output, results)
+	case "json":
+		err = WriteSweepJSON(output, results)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if *svg == "" {
+		return nil
+	}
+	f, err := os.Create(*svg)
+	if err != nil {
+		return err
+	}
+	if err := WriteSweepHeatmapSVG(f, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readSeriesFile(path string) (Series, error) {
+	if path == "" {
+		return nil, errors.New("a series file is required")
+	}
+	return loadSeries(path)
+}
+
+// Builds one alert per (window, burn rate) pair, e.g. "1h,6h" and "14.4,6"
+func parseAlerts(slo float64, windows, burnRates string) ([]*SLOAlert, error) {
+	windowSizes, err := ParseDurationRange(windows)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := ParseFloatRange(burnRates)
+	if err != nil {
+		return nil, err
+	}
+	if len(windowSizes) != len(rates) {
+		return nil, errors.New("the number of alert windows and burn rates must match")
+	}
+	alerts := make([]*SLOAlert, len(windowSizes))
+	for i := range windowSizes {
+		if alerts[i], err = NewSLOAlertFromBurnRate(slo, windowSizes[i], rates[i]); err != nil {
+			return nil, err
+		}
+	}
+	return alerts, nil
+}
+
+func runTenantsCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("tenants", flag.ContinueOnError)
+	fs.SetOutput(w)
+	seriesPath := fs.String("series", "", "CSV file with timestamp,good,total and label columns")
+	by := fs.String("by", "tenant", "Comma separated label names to split the series by")
+	maxLabelSets := fs.Int("max-label-sets", 10, "Number of label sets tracked individually, the rest are rolled up into \""+OtherLabelSet+"\"")
+	slo := fs.Float64("slo", 0.999, "SLO target")
+	windows := fs.String("window", "1h,6h", "Alert window sizes")
+	burnRates := fs.String("burn-rate", "14.4,6", "Burn rate for each alert window")
+	top := fs.Int("top", 0, "Only show the top n rows (all rows when 0)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("Positional arguments specified")
+	}
+
+	alerts, err := parseAlerts(*slo, *windows, *burnRates)
+	if err != nil {
+		return err
+	}
+	series, err := readSeriesFile(*seriesPath)
+	if err != nil {
+		return err
+	}
+	tenants, err := SplitSeriesByLabels(series, strings.Split(*by, ","), *maxLabelSets)
+	if err != nil {
+		return err
+	}
+	burns := EvaluateTenants(alerts, tenants, series.End())
+	if *top > 0 && len(burns) > *top {
+		burns = burns[:*top]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LABEL SET\tWINDOW\tBURN RATE\tTHRESHOLD\tFIRING\tBUDGET CONSUMED")
+	for _, b := range burns {
+		fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%t\t%.2f%%\n", b.LabelSet, b.Alert.AlertWindowSize, b.BurnRate, b.Alert.BurnRate, b.Firing, b.BudgetConsumed*100)
+	}
+	return tw.Flush()
+}
+
+func runBudgetCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("budget", flag.ContinueOnError)
+	fs.SetOutput(w)
+	slo := fs.Float64("slo", 0.999, "SLO target")
+	thresholds := fs.String("threshold", "0.5,0.75,0.9", "Fractions of the error budget consumed to alert on")
+	errorRate := fs.Float64("error-rate", 1.0, "Constant error rate to simulate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("Positional arguments specified")
+	}
+
+	values, err := ParseFloatRange(*thresholds)
+	if err != nil {
+		return err
+	}
+	alerts, err := NewBudgetAlerts(*slo, values...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "We start seeing Error Rate: %.2f%%\n", *errorRate*100)
+	for _, alert := range alerts {
+		scenario, err := NewBudgetScenario(alert, *errorRate)
+		if err != nil {
+			return err
+		}
+		if scenario.Check() {
+			fmt.Fprintf(w, "  %.0f%% of the error budget consumed after: %s\n", alert.Threshold*100, scenario.DetectionTime().Round(time.Second))
+		} else {
+			fmt.Fprintf(w, "  %.0f%% of the error budget is not consumed within %s\n", alert.Threshold*100, SLOWindowSize)
+		}
+	}
+	return nil
+}
+
+func runChartCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("chart", flag.ContinueOnError)
+	fs.SetOutput(w)
+	slo := fs.Float64("slo", 0.99, "SLO target")
+	window := fs.Duration("window", time.Hour, "Alert window size")
+	burnRate := fs.Float64("burn-rate", 0, "Burn rate of the alert (alternative to -budget-used)")
+	budgetUsed := fs.Float64("budget-used", 0.02, "Fraction of the error budget used in the alert window to alert on")
+	errorRate := fs.Float64("error-rate", 1.0, "Constant error rate to simulate")
+	width := fs.Int("width", 0, "Chart width in characters (defaults to the terminal width)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("Positional arguments specified")
+	}
+
+	var alert *SLOAlert
+	var err error
+	if *burnRate > 0 {
+		alert, err = NewSLOAlertFromBurnRate(*slo, *window, *burnRate)
+	} else {
+		alert, err = NewSLOAlertFromBudgetUsed(*slo, *window, *budgetUsed)
+	}
+	if err != nil {
+		return err
+	}
+	scenario, err := NewScenario(alert, *errorRate)
+	if err != nil {
+		return err
+	}
+	if *width <= 0 {
+		*width = TerminalWidth()
+	}
+	return RenderScenarioChart(w, scenario, *width)
+}
+
+func runBacktestCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	fs.SetOutput(w)
+	seriesPath := fs.String("series", "", "CSV file with timestamp,good,total columns")
+	service := fs.String("service", "service", "Name of the service the series belongs to")
+	slo := fs.Float64("slo", 0.999, "SLO target")
+	windows := fs.String("window", "1h,6h", "Alert window sizes")
+	burnRates := fs.String("burn-rate", "14.4,6", "Burn rate for each alert window")
+	step := fs.Duration("step", time.Minute, "How often to evaluate the alerts while replaying the series")
+	receivers := fs.String("receiver", "", "Comma separated Alertmanager webhook URLs to send the alerts to")
+	retries := fs.Int("retries", defaultMaxRetries, "Extra delivery attempts for failed notifications")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("Positional arguments specified")
+	}
+
+	alerts, err := parseAlerts(*slo, *windows, *burnRates)
+	if err != nil {
+		return err
+	}
+	series, err := readSeriesFile(*seriesPath)
+	if err != nil {
+		return err
+	}
+	transitions, err := Backtest(*service, alerts, series, *step)
+	if err != nil {
+		return err
+	}
+	writeTransitions(w, transitions)
+
+	if *receivers == "" {
+		return nil
+	}
+	notifier, err := newNotifierFor(*receivers, *retries)
+	if err != nil {
+		return err
+	}
+	for _, t := range transitions {
+		if err := notifier.Notify(context.Background(), []AlertTransition{t}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates a Notifier for the comma separated webhook URLs
+func newNotifierFor(receivers string, retries int) (*Notifier, error) {
+	if retries == 0 {
+		retries = -1 // the zero value stands for the default
+	}
+	config := NotifierConfig{MaxRetries: retries}
+	for i, url := range strings.Split(receivers, ",") {
+		config.Receivers = append(config.Receivers, Receiver{Name: fmt.Sprintf("receiver-%d", i), URL: url})
+	}
+	return NewNotifier(config)
+}
+
+func runPromtoolCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("promtool", flag.ContinueOnError)
+	fs.SetOutput(w)
+	config := DefaultPromtoolConfig("service")
+	fs.StringVar(&config.Service, "service", config.Service, "Service label of the generated series and alerts")
+	fs.StringVar(&config.GoodMetric, "good-metric", config.GoodMetric, "Counter of good events")
+	fs.StringVar(&config.TotalMetric, "total-metric", config.TotalMetric, "Counter of total events")
+	fs.Float64Var(&config.RequestsPerInterval, "requests", config.RequestsPerInterval, "Requests per interval in the generated series")
+	fs.DurationVar(&config.Interval, "interval", config.Interval, "Scrape and rule evaluation interval")
+	slo := fs.Float64("slo", 0.999, "SLO target")
+	windows := fs.String("window", "1h", "Alert window sizes")
+	burnRates := fs.String("burn-rate", "14.4", "Burn rate for each alert window")
+	errorRate := fs.Float64("error-rate", 1.0, "Error rate of the scenario (with a single alert and no -timeline)")
+	timeline := fs.String("timeline", "", "Time-varying errors as duration:errorRate phases, e.g. 1h:0,30m:0.05,1h:0")
+	rulesOut := fs.String("rules-out", "", "File to write the Prometheus alerting rules to (not written when empty)")
+	out := fs.String("out", "", "File to write the promtool test to (defaults to stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("Positional arguments specified")
+	}
+
+	alerts, err := parseAlerts(*slo, *windows, *burnRates)
+	if err != nil {
+		return err
+	}
+	if *rulesOut != "" {
+		config.RuleFile = *rulesOut
+		f, err := os.Create(*rulesOut)
+		if err != nil {
+			return err
+		}
+		if err := WritePromRules(f, alerts, config); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	output, closeOutput, err := outputFor(w, *out)
+	if err != nil {
+		return err
+	}
+	if *timeline != "" {
+		var phases []ErrorPhase
+		if phases, err = ParseTimeline(*timeline); err == nil {
+			err = WritePromtoolTest(output, alerts, phases, config)
+		}
+	} else if len(alerts) != 1 {
+		err = errors.New("scenarios need exactly one alert, use -timeline for several")
+	} else {
+		var scenario *Scenario
+		if scenario, err = NewScenario(alerts[0], *errorRate); err == nil {
+			err = WriteScenarioPromtoolTest(output, scenario, config)
+		}
+	}
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func runCatalogCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("catalog", flag.ContinueOnError)
+	fs.SetOutput(w)
+	path := fs.String("file", "catalog.json", "JSON or YAML (.yaml, .yml) catalog of services, SLIs, SLOs and alert tiers")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("Positional arguments specified")
+	}
+
+	catalog, err := LoadCatalog(*path)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tSLO\tTARGET\tTIER\tSEVERITY\tWINDOW\tBURN RATE\tDETECTION TIME (100% ERRORS)")
+	for _, service := range catalog.Services {
+		for _, slo := range service.SLOs {
+			for _, tier := range slo.Tiers {
+				scenario, _ := NewScenario(tier.Alert, MaxErrorRate)
+				fmt.Fprintf(tw, "%s\t%s\t%g\t%s\t%s\t%s\t%.2f\t%s\n", service.Name, slo.Name, slo.Target, tier.Name, tier.Severity,
+					tier.Alert.AlertWindowSize, tier.Alert.BurnRate, scenario.DetectionTime().Round(time.Second))
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+func runProbeCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("probe", flag.ContinueOnError)
+	fs.SetOutput(w)
+	targetsPath := fs.String("targets", "probes.json", "JSON file with the probe targets")
+	duration := fs.Duration("duration", 0, "How long to probe for (until interrupted when 0)")
+	slo := fs.Float64("slo", 0.999, "SLO target")
+	windows := fs.String("window", "1h,6h", "Alert window sizes")
+	burnRates := fs.String("burn-rate", "14.4,6", "Burn rate for each alert window")
+	resolution := fs.Duration("resolution", time.Minute, "Bucket size of the live evaluators")
+	historyOut := fs.String("history-out", "", "File to write the probe history to as a good/total series when done")
+	snapshotDir := fs.String("snapshot-dir", "", "Directory to restore the evaluators from on start and checkpoint them to while probing")
+	checkpointInterval := fs.Duration("checkpoint-interval", time.Minute, "How often to checkpoint the evaluators to the snapshot directory")
+	gapPolicy := fs.String("gap-policy", "unknown", "How to count the time since the snapshots were taken: unknown, good or bad")
+	receivers := fs.String("receiver", "", "Comma separated Alertmanager webhook URLs to send the alerts to")
+	retries := fs.Int("retries", defaultMaxRetries, "Extra delivery attempts for failed notifications")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("Positional arguments specified")
+	}
+
+	alerts, err := parseAlerts(*slo, *windows, *burnRates)
+	if err != nil {
+		return err
+	}
+	policy, err := ParseGapPolicy(*gapPolicy)
+	if err != nil {
+		return err
+	}
+	targets, err := LoadProbeTargets(*targetsPath)
+	if err != nil {
+		return err
+	}
+	prober, err := NewProber(targets, *resolution)
+	if err != nil {
+		return err
+	}
+	if *snapshotDir != "" {
+		if err := prober.LoadSnapshots(*snapshotDir, time.Now(), policy); err != nil {
+			return err
+		}
+	}
+	trackers := make(map[string]*AlertTracker)
+	for _, target := range targets {
+		trackers[target.Name] = NewAlertTracker(target.Name, alerts...)
+	}
+	var notifier *Notifier
+	if *receivers != "" {
+		if notifier, err = newNotifierFor(*receivers, *retries); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	var mu sync.Mutex // results of different targets and checkpoint errors arrive concurrently
+	var checkpointing sync.WaitGroup
+	if *snapshotDir != "" {
+		checkpointing.Add(1)
+		go func() {
+			defer checkpointing.Done()
+			prober.CheckpointEvery(ctx, *snapshotDir, *checkpointInterval, time.Now, func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				fmt.Fprintf(w, "checkpoint failed: %v\n", err)
+			})
+		}()
+	}
+	prober.Run(ctx, func(r ProbeResult) {
+		mu.Lock()
+		state := "good"
+		if !r.Good {
+			state = "bad: " + r.Reason
+		}
+		fmt.Fprintf(w, "%s %s %s (%s)\n", r.Time.Format(time.RFC3339), r.Target, state, r.Latency.Round(time.Millisecond))
+		tracker := trackers[r.Target]
+		transitions := tracker.Evaluate(prober.Evaluator(r.Target), r.Time)
+		for _, t := range transitions {
+			fmt.Fprintf(w, "%s %s window=%s burnRate=%g firing=%t\n", r.Time.Format(time.RFC3339), t.Service, t.Alert.AlertWindowSize, t.Alert.BurnRate, t.Firing)
+		}
+		transitions = append(transitions, tracker.Active(r.Time)...) // re-sent once the repeat interval has passed
+		mu.Unlock()
+
+		if notifier == nil {
+			return
+		}
+		// delivering (and retrying) doesn't hold up the results of the other targets
+		if err := notifier.Notify(ctx, transitions); err != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(w, "%s %s notification failed: %v\n", r.Time.Format(time.RFC3339), r.Target, err)
+		}
+	})
+	checkpointing.Wait()
+
+	if *historyOut == "" {
+		return nil
+	}
+	f, err := os.Create(*historyOut)
+	if err != nil {
+		return err
+	}
+	if err := prober.WriteHistoryCSV(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runAttributeCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("attribute", flag.ContinueOnError)
+	fs.SetOutput(w)
+	seriesPath := fs.String("series", "", "CSV file with timestamp,good,total columns")
+	eventsPath := fs.String("events", "", "JSON file with the deploys, config changes and incidents")
+	service := fs.String("service", "service", "Name of the service the series belongs to")
+	slo := fs.Float64("slo", 0.999, "SLO target")
+	attributionWindow := fs.Duration("attribution-window", time.Hour, "How long after an event bad events are attributed to it")
+	windows := fs.String("window", "1h,6h", "Alert window sizes")
+	burnRates := fs.String("burn-rate", "14.4,6", "Burn rate for each alert window")
+	step := fs.Duration("step", time.Minute, "How often to evaluate the alerts while replaying the series")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("Positional arguments specified")
+	}
+
+	alerts, err := parseAlerts(*slo, *windows, *burnRates)
+	if err != nil {
+		return err
+	}
+	series, err := readSeriesFile(*seriesPath)
+	if err != nil {
+		return err
+	}
+	events, err := LoadEvents(*eventsPath)
+	if err != nil {
+		return err
+	}
+	transitions, err := Backtest(*service, alerts, series, *step)
+	if err != nil {
+		return err
+	}
+	report, err := Attribute(series, events, *slo, *attributionWindow, transitions)
+	if err != nil {
+		return err
+	}
+	if err := WriteAttributionReport(w, report); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "\nalert history:")
+	writeTransitions(w, transitions)
+	return nil
+}
+
+func writeTransitions(w io.Writer, transitions []AlertTransition) {
+	for _, t := range transitions {
+		state := "firing"
+		if !t.Firing {
+			state = "resolved"
+		}
+		fmt.Fprintf(w, "%s %s window=%s burnRate=%g %s\n", t.At().Format(time.RFC3339), t.Service, t.Alert.AlertWindowSize, t.Alert.BurnRate, state)
+	}
+}
+
+func runJourneyCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("journey", flag.ContinueOnError)
+	fs.SetOutput(w)
+	journeyPath := fs.String("journey", "journey.json", "JSON file describing the journey and its components")
+	mode := fs.String("mode", "", "Overrides the journey's mode: weighted, or all-good, which approximates the journey's success ratio "+
+		"as the product of the components' and so assumes they fail independently")
+	windows := fs.String("window", "1h,6h", "Alert window sizes")
+	burnRates := fs.String("burn-rate", "14.4,6", "Burn rate for each alert window")
+	step := fs.Duration("step", time.Minute, "How often to evaluate the alerts while replaying the series")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("Positional arguments specified")
+	}
+
+	journey, err := LoadJourney(*journeyPath)
+	if err != nil {
+		return err
+	}
+	if *mode != "" {
+		if journey, err = NewJourney(journey.Name, journey.SLO, JourneyMode(*mode), journey.Components); err != nil {
+			return err
+		}
+	}
+	alerts, err := parseAlerts(journey.SLO, *windows, *burnRates)
+	if err != nil {
+		return err
+	}
+	end := journey.Series().End()
+	fmt.Fprintf(w, "%s (%s, SLO %g): %.2f%% of the error budget consumed\n", journey.Name, journey.Mode, journey.SLO, journey.BudgetConsumed(end)*100)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "component\tbudget consumed")
+	for _, b := range journey.ComponentBudgets(end) {
+		fmt.Fprintf(tw, "%s\t%.2f%%\n", b.Component, b.BudgetConsumed*100)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	transitions, err := Backtest(journey.Name, alerts, journey.Series(), *step)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "\nalert history:")
+	writeTransitions(w, transitions)
+	return nil
+}
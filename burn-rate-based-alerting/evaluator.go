@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Version of the snapshot file format written by SaveSnapshot
+const SnapshotVersion = 1
+
+const MinEvaluatorResolution = 1 * time.Second
+const MaxEvaluatorResolution = MinAlertTimeWindow
+
+var ErrEvaluatorResolutionOutOfRange = fmt.Errorf("resolution must be between %v and %v", MinEvaluatorResolution, MaxEvaluatorResolution)
+var ErrUnsupportedSnapshotVersion = fmt.Errorf("only snapshot version %d is supported", SnapshotVersion)
+var ErrUnknownGapPolicy = errors.New("unknown gap policy")
+var ErrSnapshotResolutionMismatch = errors.New("the snapshot was taken with a different resolution")
+
+// How to account for the time between taking a snapshot and restoring it, when no events were recorded
+type GapPolicy int
+
+const (
+	GapUnknown    GapPolicy = iota // the gap counts neither towards good nor total events
+	GapAssumeGood                  // the gap is filled with the average traffic, all of it good
+	GapAssumeBad                   // the gap is filled with the average traffic, all of it bad
+)
+
+func ParseGapPolicy(s string) (GapPolicy, error) {
+	switch s {
+	case "unknown":
+		return GapUnknown, nil
+	case "good":
+		return GapAssumeGood, nil
+	case "bad":
+		return GapAssumeBad, nil
+	}
+	return GapUnknown, ErrUnknownGapPolicy
+}
+
+type bucket struct {
+	good    float64
+	total   float64
+	unknown bool
+}
+
+// A live Evaluator keeps good and total event counts in fixed size time buckets for the length of an SLO window,
+// so SLOAlerts can be evaluated while events are being recorded. It is safe for concurrent use.
+type Evaluator struct {
+	mu         sync.Mutex
+	resolution time.Duration
+	buckets    map[int64]*bucket // keyed by bucket index, i.e. the end of the bucket's interval divided by the resolution
+	latest     int64
+	pruned     int64 // buckets up to this index have been dropped
+}
+
+func NewEvaluator(resolution time.Duration) (*Evaluator, error) {
+	if resolution < MinEvaluatorResolution || resolution > MaxEvaluatorResolution {
+		return nil, ErrEvaluatorResolutionOutOfRange
+	}
+	return &Evaluator{resolution: resolution, buckets: make(map[int64]*bucket)}, nil
+}
+
+func (e *Evaluator) Resolution() time.Duration {
+	return e.resolution
+}
+
+// Records good and total events observed in the interval ending at t.
+// Events older than the SLO window are dropped.
+func (e *Evaluator) Record(t time.Time, good, total float64) error {
+	if good > total {
+		return ErrGoodAboveTotal
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.add(e.bucketIndex(t), good, total)
+	return nil
+}
+
+func (e *Evaluator) RecordSample(s Sample) error {
+	return e.Record(s.Time, s.Good, s.Total)
+}
+
+func (e *Evaluator) add(idx int64, good, total float64) {
+	if idx <= e.latest-e.retainedBuckets() {
+		return
+	}
+	b, ok := e.buckets[idx]
+	if !ok {
+		b = &bucket{}
+		e.buckets[idx] = b
+	}
+	b.good += good
+	b.total += total
+	b.unknown = false
+	if idx > e.latest {
+		e.latest = idx
+		e.prune()
+	}
+}
+
+func (e *Evaluator) markUnknown(idx int64) {
+	if idx <= e.latest-e.retainedBuckets() {
+		return
+	}
+	if _, ok := e.buckets[idx]; !ok {
+		e.buckets[idx] = &bucket{unknown: true}
+	}
+	if idx > e.latest {
+		e.latest = idx
+		e.prune()
+	}
+}
+
+// Drops the buckets that fell out of the SLO window since the last call. Only the indexes in between are visited,
+// unless there are more of them than buckets, so that moving forward one bucket at a time (e.g. filling a gap)
+// doesn't walk the whole window every time.
+func (e *Evaluator) prune() {
+	oldest := e.latest - e.retainedBuckets()
+	if oldest <= e.pruned {
+		return
+	}
+	if oldest-e.pruned > int64(len(e.buckets)) {
+		for idx := range e.buckets {
+			if idx <= oldest {
+				delete(e.buckets, idx)
+			}
+		}
+	} else {
+		for idx := e.pruned + 1; idx <= oldest; idx++ {
+			delete(e.buckets, idx)
+		}
+	}
+	e.pruned = oldest
+}
+
+func (e *Evaluator) retainedBuckets() int64 {
+	return int64(SLOWindowSize / e.resolution)
+}
+
+// Events at exactly a bucket boundary belong to the bucket ending there
+func (e *Evaluator) bucketIndex(t time.Time) int64 {
+	nanos := t.UnixNano()
+	idx := nanos / int64(e.resolution)
+	if nanos%int64(e.resolution) != 0 {
+		idx++
+	}
+	return idx
+}
+
+func (e *Evaluator) bucketEnd(idx int64) time.Time {
+	return time.Unix(0, idx*int64(e.resolution)).UTC()
+}
+
+// Sums up the good and total events of the buckets ending in the (from, to] interval
+func (e *Evaluator) Window(from, to time.Time) (good, total float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.forEachBucket(from, to, func(b *bucket) {
+		good += b.good
+		total += b.total
+	})
+	return good, total
+}
+
+// How much of the (from, to] interval is covered by buckets of unknown state
+func (e *Evaluator) UnknownDuration(from, to time.Time) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var unknown time.Duration
+	e.forEachBucket(from, to, func(b *bucket) {
+		if b.unknown {
+			unknown += e.resolution
+		}
+	})
+	return unknown
+}
+
+func (e *Evaluator) forEachBucket(from, to time.Time, f func(b *bucket)) {
+	first := from.UnixNano()/int64(e.resolution) + 1
+	last := to.UnixNano() / int64(e.resolution)
+	if last-first+1 > int64(len(e.buckets)) {
+		for idx, b := range e.buckets {
+			if idx >= first && idx <= last {
+				f(b)
+			}
+		}
+		return
+	}
+	for idx := first; idx <= last; idx++ {
+		if b, ok := e.buckets[idx]; ok {
+			f(b)
+		}
+	}
+}
+
+func (e *Evaluator) ErrorRate(from, to time.Time) float64 {
+	return errorRate(e, from, to)
+}
+
+func (e *Evaluator) BudgetConsumed(slo float64, at time.Time) float64 {
+	return budgetConsumed(e, slo, at)
+}
+
+// A Snapshot is the serializable state of an Evaluator
+type Snapshot struct {
+	Version    int              `json:"version"`
+	Resolution string           `json:"resolution"`
+	TakenAt    time.Time        `json:"takenAt"`
+	Buckets    []SnapshotBucket `json:"buckets"`
+}
+
+type SnapshotBucket struct {
+	End     time.Time `json:"end"`
+	Good    float64   `json:"good"`
+	Total   float64   `json:"total"`
+	Unknown bool      `json:"unknown,omitempty"`
+}
+
+func (e *Evaluator) Snapshot(now time.Time) Snapshot {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	snapshot := Snapshot{Version: SnapshotVersion, Resolution: e.resolution.String(), TakenAt: now.UTC(), Buckets: make([]SnapshotBucket, 0, len(e.buckets))}
+	for idx, b := range e.buckets {
+		snapshot.Buckets = append(snapshot.Buckets, SnapshotBucket{End: e.bucketEnd(idx), Good: b.good, Total: b.total, Unknown: b.unknown})
+	}
+	sort.Slice(snapshot.Buckets, func(i, j int) bool { return snapshot.Buckets[i].End.Before(snapshot.Buckets[j].End) })
+	return snapshot
+}
+
+// Rebuilds an Evaluator from a snapshot, filling the gap between the time the snapshot was taken and now
+// according to the gap policy
+func RestoreEvaluator(snapshot Snapshot, now time.Time, policy GapPolicy) (*Evaluator, error) {
+	if snapshot.Version != SnapshotVersion {
+		return nil, ErrUnsupportedSnapshotVersion
+	}
+	if policy != GapUnknown && policy != GapAssumeGood && policy != GapAssumeBad {
+		return nil, ErrUnknownGapPolicy
+	}
+	resolution, err := time.ParseDuration(snapshot.Resolution)
+	if err != nil {
+		return nil, err
+	}
+	e, err := NewEvaluator(resolution)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range snapshot.Buckets {
+		idx := e.bucketIndex(b.End)
+		if b.Unknown {
+			e.markUnknown(idx)
+		} else {
+			e.add(idx, b.Good, b.Total)
+		}
+	}
+	e.fillGap(snapshot.TakenAt, now, policy)
+	return e, nil
+}
+
+func (e *Evaluator) fillGap(from, to time.Time, policy GapPolicy) {
+	first := e.bucketIndex(from) + 1
+	last := e.bucketIndex(to)
+	if oldest := last - e.retainedBuckets() + 1; first < oldest {
+		first = oldest
+	}
+	if first > last {
+		return
+	}
+
+	averageTotal := e.averageTotalPerBucket()
+	for idx := first; idx <= last; idx++ {
+		switch policy {
+		case GapUnknown:
+			e.markUnknown(idx)
+		case GapAssumeGood:
+			e.add(idx, averageTotal, averageTotal)
+		case GapAssumeBad:
+			e.add(idx, 0, averageTotal)
+		}
+	}
+}
+
+// The average number of total events per bucket of known state, between the oldest bucket and the latest one
+func (e *Evaluator) averageTotalPerBucket() float64 {
+	var total float64
+	var oldest int64
+	var unknown int64
+	first := true
+	for idx, b := range e.buckets {
+		if b.unknown {
+			unknown++
+			continue
+		}
+		total += b.total
+		if first || idx < oldest {
+			oldest = idx
+			first = false
+		}
+	}
+	if first {
+		return 0
+	}
+	known := e.latest - oldest + 1 - unknown
+	if known < 1 {
+		return 0
+	}
+	return total / float64(known)
+}
+
+// Writes the snapshot as JSON, atomically replacing the file at path
+func SaveSnapshot(path string, snapshot Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func LoadSnapshot(path string) (Snapshot, error) {
+	var snapshot Snapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, err
+	}
+	if snapshot.Version != SnapshotVersion {
+		return snapshot, ErrUnsupportedSnapshotVersion
+	}
+	return snapshot, nil
+}
+
+// Restores the Evaluator from the snapshot at path, or creates a new one if there is no snapshot yet.
+// The snapshot has to have been taken with the same resolution.
+func LoadOrNewEvaluator(path string, resolution time.Duration, now time.Time, policy GapPolicy) (*Evaluator, error) {
+	snapshot, err := LoadSnapshot(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewEvaluator(resolution)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r, err := time.ParseDuration(snapshot.Resolution); err == nil && r != resolution {
+		return nil, fmt.Errorf("%w: %s instead of %s", ErrSnapshotResolutionMismatch, r, resolution)
+	}
+	return RestoreEvaluator(snapshot, now, policy)
+}
+
+// Saves a snapshot taken at now() to path every interval until the context is done, and once more right before returning.
+// Errors are passed to onError (if set) without stopping the checkpointing.
+func (e *Evaluator) CheckpointEvery(ctx context.Context, path string, interval time.Duration, now func() time.Time, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	checkpoint := func() {
+		if err := SaveSnapshot(path, e.Snapshot(now())); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			checkpoint()
+			return
+		case <-ticker.C:
+			checkpoint()
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestEvaluator(t *testing.T, series Series) *Evaluator {
+	e, err := NewEvaluator(time.Minute)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	for _, s := range series {
+		if err := e.RecordSample(s); err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+	}
+	return e
+}
+
+func TestNewEvaluator(t *testing.T) {
+	for _, resolution := range []time.Duration{time.Millisecond, time.Hour} {
+		if _, err := NewEvaluator(resolution); err != ErrEvaluatorResolutionOutOfRange {
+			t.Errorf("NewEvaluator(%s) returned error: %v", resolution, err)
+		}
+	}
+	e, _ := NewEvaluator(time.Minute)
+	if err := e.Record(seriesStart, 2, 1); err != ErrGoodAboveTotal {
+		t.Errorf("Expected ErrGoodAboveTotal but got %v", err)
+	}
+}
+
+func TestEvaluatorMatchesSeries(t *testing.T) {
+	series := append(constantSeries(60, 100, 0.001), constantSeries(120, 100, 0.05)[60:]...)
+	e := newTestEvaluator(t, series)
+	alert, _ := NewSLOAlertFromBurnRate(0.99, 1*time.Hour, 2.0)
+
+	for _, at := range []time.Time{seriesStart.Add(30 * time.Minute), seriesStart.Add(90 * time.Minute), series.End()} {
+		if alert.Firing(e, at) != alert.Firing(series, at) {
+			t.Errorf("Evaluator and series disagree on firing at %s", at)
+		}
+		if math.Abs(alert.ObservedBurnRate(e, at)-alert.ObservedBurnRate(series, at)) > 1e-9 {
+			t.Errorf("Evaluator and series disagree on burn rate at %s", at)
+		}
+		if math.Abs(e.BudgetConsumed(0.99, at)-series.BudgetConsumed(0.99, at)) > 1e-9 {
+			t.Errorf("Evaluator and series disagree on budget consumed at %s", at)
+		}
+	}
+	if !alert.Firing(e, series.End()) {
+		t.Errorf("Alert failed to fire after an hour of 5%% errors")
+	}
+}
+
+func TestEvaluatorDropsEventsOlderThanTheSLOWindow(t *testing.T) {
+	e := newTestEvaluator(t, constantSeries(10, 100, 1.0))
+	e.Record(seriesStart.Add(SLOWindowSize+time.Hour), 100, 100)
+	if good, total := e.Window(seriesStart, seriesStart.Add(SLOWindowSize+time.Hour)); good != 100 || total != 100 {
+		t.Errorf("Expected old buckets to be pruned but got %f good and %f total", good, total)
+	}
+	e.Record(seriesStart.Add(time.Minute), 0, 100)
+	if _, total := e.Window(seriesStart, seriesStart.Add(time.Hour)); total != 0 {
+		t.Errorf("Expected events older than the SLO window to be dropped but got %f total", total)
+	}
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	series := constantSeries(60, 100, 0.01)
+	e := newTestEvaluator(t, series)
+	takenAt := series.End()
+	restartedAt := takenAt.Add(30 * time.Minute)
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := SaveSnapshot(path, e.Snapshot(takenAt)); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		policy        GapPolicy
+		expectedGood  float64
+		expectedTotal float64
+		unknown       time.Duration
+	}{
+		{GapUnknown, 5940, 6000, 30 * time.Minute},
+		{GapAssumeGood, 5940 + 3000, 6000 + 3000, 0},
+		{GapAssumeBad, 5940, 6000 + 3000, 0},
+	}
+	for _, test := range tests {
+		snapshot, err := LoadSnapshot(path)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		restored, err := RestoreEvaluator(snapshot, restartedAt, test.policy)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		good, total := restored.Window(seriesStart, restartedAt)
+		if math.Abs(good-test.expectedGood) > 1e-6 || math.Abs(total-test.expectedTotal) > 1e-6 {
+			t.Errorf("Policy %d: expected %f good and %f total but got %f and %f", test.policy, test.expectedGood, test.expectedTotal, good, total)
+		}
+		if unknown := restored.UnknownDuration(seriesStart, restartedAt); unknown != test.unknown {
+			t.Errorf("Policy %d: expected %s unknown but got %s", test.policy, test.unknown, unknown)
+		}
+	}
+
+	t.Run("rejects a snapshot taken with another resolution", func(t *testing.T) {
+		if _, err := LoadOrNewEvaluator(path, time.Second, restartedAt, GapUnknown); !errors.Is(err, ErrSnapshotResolutionMismatch) {
+			t.Errorf("Expected ErrSnapshotResolutionMismatch but got %v", err)
+		}
+	})
+
+	t.Run("rejects unsupported versions", func(t *testing.T) {
+		os.WriteFile(path, []byte(`{"version": 99}`), 0644)
+		if _, err := LoadSnapshot(path); err != ErrUnsupportedSnapshotVersion {
+			t.Errorf("Expected ErrUnsupportedSnapshotVersion but got %v", err)
+		}
+	})
+
+	t.Run("starts from scratch without a snapshot", func(t *testing.T) {
+		e, err := LoadOrNewEvaluator(filepath.Join(t.TempDir(), "missing.json"), time.Minute, restartedAt, GapUnknown)
+		if err != nil || e == nil {
+			t.Errorf("Expected a new evaluator but got error %v", err)
+		}
+	})
+}
+
+func TestRestoringAfterALongGap(t *testing.T) {
+	t.Run("at a fine resolution", func(t *testing.T) {
+		e, _ := NewEvaluator(time.Second)
+		e.Record(seriesStart, 10, 10)
+		restartedAt := seriesStart.Add(24 * time.Hour)
+		restored, err := RestoreEvaluator(e.Snapshot(seriesStart), restartedAt, GapAssumeBad)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		// the average traffic of the single known bucket fills every second of the day
+		if good, total := restored.Window(seriesStart.Add(-time.Second), restartedAt); good != 10 || total != 10+86400*10 {
+			t.Errorf("Expected 10 good and %d total events but got %v and %v", 10+86400*10, good, total)
+		}
+	})
+
+	t.Run("longer than the SLO window", func(t *testing.T) {
+		e := newTestEvaluator(t, constantSeries(60, 100, 0))
+		restartedAt := seriesStart.Add(SLOWindowSize + 24*time.Hour)
+		restored, err := RestoreEvaluator(e.Snapshot(seriesStart.Add(time.Hour)), restartedAt, GapUnknown)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		if len(restored.buckets) != int(restored.retainedBuckets()) {
+			t.Errorf("Expected only the %d buckets of the SLO window to be kept but got %d", restored.retainedBuckets(), len(restored.buckets))
+		}
+		if unknown := restored.UnknownDuration(restartedAt.Add(-SLOWindowSize), restartedAt); unknown != SLOWindowSize {
+			t.Errorf("Expected the whole SLO window to be unknown but got %s", unknown)
+		}
+	})
+}
+
+func TestCheckpointing(t *testing.T) {
+	e := newTestEvaluator(t, constantSeries(10, 100, 0))
+	path := filepath.Join(t.TempDir(), "state.json")
+	takenAt := seriesStart.Add(10 * time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.CheckpointEvery(ctx, path, 10*time.Millisecond, func() time.Time { return takenAt }, func(err error) { t.Errorf("Checkpoint failed: %v", err) })
+		close(done)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	<-done
+
+	snapshot, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(snapshot.Buckets) != 10 || snapshot.Resolution != "1m0s" || !snapshot.TakenAt.Equal(takenAt) {
+		t.Errorf("Unexpected snapshot: %+v", snapshot)
+	}
+}
@@ -1,3 +1,10 @@
 module github.com/VladMinzatu/go-projects/burn-rate-based-alerting
 
 go 1.19
+
+require (
+	golang.org/x/term v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.10.0 // indirect
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type JourneyMode string
+
+const (
+	// The journey's success ratio is the weighted average of the components' success ratios
+	JourneyWeighted JourneyMode = "weighted"
+	// A journey event is only good when it is good for every component. Components are assumed to fail
+	// independently, so the journey's success ratio is the product of theirs. This is an approximation: when the
+	// same events fail in several components the journey's bad events are overcounted, and when different events
+	// fail they are undercounted.
+	JourneyAllGood JourneyMode = "all-good"
+)
+
+var ErrUnknownJourneyMode = errors.New("journey mode must be weighted or all-good")
+var ErrNoJourneyComponents = errors.New("a journey needs at least one component")
+var ErrInvalidJourneyWeight = errors.New("weights must not be negative and at least one must be positive")
+
+// A JourneyComponent is one of the SLIs a user journey depends on, e.g. an endpoint's availability or latency
+type JourneyComponent struct {
+	Name   string
+	Weight float64 // only used by JourneyWeighted
+	Series Series
+}
+
+// A Journey combines the SLIs of its components into a single SLI with its own SLO and error budget.
+// Its combined series can be used wherever a Series can, e.g. for evaluating SLOAlerts or backtesting.
+type Journey struct {
+	Name       string
+	SLO        float64
+	Mode       JourneyMode
+	Components []JourneyComponent
+	series     Series
+	// per component: the journey's total events, and as good events those not made bad by the component
+	shares map[string]Series
+}
+
+// The share of the journey's error budget consumed because of one component
+type ComponentBudget struct {
+	Component      string
+	BudgetConsumed float64
+}
+
+func NewJourney(name string, slo float64, mode JourneyMode, components []JourneyComponent) (*Journey, error) {
+	if slo < MinSLO || slo > MaxSLO {
+		return nil, ErrSLOOutOfRange
+	}
+	if mode != JourneyWeighted && mode != JourneyAllGood {
+		return nil, ErrUnknownJourneyMode
+	}
+	if len(components) == 0 {
+		return nil, ErrNoJourneyComponents
+	}
+	names := make(map[string]bool)
+	totalWeight := 0.0
+	for _, c := range components {
+		if c.Name == "" {
+			return nil, ErrMissingName
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateName, c.Name)
+		}
+		names[c.Name] = true
+		if c.Weight < 0 {
+			return nil, ErrInvalidJourneyWeight
+		}
+		totalWeight += c.Weight
+	}
+	if mode == JourneyWeighted && totalWeight == 0 {
+		return nil, ErrInvalidJourneyWeight
+	}
+	j := &Journey{Name: name, SLO: slo, Mode: mode, Components: components, shares: make(map[string]Series)}
+	j.combine()
+	return j, nil
+}
+
+// Combines the component samples with the same timestamp into journey samples.
+// Components without events at a timestamp don't affect the journey sample.
+func (j *Journey) combine() {
+	byTime := make(map[time.Time][]Sample)
+	var times []time.Time
+	for _, c := range j.Components {
+		for _, s := range c.Series {
+			t := s.Time.UTC()
+			if byTime[t] == nil {
+				byTime[t] = make([]Sample, len(j.Components))
+				times = append(times, t)
+			}
+		}
+	}
+	for i, c := range j.Components {
+		for _, s := range c.Series {
+			sample := &byTime[s.Time.UTC()][i]
+			sample.Good += s.Good
+			sample.Total += s.Total
+		}
+	}
+	sort.Slice(times, func(a, b int) bool { return times[a].Before(times[b]) })
+
+	for _, t := range times {
+		samples := byTime[t]
+		total, bad, badness := j.combineSamples(samples)
+		j.series = append(j.series, Sample{Time: t, Good: total - bad, Total: total})
+		for i, c := range j.Components {
+			share := 0.0
+			if sum := sumOf(badness); sum > 0 {
+				share = bad * badness[i] / sum
+			}
+			j.shares[c.Name] = append(j.shares[c.Name], Sample{Time: t, Good: total - share, Total: total})
+		}
+	}
+}
+
+// Returns the journey's total and bad events for one timestamp, and how much each component
+// is to blame for the bad ones (relative to each other)
+func (j *Journey) combineSamples(samples []Sample) (total, bad float64, badness []float64) {
+	badness = make([]float64, len(samples))
+	weights, success := 0.0, 0.0
+	if j.Mode == JourneyAllGood {
+		success = 1
+	}
+	for i, s := range samples {
+		if s.Total == 0 {
+			continue
+		}
+		ratio := s.Good / s.Total
+		if j.Mode == JourneyWeighted {
+			total += s.Total
+			weights += j.Components[i].Weight
+			success += j.Components[i].Weight * ratio
+			badness[i] = j.Components[i].Weight * (1 - ratio)
+		} else {
+			total = max64(total, s.Total) // every journey passes through the busiest component
+			success *= ratio
+			badness[i] = 1 - ratio
+		}
+	}
+	if j.Mode == JourneyWeighted {
+		if weights == 0 {
+			return total, 0, badness // only components without weight had events
+		}
+		success /= weights
+	}
+	return total, total * (1 - success), badness
+}
+
+func sumOf(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func max64(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// The journey's combined good and total events
+func (j *Journey) Series() Series {
+	return j.series
+}
+
+func (j *Journey) Window(from, to time.Time) (good, total float64) {
+	return j.series.Window(from, to)
+}
+
+func (j *Journey) BudgetConsumed(at time.Time) float64 {
+	return j.series.BudgetConsumed(j.SLO, at)
+}
+
+// How much of the journey's error budget each component consumed in the SLO window ending at `at`, highest first.
+// The contributions add up to the journey's BudgetConsumed.
+func (j *Journey) ComponentBudgets(at time.Time) []ComponentBudget {
+	budgets := make([]ComponentBudget, len(j.Components))
+	for i, c := range j.Components {
+		budgets[i] = ComponentBudget{Component: c.Name, BudgetConsumed: j.shares[c.Name].BudgetConsumed(j.SLO, at)}
+	}
+	sort.SliceStable(budgets, func(a, b int) bool { return budgets[a].BudgetConsumed > budgets[b].BudgetConsumed })
+	return budgets
+}
+
+// A burn rate alert on the journey's error budget
+func (j *Journey) NewAlert(alertWindowSize time.Duration, burnRate float64) (*SLOAlert, error) {
+	return NewSLOAlertFromBurnRate(j.SLO, alertWindowSize, burnRate)
+}
+
+type journeyDto struct {
+	Name       string                `json:"name"`
+	SLO        float64               `json:"slo"`
+	Mode       string                `json:"mode"`
+	Components []journeyComponentDto `json:"components"`
+}
+
+type journeyComponentDto struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Series string  `json:"series"` // path of a series csv, relative to the journey file
+}
+
+// Loads a journey from JSON, e.g. {"name": "checkout", "slo": 0.995, "mode": "weighted",
+// "components": [{"name": "cart", "weight": 1, "series": "cart.csv"}, {"name": "pay", "weight": 2, "series": "pay.csv"}]}
+func LoadJourney(path string) (*Journey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var dto journeyDto
+	if err := json.Unmarshal(data, &dto); err != nil {
+		return nil, err
+	}
+	components := make([]JourneyComponent, 0, len(dto.Components))
+	for _, c := range dto.Components {
+		seriesPath := c.Series
+		if !filepath.IsAbs(seriesPath) {
+			seriesPath = filepath.Join(filepath.Dir(path), seriesPath)
+		}
+		series, err := loadSeries(seriesPath)
+		if err != nil {
+			return nil, fmt.Errorf("component %q: %w", c.Name, err)
+		}
+		components = append(components, JourneyComponent{Name: c.Name, Weight: c.Weight, Series: series})
+	}
+	return NewJourney(dto.Name, dto.SLO, JourneyMode(dto.Mode), components)
+}
+
+func loadSeries(path string) (Series, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSeriesCSV(f)
+}
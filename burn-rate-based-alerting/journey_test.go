@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func checkoutJourney(t *testing.T, mode JourneyMode, cartErrorRate, payErrorRate float64) *Journey {
+	j, err := NewJourney("checkout", 0.99, mode, []JourneyComponent{
+		{Name: "cart", Weight: 1, Series: constantSeries(60, 100, cartErrorRate)},
+		{Name: "pay", Weight: 3, Series: constantSeries(60, 100, payErrorRate)},
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	return j
+}
+
+func TestNewJourney(t *testing.T) {
+	component := JourneyComponent{Name: "cart", Weight: 1}
+	tests := []struct {
+		slo        float64
+		mode       JourneyMode
+		components []JourneyComponent
+		err        error
+	}{
+		{1.5, JourneyWeighted, []JourneyComponent{component}, ErrSLOOutOfRange},
+		{0.99, "any", []JourneyComponent{component}, ErrUnknownJourneyMode},
+		{0.99, JourneyAllGood, nil, ErrNoJourneyComponents},
+		{0.99, JourneyAllGood, []JourneyComponent{{}}, ErrMissingName},
+		{0.99, JourneyAllGood, []JourneyComponent{component, component}, ErrDuplicateName},
+		{0.99, JourneyWeighted, []JourneyComponent{{Name: "cart", Weight: -1}}, ErrInvalidJourneyWeight},
+		{0.99, JourneyWeighted, []JourneyComponent{{Name: "cart"}}, ErrInvalidJourneyWeight},
+		{0.99, JourneyAllGood, []JourneyComponent{{Name: "cart"}}, nil},
+	}
+	for _, test := range tests {
+		if _, err := NewJourney("checkout", test.slo, test.mode, test.components); !errors.Is(err, test.err) {
+			t.Errorf("Expected %v for %+v but got %v", test.err, test, err)
+		}
+	}
+}
+
+func TestJourneyModes(t *testing.T) {
+	tests := []struct {
+		mode            JourneyMode
+		cart, pay       float64
+		total, bad      float64 // per sample
+		cartBad, payBad float64
+	}{
+		// (0.99 + 3 * 0.96) / 4 = 0.9675 of 200 events
+		{JourneyWeighted, 0.01, 0.04, 200, 6.5, 0.5, 6},
+		// 0.9 * 0.8 = 0.72 of 100 events, blamed 1:2
+		{JourneyAllGood, 0.1, 0.2, 100, 28, 28.0 / 3, 56.0 / 3},
+		{JourneyAllGood, 0, 0, 100, 0, 0, 0},
+	}
+	for _, test := range tests {
+		j := checkoutJourney(t, test.mode, test.cart, test.pay)
+		series := j.Series()
+		if len(series) != 60 {
+			t.Fatalf("Expected 60 journey samples but got %d", len(series))
+		}
+		if s := series[0]; s.Total != test.total || math.Abs(s.Total-s.Good-test.bad) > 1e-9 {
+			t.Errorf("Expected %v bad of %v events for %+v but got %+v", test.bad, test.total, test, s)
+		}
+
+		end := series.End()
+		budget := j.BudgetConsumed(end)
+		if expected := test.bad / test.total / 0.01; math.Abs(budget-expected) > 1e-9 {
+			t.Errorf("Expected %v of the budget consumed for %+v but got %v", expected, test, budget)
+		}
+		expected := map[string]float64{"cart": test.cartBad / test.total / 0.01, "pay": test.payBad / test.total / 0.01}
+		sum := 0.0
+		for _, b := range j.ComponentBudgets(end) {
+			sum += b.BudgetConsumed
+			if math.Abs(b.BudgetConsumed-expected[b.Component]) > 1e-9 {
+				t.Errorf("Expected %s to consume %v of the budget for %+v but got %v", b.Component, expected[b.Component], test, b.BudgetConsumed)
+			}
+		}
+		if math.Abs(sum-budget) > 1e-9 {
+			t.Errorf("Expected the component budgets to add up to %v but got %v", budget, sum)
+		}
+	}
+}
+
+func TestJourneyComponentBudgetsRanked(t *testing.T) {
+	j := checkoutJourney(t, JourneyAllGood, 0.05, 0.01)
+	budgets := j.ComponentBudgets(j.Series().End())
+	if budgets[0].Component != "cart" || budgets[1].Component != "pay" {
+		t.Errorf("Expected cart to be ranked first but got %+v", budgets)
+	}
+}
+
+func TestJourneyMissingSamples(t *testing.T) {
+	// search only has events in the first 30 minutes and only affects the journey there
+	j, err := NewJourney("checkout", 0.99, JourneyAllGood, []JourneyComponent{
+		{Name: "search", Series: constantSeries(30, 100, 0.5)},
+		{Name: "pay", Series: constantSeries(60, 100, 0)},
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if rate := j.Series().ErrorRate(seriesStart, seriesStart.Add(30*time.Minute)); rate != 0.5 {
+		t.Errorf("Expected an error rate of 0.5 while search has events but got %v", rate)
+	}
+	if rate := j.Series().ErrorRate(seriesStart.Add(30*time.Minute), seriesStart.Add(time.Hour)); rate != 0 {
+		t.Errorf("Expected no errors once search has no events but got %v", rate)
+	}
+}
+
+func TestJourneyAlerts(t *testing.T) {
+	// neither component burns fast enough on its own, but the journey as a whole does
+	j := checkoutJourney(t, JourneyAllGood, 0.012, 0.012)
+	alert, err := j.NewAlert(time.Hour, 2)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	for _, c := range j.Components {
+		if alert.Firing(c.Series, c.Series.End()) {
+			t.Errorf("Expected the alert not to fire for %s alone", c.Name)
+		}
+	}
+	if !alert.Firing(j, j.Series().End()) {
+		t.Errorf("Expected the alert to fire for the journey")
+	}
+	transitions, _ := Backtest(j.Name, []*SLOAlert{alert}, j.Series(), time.Minute)
+	if len(transitions) != 1 || !transitions[0].Firing || transitions[0].Service != "checkout" {
+		t.Errorf("Expected the journey alert to start firing but got %+v", transitions)
+	}
+}
+
+func TestLoadJourney(t *testing.T) {
+	dir := t.TempDir()
+	for name, errorRate := range map[string]float64{"cart.csv": 0.01, "pay.csv": 0.04} {
+		var buf bytes.Buffer
+		WriteSeriesCSV(&buf, constantSeries(60, 100, errorRate))
+		os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644)
+	}
+	path := filepath.Join(dir, "journey.json")
+	os.WriteFile(path, []byte(`{"name": "checkout", "slo": 0.99, "mode": "weighted",
+		"components": [{"name": "cart", "weight": 1, "series": "cart.csv"}, {"name": "pay", "weight": 3, "series": "pay.csv"}]}`), 0o644)
+	j, err := LoadJourney(path)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if budget := j.BudgetConsumed(j.Series().End()); math.Abs(budget-3.25) > 1e-9 {
+		t.Errorf("Expected 3.25 of the budget consumed but got %v", budget)
+	}
+
+	os.WriteFile(path, []byte(`{"name": "checkout", "slo": 0.99, "mode": "weighted", "components": [{"name": "cart", "weight": 1, "series": "missing.csv"}]}`), 0o644)
+	if _, err := LoadJourney(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing series file to be reported but got %v", err)
+	}
+}
+
+func TestJourneyCommandModeOverride(t *testing.T) {
+	dir := t.TempDir()
+	for name, errorRate := range map[string]float64{"cart.csv": 0.01, "pay.csv": 0.04} {
+		var buf bytes.Buffer
+		WriteSeriesCSV(&buf, constantSeries(60, 100, errorRate))
+		os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644)
+	}
+	path := filepath.Join(dir, "journey.json")
+	os.WriteFile(path, []byte(`{"name": "checkout", "slo": 0.99, "mode": "weighted",
+		"components": [{"name": "cart", "weight": 1, "series": "cart.csv"}, {"name": "pay", "weight": 3, "series": "pay.csv"}]}`), 0o644)
+
+	var buf bytes.Buffer
+	if err := runCommand(&buf, "journey", []string{"-journey", path, "-mode", "all-good"}); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	// 1 - 0.99*0.96 = 4.96% of the events are bad, almost 5 times the budget
+	if !strings.HasPrefix(buf.String(), "checkout (all-good, SLO 0.99): 496.00% of the error budget consumed") {
+		t.Errorf("Unexpected command output:\n%s", buf.String())
+	}
+	if err := runCommand(&buf, "journey", []string{"-journey", path, "-mode", "any-good"}); err != ErrUnknownJourneyMode {
+		t.Errorf("Expected ErrUnknownJourneyMode but got %v", err)
+	}
+}
@@ -7,6 +7,14 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Stdout, os.Args[1], os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Just a demo of how to use the SLOAlert:
 	sloAlert, err := NewSLOAlertFromBudgetUsed(0.99, 1*time.Hour, 0.02) // alerting on 2% error budget used in the past hour (for our 99% SLO)
 	if err != nil {
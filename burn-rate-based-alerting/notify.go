@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Version of the Alertmanager webhook payload format that is sent
+const webhookVersion = "4"
+
+const burnRateAlertName = "SLOBurnRate"
+
+const defaultRepeatInterval = 4 * time.Hour
+const defaultInitialBackoff = 500 * time.Millisecond
+const defaultMaxRetries = 3
+
+var ErrNoReceivers = errors.New("at least one receiver is needed")
+
+// A Receiver is an HTTP endpoint accepting the Alertmanager webhook format
+type Receiver struct {
+	Name string
+	URL  string
+}
+
+type NotifierConfig struct {
+	Receivers      []Receiver
+	RepeatInterval time.Duration // how often to re-send an alert that keeps firing (default 4h)
+	MaxRetries     int           // extra delivery attempts after a failure (default 3, negative for none)
+	InitialBackoff time.Duration // wait before the first retry, doubled for every further retry (default 500ms)
+	ExternalURL    string        // sent as externalURL and used as the alerts' generatorURL
+	Client         *http.Client  // defaults to a client with a 5s timeout
+}
+
+// WebhookMessage is the payload Alertmanager posts to webhook receivers
+type WebhookMessage struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []WebhookAlert    `json:"alerts"`
+}
+
+type WebhookAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+type activeAlert struct {
+	alert        WebhookAlert
+	lastNotified time.Time
+}
+
+// A Notifier sends AlertTransitions to Alertmanager compatible receivers.
+// Alerts are grouped per service, alerts that are already firing are only re-sent after the repeat interval,
+// and resolved notifications are sent once an alert stops firing. It is safe for concurrent use.
+// The repeat interval is measured between the times the transitions were seen, not the wall clock,
+// so replaying a series notifies just like evaluating it live would have.
+type Notifier struct {
+	config NotifierConfig
+	mu     sync.Mutex
+	active map[string]map[string]*activeAlert // service -> fingerprint -> alert
+}
+
+func NewNotifier(config NotifierConfig) (*Notifier, error) {
+	if len(config.Receivers) == 0 {
+		return nil, ErrNoReceivers
+	}
+	if config.RepeatInterval <= 0 {
+		config.RepeatInterval = defaultRepeatInterval
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = defaultInitialBackoff
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	} else if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &Notifier{config: config, active: make(map[string]map[string]*activeAlert)}, nil
+}
+
+// Sends one message per service with changes to every receiver.
+// Each message carries all of the service's firing alerts plus the ones that just resolved.
+// Passing alerts that are still firing (see AlertTracker.Active) re-sends them once the repeat interval has passed
+// since they were last sent.
+// The changes of a service are only remembered once at least one receiver accepted its message,
+// so transitions that couldn't be delivered anywhere are sent again the next time they are passed.
+func (n *Notifier) Notify(ctx context.Context, transitions []AlertTransition) error {
+	updates := n.prepare(transitions)
+	var failures int
+	var lastErr error
+	for _, update := range updates {
+		delivered := false
+		for _, receiver := range n.config.Receivers {
+			update.message.Receiver = receiver.Name
+			if err := n.deliver(ctx, receiver, update.message); err != nil {
+				failures++
+				lastErr = err
+			} else {
+				delivered = true
+			}
+		}
+		if delivered {
+			n.commit(update)
+		}
+	}
+	if lastErr != nil {
+		return fmt.Errorf("failed to deliver %d notification(s), last error: %w", failures, lastErr)
+	}
+	return nil
+}
+
+// The pending changes to the alerts of a service and the message announcing them
+type serviceUpdate struct {
+	service  string
+	firing   map[string]*activeAlert // fingerprint -> alert that (re)started firing
+	resolved map[string]bool         // fingerprints of the alerts that stopped firing
+	message  WebhookMessage
+}
+
+func (u *serviceUpdate) lookup(group map[string]*activeAlert, fingerprint string) (*activeAlert, bool) {
+	if u.resolved[fingerprint] {
+		return nil, false
+	}
+	if a, ok := u.firing[fingerprint]; ok {
+		return a, true
+	}
+	a, ok := group[fingerprint]
+	return a, ok
+}
+
+func (n *Notifier) prepare(transitions []AlertTransition) []*serviceUpdate {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	updates := make(map[string]*serviceUpdate)
+	var services []string
+	resolvedAlerts := make(map[string][]WebhookAlert) // service -> alerts that just resolved
+	updateOf := func(service string) *serviceUpdate {
+		u, ok := updates[service]
+		if !ok {
+			u = &serviceUpdate{service: service, firing: make(map[string]*activeAlert), resolved: make(map[string]bool)}
+			updates[service] = u
+			services = append(services, service)
+		}
+		return u
+	}
+	for _, t := range transitions {
+		alert := n.webhookAlert(t)
+		u := updateOf(t.Service)
+		existing, isActive := u.lookup(n.active[t.Service], alert.Fingerprint)
+		if t.Firing {
+			seen := seenAt(t)
+			if isActive && seen.Sub(existing.lastNotified) < n.config.RepeatInterval {
+				continue // duplicate
+			}
+			if isActive {
+				alert.StartsAt = existing.alert.StartsAt
+			}
+			delete(u.resolved, alert.Fingerprint)
+			u.firing[alert.Fingerprint] = &activeAlert{alert: alert, lastNotified: seen}
+		} else if isActive {
+			delete(u.firing, alert.Fingerprint)
+			u.resolved[alert.Fingerprint] = true
+			alert.StartsAt = existing.alert.StartsAt
+			resolvedAlerts[t.Service] = append(resolvedAlerts[t.Service], alert)
+		}
+	}
+
+	result := make([]*serviceUpdate, 0, len(services))
+	for _, service := range services {
+		u := updates[service]
+		if len(u.firing) == 0 && len(u.resolved) == 0 {
+			continue // only duplicates
+		}
+		var alerts []WebhookAlert
+		for fingerprint, a := range n.active[service] {
+			if _, ok := u.firing[fingerprint]; !ok && !u.resolved[fingerprint] {
+				alerts = append(alerts, a.alert)
+			}
+		}
+		for _, a := range u.firing {
+			alerts = append(alerts, a.alert)
+		}
+		sort.Slice(alerts, func(i, j int) bool { return alerts[i].Fingerprint < alerts[j].Fingerprint })
+		alerts = append(alerts, resolvedAlerts[service]...)
+		u.message = n.webhookMessage(service, alerts)
+		result = append(result, u)
+	}
+	return result
+}
+
+// Remembers the changes of a service once its message was delivered
+func (n *Notifier) commit(u *serviceUpdate) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	group, ok := n.active[u.service]
+	if !ok {
+		group = make(map[string]*activeAlert)
+		n.active[u.service] = group
+	}
+	for fingerprint, a := range u.firing {
+		group[fingerprint] = a
+	}
+	for fingerprint := range u.resolved {
+		delete(group, fingerprint)
+	}
+	if len(group) == 0 {
+		delete(n.active, u.service)
+	}
+}
+
+// When the transition was seen, falling back to when it happened for transitions that don't say
+func seenAt(t AlertTransition) time.Time {
+	if t.Seen.IsZero() {
+		return t.At()
+	}
+	return t.Seen
+}
+
+func (n *Notifier) webhookAlert(t AlertTransition) WebhookAlert {
+	labels := map[string]string{
+		"alertname": burnRateAlertName,
+		"service":   t.Service,
+		"slo":       strconv.FormatFloat(t.Alert.SLO, 'g', -1, 64),
+		"window":    t.Alert.AlertWindowSize.String(),
+		"burn_rate": strconv.FormatFloat(t.Alert.BurnRate, 'g', -1, 64),
+	}
+	status := "firing"
+	if !t.Firing {
+		status = "resolved"
+	}
+	return WebhookAlert{
+		Status: status,
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary": fmt.Sprintf("%s is burning its error budget more than %gx too fast over %s", t.Service, t.Alert.BurnRate, t.Alert.AlertWindowSize),
+		},
+		StartsAt:     t.StartsAt,
+		EndsAt:       t.EndsAt,
+		GeneratorURL: n.config.ExternalURL,
+		Fingerprint:  fingerprint(labels),
+	}
+}
+
+func (n *Notifier) webhookMessage(service string, alerts []WebhookAlert) WebhookMessage {
+	status := "resolved"
+	for _, a := range alerts {
+		if a.Status == "firing" {
+			status = "firing"
+		}
+	}
+	groupLabels := map[string]string{"service": service}
+	return WebhookMessage{
+		Version:           webhookVersion,
+		GroupKey:          fmt.Sprintf("{}:{service=%q}", service),
+		Status:            status,
+		GroupLabels:       groupLabels,
+		CommonLabels:      commonLabels(alerts),
+		CommonAnnotations: map[string]string{},
+		ExternalURL:       n.config.ExternalURL,
+		Alerts:            alerts,
+	}
+}
+
+func commonLabels(alerts []WebhookAlert) map[string]string {
+	common := make(map[string]string)
+	if len(alerts) == 0 {
+		return common
+	}
+	for name, value := range alerts[0].Labels {
+		common[name] = value
+	}
+	for _, a := range alerts[1:] {
+		for name, value := range common {
+			if a.Labels[name] != value {
+				delete(common, name)
+			}
+		}
+	}
+	return common
+}
+
+func fingerprint(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := fnv.New64a()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(labels[name]))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func (n *Notifier) deliver(ctx context.Context, receiver Receiver, message WebhookMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	backoff := n.config.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		err = n.post(ctx, receiver.URL, body)
+		if err == nil || attempt >= n.config.MaxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver %s responded with status %d", url, resp.StatusCode)
+	}
+	return nil
+}
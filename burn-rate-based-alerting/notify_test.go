@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testReceiver struct {
+	mu       sync.Mutex
+	messages []WebhookMessage
+	failures int // number of requests to fail before accepting any
+}
+
+func (r *testReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var message WebhookMessage
+	if err := json.NewDecoder(req.Body).Decode(&message); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.messages = append(r.messages, message)
+}
+
+func (r *testReceiver) received() []WebhookMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]WebhookMessage(nil), r.messages...)
+}
+
+func newTestNotifier(t *testing.T, receiver *testReceiver, maxRetries int) *Notifier {
+	ts := httptest.NewServer(receiver)
+	t.Cleanup(ts.Close)
+	n, err := NewNotifier(NotifierConfig{
+		Receivers:      []Receiver{{Name: "team", URL: ts.URL}},
+		RepeatInterval: time.Hour,
+		MaxRetries:     maxRetries,
+		InitialBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	return n
+}
+
+func TestNewNotifier(t *testing.T) {
+	if _, err := NewNotifier(NotifierConfig{}); err != ErrNoReceivers {
+		t.Errorf("Expected ErrNoReceivers but got %v", err)
+	}
+}
+
+func TestNotifierGroupsAndDeduplicates(t *testing.T) {
+	fast, _ := NewSLOAlertFromBurnRate(0.999, 1*time.Hour, 14.4)
+	slow, _ := NewSLOAlertFromBurnRate(0.999, 6*time.Hour, 6)
+	receiver := &testReceiver{}
+	n := newTestNotifier(t, receiver, 0)
+	now := seriesStart
+	ctx := context.Background()
+
+	err := n.Notify(ctx, []AlertTransition{
+		{Service: "checkout", Alert: fast, Firing: true, StartsAt: now},
+		{Service: "checkout", Alert: slow, Firing: true, StartsAt: now},
+		{Service: "search", Alert: fast, Firing: true, StartsAt: now},
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	messages := receiver.received()
+	if len(messages) != 2 {
+		t.Fatalf("Expected one message per service but got %d", len(messages))
+	}
+	checkout := messages[0]
+	if checkout.Version != "4" || checkout.Status != "firing" || checkout.Receiver != "team" || checkout.GroupLabels["service"] != "checkout" || len(checkout.Alerts) != 2 {
+		t.Errorf("Unexpected message: %+v", checkout)
+	}
+	if checkout.CommonLabels["alertname"] != burnRateAlertName || checkout.CommonLabels["window"] != "" {
+		t.Errorf("Unexpected common labels: %v", checkout.CommonLabels)
+	}
+
+	t.Run("repeats within the repeat interval are dropped", func(t *testing.T) {
+		now = now.Add(30 * time.Minute)
+		n.Notify(ctx, []AlertTransition{{Service: "checkout", Alert: fast, Firing: true, StartsAt: seriesStart, Seen: now}})
+		if messages := receiver.received(); len(messages) != 2 {
+			t.Errorf("Expected duplicate to be dropped but got %d messages", len(messages))
+		}
+	})
+
+	t.Run("alerts still firing are re-sent after the repeat interval", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		n.Notify(ctx, []AlertTransition{{Service: "checkout", Alert: fast, Firing: true, StartsAt: seriesStart, Seen: now}})
+		messages := receiver.received()
+		if len(messages) != 3 || len(messages[2].Alerts) != 2 {
+			t.Errorf("Expected the group to be re-sent but got %+v", messages)
+		}
+	})
+
+	t.Run("resolved alerts are sent once", func(t *testing.T) {
+		resolved := AlertTransition{Service: "checkout", Alert: fast, Firing: false, StartsAt: seriesStart, EndsAt: now}
+		n.Notify(ctx, []AlertTransition{resolved})
+		n.Notify(ctx, []AlertTransition{resolved})
+		messages := receiver.received()
+		if len(messages) != 4 {
+			t.Fatalf("Expected a single resolved notification but got %d messages", len(messages))
+		}
+		last := messages[3]
+		if last.Status != "firing" || len(last.Alerts) != 2 || last.Alerts[1].Status != "resolved" || !last.Alerts[1].EndsAt.Equal(now) {
+			t.Errorf("Expected the still firing alert plus the resolved one but got %+v", last)
+		}
+
+		n.Notify(ctx, []AlertTransition{{Service: "checkout", Alert: slow, Firing: false, StartsAt: seriesStart, EndsAt: now}})
+		if last := receiver.received()[4]; last.Status != "resolved" || len(last.Alerts) != 1 {
+			t.Errorf("Expected the group to be resolved but got %+v", last)
+		}
+	})
+}
+
+func TestNotifierReplaysBacktest(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.99, 1*time.Hour, 2.0)
+	receiver := &testReceiver{}
+	n := newTestNotifier(t, receiver, 0)
+	tracker := NewAlertTracker("checkout", alert)
+	series := outageSeries()
+	// replays hours of evaluations within milliseconds, re-sending the alerts still firing at every step
+	for at := seriesStart; !at.After(series.End()); at = at.Add(10 * time.Minute) {
+		transitions := append(tracker.Evaluate(series, at), tracker.Active(at)...)
+		if err := n.Notify(context.Background(), transitions); err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+	}
+
+	var statuses []string
+	for _, m := range receiver.received() {
+		statuses = append(statuses, m.Status)
+	}
+	// the outage keeps the alert firing for over an hour but less than two: it is sent when it starts firing,
+	// re-sent once the 1h repeat interval has passed in the series' time, and resolved
+	if len(statuses) != 3 || statuses[0] != "firing" || statuses[1] != "firing" || statuses[2] != "resolved" {
+		t.Errorf("Expected firing, firing, resolved but got %v", statuses)
+	}
+}
+
+func TestNotifierRetriesFailedDeliveries(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.999, 1*time.Hour, 14.4)
+	transition := AlertTransition{Service: "checkout", Alert: alert, Firing: true, StartsAt: seriesStart}
+
+	receiver := &testReceiver{failures: 2}
+	if err := newTestNotifier(t, receiver, 2).Notify(context.Background(), []AlertTransition{transition}); err != nil {
+		t.Errorf("Expected delivery to succeed after retries but got %v", err)
+	}
+	if len(receiver.received()) != 1 {
+		t.Errorf("Expected the message to be delivered once")
+	}
+
+	receiver = &testReceiver{failures: 3}
+	if err := newTestNotifier(t, receiver, 2).Notify(context.Background(), []AlertTransition{transition}); err == nil {
+		t.Errorf("Expected delivery to fail after running out of retries")
+	}
+}
+
+func TestNotifierDefaultsToRetrying(t *testing.T) {
+	receivers := []Receiver{{Name: "team", URL: "http://localhost"}}
+	for _, c := range []struct {
+		maxRetries int
+		expected   int
+	}{
+		{0, defaultMaxRetries},
+		{-1, 0},
+		{5, 5},
+	} {
+		n, err := NewNotifier(NotifierConfig{Receivers: receivers, MaxRetries: c.maxRetries})
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		if n.config.MaxRetries != c.expected {
+			t.Errorf("Expected %d retries for MaxRetries %d but got %d", c.expected, c.maxRetries, n.config.MaxRetries)
+		}
+	}
+}
+
+func TestNotifierKeepsUndeliveredChanges(t *testing.T) {
+	ctx := context.Background()
+	alert, _ := NewSLOAlertFromBurnRate(0.999, 1*time.Hour, 14.4)
+	firing := AlertTransition{Service: "checkout", Alert: alert, Firing: true, StartsAt: seriesStart, Seen: seriesStart}
+	resolved := AlertTransition{Service: "checkout", Alert: alert, Firing: false, StartsAt: seriesStart, EndsAt: seriesStart.Add(time.Minute)}
+
+	receiver := &testReceiver{failures: 1}
+	n := newTestNotifier(t, receiver, -1)
+	if err := n.Notify(ctx, []AlertTransition{firing}); err == nil {
+		t.Fatalf("Expected the delivery to fail")
+	}
+	if err := n.Notify(ctx, []AlertTransition{firing}); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if got := len(receiver.received()); got != 1 {
+		t.Fatalf("Expected the undelivered alert to be sent again but got %d messages", got)
+	}
+
+	receiver.mu.Lock()
+	receiver.failures = 1
+	receiver.mu.Unlock()
+	if err := n.Notify(ctx, []AlertTransition{resolved}); err == nil {
+		t.Fatalf("Expected the delivery to fail")
+	}
+	if err := n.Notify(ctx, []AlertTransition{resolved}); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	messages := receiver.received()
+	if len(messages) != 2 || messages[1].Status != "resolved" {
+		t.Fatalf("Expected the undelivered resolution to be sent again but got %+v", messages)
+	}
+}
+
+func TestNotifierRemembersChangesDeliveredToAnyReceiver(t *testing.T) {
+	ok, failing := &testReceiver{}, &testReceiver{failures: 1}
+	okServer, failingServer := httptest.NewServer(ok), httptest.NewServer(failing)
+	t.Cleanup(okServer.Close)
+	t.Cleanup(failingServer.Close)
+	n, err := NewNotifier(NotifierConfig{
+		Receivers:      []Receiver{{Name: "ok", URL: okServer.URL}, {Name: "failing", URL: failingServer.URL}},
+		RepeatInterval: time.Hour,
+		MaxRetries:     -1,
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	alert, _ := NewSLOAlertFromBurnRate(0.999, 1*time.Hour, 14.4)
+	firing := AlertTransition{Service: "checkout", Alert: alert, Firing: true, StartsAt: seriesStart, Seen: seriesStart}
+	if err := n.Notify(context.Background(), []AlertTransition{firing}); err == nil {
+		t.Errorf("Expected the failed delivery to be reported")
+	}
+	if err := n.Notify(context.Background(), []AlertTransition{firing}); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(ok.received()) != 1 || len(failing.received()) != 0 {
+		t.Errorf("Expected the alert not to be repeated once a receiver accepted it but got %d and %d messages", len(ok.received()), len(failing.received()))
+	}
+}
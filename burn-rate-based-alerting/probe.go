@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultProbeInterval = 30 * time.Second
+const defaultProbeTimeout = 5 * time.Second
+const maxProbeBodyBytes = 1 << 20
+
+var ErrNoProbeTargets = errors.New("at least one probe target is needed")
+var ErrUnknownProbeTarget = errors.New("unknown probe target")
+var ErrInvalidProbeTargetName = errors.New("probe target names cannot contain path separators or be . or ..")
+
+// Rules that decide whether a probe result is good. Every configured rule has to pass.
+type ProbeRules struct {
+	StatusCodes []int          // accepted status codes, any 2xx when empty
+	MaxLatency  time.Duration  // no limit when 0
+	BodyMatch   *regexp.Regexp // the response body has to match, when set
+}
+
+// A ProbeTarget is an endpoint to be probed on an interval
+type ProbeTarget struct {
+	Name     string
+	URL      string
+	Method   string // GET when empty
+	Interval time.Duration
+	Timeout  time.Duration
+	Rules    ProbeRules
+}
+
+type ProbeResult struct {
+	Target     string
+	Time       time.Time
+	Good       bool
+	StatusCode int
+	Latency    time.Duration
+	Reason     string // why the result is bad
+}
+
+// A Prober is a synthetic SLI source for endpoints with little organic traffic.
+// Every probe counts as one event, recorded in a live Evaluator per target and in the target's history.
+type Prober struct {
+	client     *http.Client
+	targets    map[string]ProbeTarget
+	names      []string
+	evaluators map[string]*Evaluator
+	mu         sync.Mutex
+	history    map[string]Series
+}
+
+func NewProber(targets []ProbeTarget, resolution time.Duration) (*Prober, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoProbeTargets
+	}
+	p := &Prober{
+		client:     &http.Client{},
+		targets:    make(map[string]ProbeTarget),
+		evaluators: make(map[string]*Evaluator),
+		history:    make(map[string]Series),
+	}
+	for _, target := range targets {
+		if target.Name == "" {
+			return nil, ErrMissingName
+		}
+		// names double as snapshot file names
+		if strings.ContainsAny(target.Name, `/\`) || target.Name == "." || target.Name == ".." {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidProbeTargetName, target.Name)
+		}
+		if _, ok := p.targets[target.Name]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateName, target.Name)
+		}
+		if target.Method == "" {
+			target.Method = http.MethodGet
+		}
+		if target.Interval <= 0 {
+			target.Interval = defaultProbeInterval
+		}
+		if target.Timeout <= 0 {
+			target.Timeout = defaultProbeTimeout
+		}
+		evaluator, err := NewEvaluator(resolution)
+		if err != nil {
+			return nil, err
+		}
+		p.targets[target.Name] = target
+		p.names = append(p.names, target.Name)
+		p.evaluators[target.Name] = evaluator
+	}
+	sort.Strings(p.names)
+	return p, nil
+}
+
+// Probes every target on its interval until the context is done. Results are passed to onResult, if set.
+func (p *Prober) Run(ctx context.Context, onResult func(ProbeResult)) {
+	var wg sync.WaitGroup
+	for _, name := range p.names {
+		wg.Add(1)
+		go func(target ProbeTarget) {
+			defer wg.Done()
+			ticker := time.NewTicker(target.Interval)
+			defer ticker.Stop()
+			for {
+				result := p.probe(ctx, target)
+				if ctx.Err() != nil {
+					return // don't count probes that were cut short by shutting down
+				}
+				p.record(result)
+				if onResult != nil {
+					onResult(result)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(p.targets[name])
+	}
+	wg.Wait()
+}
+
+// Probes a single target once and records the result
+func (p *Prober) ProbeOnce(ctx context.Context, name string) (ProbeResult, error) {
+	target, ok := p.targets[name]
+	if !ok {
+		return ProbeResult{}, fmt.Errorf("%w: %q", ErrUnknownProbeTarget, name)
+	}
+	result := p.probe(ctx, target)
+	p.record(result)
+	return result, nil
+}
+
+func (p *Prober) probe(ctx context.Context, target ProbeTarget) ProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, target.Timeout)
+	defer cancel()
+	start := time.Now()
+	result := ProbeResult{Target: target.Name, Time: start}
+
+	req, err := http.NewRequestWithContext(ctx, target.Method, target.URL, nil)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.Reason = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodyBytes))
+	result.Latency = time.Since(start)
+	result.StatusCode = resp.StatusCode
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	result.Good, result.Reason = target.Rules.judge(resp.StatusCode, result.Latency, body)
+	return result
+}
+
+func (r ProbeRules) judge(statusCode int, latency time.Duration, body []byte) (bool, string) {
+	if !r.acceptsStatus(statusCode) {
+		return false, fmt.Sprintf("unexpected status %d", statusCode)
+	}
+	if r.MaxLatency > 0 && latency > r.MaxLatency {
+		return false, fmt.Sprintf("latency %s above %s", latency, r.MaxLatency)
+	}
+	if r.BodyMatch != nil && !r.BodyMatch.Match(body) {
+		return false, fmt.Sprintf("body does not match %q", r.BodyMatch)
+	}
+	return true, ""
+}
+
+func (r ProbeRules) acceptsStatus(statusCode int) bool {
+	if len(r.StatusCodes) == 0 {
+		return statusCode >= 200 && statusCode <= 299
+	}
+	for _, code := range r.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Prober) record(result ProbeResult) {
+	good := 0.0
+	if result.Good {
+		good = 1
+	}
+	p.evaluators[result.Target].Record(result.Time, good, 1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	history := append(p.history[result.Target], Sample{Time: result.Time, Good: good, Total: 1, Labels: map[string]string{"target": result.Target}})
+	oldest := result.Time.Add(-SLOWindowSize)
+	p.history[result.Target] = history[sort.Search(len(history), func(i int) bool { return history[i].Time.After(oldest) }):]
+}
+
+// The live Evaluator of a target, for evaluating SLOAlerts and budgets while probing
+func (p *Prober) Evaluator(name string) *Evaluator {
+	return p.evaluators[name]
+}
+
+// The file in dir that keeps the snapshot of a target's evaluator
+func snapshotPath(dir, name string) string {
+	return filepath.Join(dir, name+".json")
+}
+
+// Restores the evaluator of each target from its snapshot in dir, filling the time since the snapshot was taken
+// according to the gap policy. Targets without a snapshot keep their new evaluator. Call it before Run.
+func (p *Prober) LoadSnapshots(dir string, now time.Time, policy GapPolicy) error {
+	for _, name := range p.names {
+		evaluator, err := LoadOrNewEvaluator(snapshotPath(dir, name), p.evaluators[name].Resolution(), now, policy)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		p.evaluators[name] = evaluator
+	}
+	return nil
+}
+
+// Saves a snapshot of every target's evaluator to dir every interval until the context is done,
+// and once more right before returning. See Evaluator.CheckpointEvery.
+func (p *Prober) CheckpointEvery(ctx context.Context, dir string, interval time.Duration, now func() time.Time, onError func(error)) {
+	var wg sync.WaitGroup
+	for _, name := range p.names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			p.evaluators[name].CheckpointEvery(ctx, snapshotPath(dir, name), interval, now, func(err error) {
+				if onError != nil {
+					onError(fmt.Errorf("%s: %w", name, err))
+				}
+			})
+		}(name)
+	}
+	wg.Wait()
+}
+
+// The probe results of a target so far, as a good/total series
+func (p *Prober) History(name string) Series {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append(Series(nil), p.history[name]...)
+}
+
+// Writes the history of all targets in the series csv format used for backtesting, with a target label column
+func (p *Prober) WriteHistoryCSV(w io.Writer) error {
+	var all Series
+	for _, name := range p.names {
+		all = append(all, p.History(name)...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+	return WriteSeriesCSV(w, all, "target")
+}
+
+type probeTargetDto struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Method      string `json:"method"`
+	Interval    string `json:"interval"`
+	Timeout     string `json:"timeout"`
+	StatusCodes []int  `json:"statusCodes"`
+	MaxLatency  string `json:"maxLatency"`
+	BodyMatch   string `json:"bodyMatch"`
+}
+
+// Loads probe targets from a JSON list, e.g. [{"name": "home", "url": "https://example.com", "interval": "30s", "maxLatency": "500ms"}]
+func LoadProbeTargets(path string) ([]ProbeTarget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var dtos []probeTargetDto
+	if err := json.Unmarshal(data, &dtos); err != nil {
+		return nil, err
+	}
+	targets := make([]ProbeTarget, 0, len(dtos))
+	for i, dto := range dtos {
+		target := ProbeTarget{Name: dto.Name, URL: dto.URL, Method: dto.Method, Rules: ProbeRules{StatusCodes: dto.StatusCodes}}
+		durations := []struct {
+			value string
+			dest  *time.Duration
+		}{{dto.Interval, &target.Interval}, {dto.Timeout, &target.Timeout}, {dto.MaxLatency, &target.Rules.MaxLatency}}
+		for _, d := range durations {
+			if d.value == "" {
+				continue
+			}
+			if *d.dest, err = time.ParseDuration(d.value); err != nil {
+				return nil, fmt.Errorf("%s: [%d]: %w", path, i, err)
+			}
+		}
+		if dto.BodyMatch != "" {
+			if target.Rules.BodyMatch, err = regexp.Compile(dto.BodyMatch); err != nil {
+				return nil, fmt.Errorf("%s: [%d].bodyMatch: %w", path, i, err)
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A backend whose failures can be switched on and off while it is being probed
+type flakyBackend struct {
+	mu     sync.Mutex
+	status int
+	delay  time.Duration
+	body   string
+}
+
+func (b *flakyBackend) set(status int, delay time.Duration, body string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status, b.delay, b.body = status, delay, body
+}
+
+func (b *flakyBackend) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b.mu.Lock()
+	status, delay, body := b.status, b.delay, b.body
+	b.mu.Unlock()
+	time.Sleep(delay)
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+func newTestProber(t *testing.T, backend *flakyBackend, rules ProbeRules) *Prober {
+	ts := httptest.NewServer(backend)
+	t.Cleanup(ts.Close)
+	p, err := NewProber([]ProbeTarget{{Name: "api", URL: ts.URL, Interval: 10 * time.Millisecond, Timeout: time.Second, Rules: rules}}, time.Second)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	return p
+}
+
+func TestNewProber(t *testing.T) {
+	tests := []struct {
+		targets []ProbeTarget
+		err     error
+	}{
+		{nil, ErrNoProbeTargets},
+		{[]ProbeTarget{{URL: "http://localhost"}}, ErrMissingName},
+		{[]ProbeTarget{{Name: "a"}, {Name: "a"}}, ErrDuplicateName},
+		{[]ProbeTarget{{Name: "../etc/passwd"}}, ErrInvalidProbeTargetName},
+		{[]ProbeTarget{{Name: `api\v1`}}, ErrInvalidProbeTargetName},
+		{[]ProbeTarget{{Name: ".."}}, ErrInvalidProbeTargetName},
+	}
+	for _, test := range tests {
+		if _, err := NewProber(test.targets, time.Minute); !errors.Is(err, test.err) {
+			t.Errorf("Expected %v for %v but got %v", test.err, test.targets, err)
+		}
+	}
+	if _, err := NewProber([]ProbeTarget{{Name: "a"}}, time.Hour); err != ErrEvaluatorResolutionOutOfRange {
+		t.Errorf("Expected ErrEvaluatorResolutionOutOfRange but got %v", err)
+	}
+}
+
+func TestProbeOnce(t *testing.T) {
+	rules := ProbeRules{MaxLatency: 50 * time.Millisecond, BodyMatch: regexp.MustCompile(`"status":\s*"ok"`)}
+	tests := []struct {
+		status int
+		delay  time.Duration
+		body   string
+		good   bool
+		reason string
+	}{
+		{200, 0, `{"status": "ok"}`, true, ""},
+		{500, 0, `{"status": "ok"}`, false, "unexpected status 500"},
+		{200, 100 * time.Millisecond, `{"status": "ok"}`, false, "latency"},
+		{200, 0, `{"status": "degraded"}`, false, "body does not match"},
+	}
+	backend := &flakyBackend{}
+	p := newTestProber(t, backend, rules)
+	for _, test := range tests {
+		backend.set(test.status, test.delay, test.body)
+		result, err := p.ProbeOnce(context.Background(), "api")
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		if result.Good != test.good || !strings.HasPrefix(result.Reason, test.reason) {
+			t.Errorf("Expected good=%t with reason %q for %+v but got %+v", test.good, test.reason, test, result)
+		}
+		if result.StatusCode != test.status {
+			t.Errorf("Expected status %d but got %d", test.status, result.StatusCode)
+		}
+	}
+	if len(p.History("api")) != len(tests) {
+		t.Errorf("Expected %d samples in the history but got %d", len(tests), len(p.History("api")))
+	}
+	if _, err := p.ProbeOnce(context.Background(), "unknown"); !errors.Is(err, ErrUnknownProbeTarget) {
+		t.Errorf("Expected ErrUnknownProbeTarget but got %v", err)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	backend := &flakyBackend{status: 200, delay: 200 * time.Millisecond}
+	ts := httptest.NewServer(backend)
+	defer ts.Close()
+	p, err := NewProber([]ProbeTarget{{Name: "api", URL: ts.URL, Timeout: 20 * time.Millisecond}}, time.Second)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	result, _ := p.ProbeOnce(context.Background(), "api")
+	if result.Good || result.Reason == "" {
+		t.Errorf("Expected a timed out probe to be bad but got %+v", result)
+	}
+}
+
+func TestProbeStatusCodes(t *testing.T) {
+	backend := &flakyBackend{status: http.StatusNoContent}
+	p := newTestProber(t, backend, ProbeRules{StatusCodes: []int{200}})
+	if result, _ := p.ProbeOnce(context.Background(), "api"); result.Good {
+		t.Errorf("Expected 204 to be bad when only 200 is accepted")
+	}
+	backend.set(http.StatusUnauthorized, 0, "")
+	p = newTestProber(t, backend, ProbeRules{StatusCodes: []int{401}})
+	if result, _ := p.ProbeOnce(context.Background(), "api"); !result.Good {
+		t.Errorf("Expected 401 to be good when it is accepted but got %+v", result)
+	}
+}
+
+func TestProberFeedsBurnRateAlerts(t *testing.T) {
+	backend := &flakyBackend{status: 200}
+	p := newTestProber(t, backend, ProbeRules{})
+	alert, _ := NewSLOAlertFromBurnRate(0.99, time.Hour, 10)
+	end := func() time.Time { return time.Now().Add(time.Second) } // the evaluator only counts complete buckets
+	for i := 0; i < 10; i++ {
+		p.ProbeOnce(context.Background(), "api")
+	}
+	if alert.Firing(p.Evaluator("api"), end()) {
+		t.Errorf("Expected the alert not to fire while all probes succeed")
+	}
+
+	backend.set(http.StatusServiceUnavailable, 0, "")
+	for i := 0; i < 10; i++ {
+		p.ProbeOnce(context.Background(), "api")
+	}
+	// half the probes failed: a burn rate of 50 > 10
+	if burnRate := alert.ObservedBurnRate(p.Evaluator("api"), end()); burnRate < 49 || burnRate > 51 {
+		t.Errorf("Expected a burn rate of 50 but got %v", burnRate)
+	}
+	if !alert.Firing(p.Evaluator("api"), end()) {
+		t.Errorf("Expected the alert to fire once half the probes fail")
+	}
+}
+
+func TestProberRun(t *testing.T) {
+	backend := &flakyBackend{status: 500}
+	p := newTestProber(t, backend, ProbeRules{})
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var results []ProbeResult
+	p.Run(ctx, func(r ProbeResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, r)
+		if len(results) == 5 {
+			cancel()
+		}
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if len(results) < 5 {
+		t.Fatalf("Expected at least 5 results but got %d", len(results))
+	}
+	for _, r := range results {
+		if r.Good {
+			t.Errorf("Expected all probes to be bad but got %+v", r)
+		}
+	}
+	good, total := p.Evaluator("api").Window(results[0].Time.Add(-time.Second), time.Now().Add(time.Second))
+	if good != 0 || total != float64(len(p.History("api"))) {
+		t.Errorf("Expected the evaluator to count all %d bad probes but got %v/%v", len(p.History("api")), good, total)
+	}
+}
+
+func TestProberSnapshots(t *testing.T) {
+	backend := &flakyBackend{status: 500}
+	p := newTestProber(t, backend, ProbeRules{})
+	for i := 0; i < 3; i++ {
+		p.ProbeOnce(context.Background(), "api")
+	}
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // checkpoints once and returns
+	p.CheckpointEvery(ctx, dir, time.Minute, time.Now, func(err error) { t.Errorf("Checkpoint failed: %v", err) })
+
+	restored := newTestProber(t, backend, ProbeRules{})
+	if err := restored.LoadSnapshots(dir, time.Now(), GapUnknown); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	from, to := time.Now().Add(-time.Minute), time.Now().Add(time.Second)
+	if good, total := restored.Evaluator("api").Window(from, to); good != 0 || total != 3 {
+		t.Errorf("Expected the 3 bad probes to be restored but got %v/%v", good, total)
+	}
+
+	if err := restored.LoadSnapshots(t.TempDir(), time.Now(), GapUnknown); err != nil {
+		t.Errorf("Expected a missing snapshot to start a new evaluator but got %v", err)
+	}
+	if _, total := restored.Evaluator("api").Window(from, to); total != 0 {
+		t.Errorf("Expected a new evaluator but got %v events", total)
+	}
+}
+
+func TestWriteProbeHistoryCSV(t *testing.T) {
+	backend := &flakyBackend{status: 200}
+	ts := httptest.NewServer(backend)
+	defer ts.Close()
+	p, err := NewProber([]ProbeTarget{{Name: "home", URL: ts.URL}, {Name: "login", URL: ts.URL + "/login"}}, time.Second)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	p.ProbeOnce(context.Background(), "home")
+	backend.set(500, 0, "")
+	p.ProbeOnce(context.Background(), "login")
+	p.ProbeOnce(context.Background(), "home")
+
+	var buf bytes.Buffer
+	if err := p.WriteHistoryCSV(&buf); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	series, err := ReadSeriesCSV(&buf)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(series) != 3 {
+		t.Fatalf("Expected 3 samples but got %d", len(series))
+	}
+	perTarget, err := SplitSeriesByLabels(series, []string{"target"}, 2)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	home, login := perTarget["target=home"], perTarget["target=login"]
+	if len(home) != 2 || home[0].Good != 1 || home[1].Good != 0 {
+		t.Errorf("Unexpected history for home: %+v", home)
+	}
+	if len(login) != 1 || login[0].Good != 0 {
+		t.Errorf("Unexpected history for login: %+v", login)
+	}
+}
+
+func TestLoadProbeTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "probes.json")
+	os.WriteFile(path, []byte(`[{"name": "home", "url": "http://localhost", "interval": "1m", "maxLatency": "300ms", "statusCodes": [200, 204], "bodyMatch": "ok"}]`), 0o644)
+	targets, err := LoadProbeTargets(path)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	target := targets[0]
+	if target.Name != "home" || target.Interval != time.Minute || target.Rules.MaxLatency != 300*time.Millisecond ||
+		len(target.Rules.StatusCodes) != 2 || target.Rules.BodyMatch.String() != "ok" {
+		t.Errorf("Unexpected target: %+v", target)
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "home", "url": "http://localhost", "bodyMatch": "("}]`), 0o644)
+	if _, err := LoadProbeTargets(path); err == nil {
+		t.Errorf("Expected an error for an invalid bodyMatch")
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrEmptyTimeline = errors.New("timeline needs at least one phase")
+var ErrInvalidPromtoolInterval = errors.New("interval must be a positive number of seconds that divides every alert window and phase")
+
+// Rule evaluations this many intervals away from a predicted transition are expected to agree with the Go model.
+// Closer to the transition, Prometheus' rate() only covering the samples inside the range can flip the result early.
+const promtoolMarginIntervals = 2
+
+// An ErrorPhase is a period of time with a constant error rate
+type ErrorPhase struct {
+	Duration  time.Duration
+	ErrorRate float64
+}
+
+// Settings for generating Prometheus rules and promtool unit tests
+type PromtoolConfig struct {
+	Service             string
+	GoodMetric          string // counter of good events
+	TotalMetric         string // counter of total events
+	RequestsPerInterval float64
+	Interval            time.Duration // scrape and rule evaluation interval
+	RuleFile            string        // path of the rules file, as referenced from the test file
+}
+
+func DefaultPromtoolConfig(service string) PromtoolConfig {
+	return PromtoolConfig{
+		Service:             service,
+		GoodMetric:          "slo_requests_good_total",
+		TotalMetric:         "slo_requests_total",
+		RequestsPerInterval: 100,
+		Interval:            time.Minute,
+		RuleFile:            "rules.yml",
+	}
+}
+
+// The timeline a Scenario describes: a full alert window without errors, followed by the scenario's error rate
+// for long enough to see the alert fire
+func ScenarioTimeline(s *Scenario) []ErrorPhase {
+	return []ErrorPhase{
+		{Duration: s.Alert.AlertWindowSize, ErrorRate: 0},
+		{Duration: s.Alert.AlertWindowSize, ErrorRate: s.ErrorRate},
+	}
+}
+
+// Parses a timeline like "1h:0,30m:0.05,1h:0" (duration:errorRate pairs)
+func ParseTimeline(s string) ([]ErrorPhase, error) {
+	var timeline []ErrorPhase
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("phase %q should have the form duration:errorRate", part)
+		}
+		duration, err := time.ParseDuration(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		errorRate, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		if errorRate < MinErrorRate || errorRate > MaxErrorRate {
+			return nil, ErrErrorRateOutOfRange
+		}
+		timeline = append(timeline, ErrorPhase{Duration: duration, ErrorRate: errorRate})
+	}
+	return timeline, nil
+}
+
+// The series of samples the timeline produces, one per interval, starting at the unix epoch like promtool does
+func TimelineSeries(timeline []ErrorPhase, config PromtoolConfig) Series {
+	var series Series
+	t := time.Unix(0, 0).UTC()
+	for _, phase := range timeline {
+		for i := int64(0); i < int64(phase.Duration/config.Interval); i++ {
+			t = t.Add(config.Interval)
+			series = append(series, Sample{Time: t, Good: config.RequestsPerInterval * (1 - phase.ErrorRate), Total: config.RequestsPerInterval})
+		}
+	}
+	return series
+}
+
+// Writes a Prometheus rules file with one burn rate alert per SLOAlert
+func WritePromRules(w io.Writer, alerts []*SLOAlert, config PromtoolConfig) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "groups:\n  - name: %s-slo-burn-rate\n    rules:\n", config.Service)
+	for _, alert := range alerts {
+		window := promDuration(alert.AlertWindowSize)
+		fmt.Fprintf(&b, "      - alert: %s\n", burnRateAlertName)
+		fmt.Fprintf(&b, "        expr: (1 - sum(rate(%s[%s])) / sum(rate(%s[%s]))) > %s * (1 - %s)\n",
+			promSelector(config.GoodMetric, config.Service), window, promSelector(config.TotalMetric, config.Service), window,
+			strconv.FormatFloat(alert.BurnRate, 'g', -1, 64), strconv.FormatFloat(alert.SLO, 'g', -1, 64))
+		b.WriteString("        labels:\n")
+		for _, label := range promtoolAlertLabels(alert, config) {
+			fmt.Fprintf(&b, "          %s: %q\n", label[0], label[1])
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type promtoolExpectation struct {
+	at     time.Duration // since the start of the series
+	firing []*SLOAlert
+}
+
+// Writes a promtool rule unit test for the scenario, expecting the alert not to fire shortly before the detection time
+// predicted by the Scenario, and to fire shortly after it
+func WriteScenarioPromtoolTest(w io.Writer, s *Scenario, config PromtoolConfig) error {
+	margin := promtoolMarginIntervals * config.Interval
+	timeline := ScenarioTimeline(s)
+	timeline[1].Duration += margin
+	if err := verifyPromtoolTimeline(timeline, []*SLOAlert{s.Alert}, config); err != nil {
+		return err
+	}
+	errorsStart := timeline[0].Duration
+	end := errorsStart + timeline[1].Duration
+	var expectations []promtoolExpectation
+	if !s.Check() {
+		expectations = append(expectations, promtoolExpectation{at: end})
+	} else {
+		detection := errorsStart + s.DetectionTime()
+		if before := detection - margin; before > errorsStart {
+			expectations = append(expectations, promtoolExpectation{at: before.Truncate(config.Interval)})
+		}
+		if after := (detection + margin).Truncate(config.Interval); after <= end {
+			expectations = append(expectations, promtoolExpectation{at: after, firing: []*SLOAlert{s.Alert}})
+		}
+	}
+	return writePromtoolTest(w, timeline, expectations, config)
+}
+
+// Writes a promtool rule unit test for the alerts over the timeline.
+// The expectations are placed around every transition that the Go model predicts when backtesting the timeline.
+func WritePromtoolTest(w io.Writer, alerts []*SLOAlert, timeline []ErrorPhase, config PromtoolConfig) error {
+	if err := verifyPromtoolTimeline(timeline, alerts, config); err != nil {
+		return err
+	}
+	series := TimelineSeries(timeline, config)
+	transitions, err := Backtest(config.Service, alerts, series, config.Interval)
+	if err != nil {
+		return err
+	}
+
+	start := time.Unix(0, 0).UTC()
+	margin := promtoolMarginIntervals * config.Interval
+	times := map[time.Duration]bool{series.End().Sub(start): true}
+	for _, t := range transitions {
+		at := t.At().Sub(start)
+		if at-margin > 0 {
+			times[at-margin] = true
+		}
+		if at+margin <= series.End().Sub(start) {
+			times[at+margin] = true
+		}
+	}
+	var expectations []promtoolExpectation
+	for at := range times {
+		e := promtoolExpectation{at: at}
+		for _, alert := range alerts {
+			if alert.Firing(series, start.Add(at)) {
+				e.firing = append(e.firing, alert)
+			}
+		}
+		expectations = append(expectations, e)
+	}
+	sort.Slice(expectations, func(i, j int) bool { return expectations[i].at < expectations[j].at })
+	return writePromtoolTest(w, timeline, expectations, config)
+}
+
+func verifyPromtoolTimeline(timeline []ErrorPhase, alerts []*SLOAlert, config PromtoolConfig) error {
+	if len(timeline) == 0 {
+		return ErrEmptyTimeline
+	}
+	if config.Interval < time.Second || config.Interval%time.Second != 0 {
+		return ErrInvalidPromtoolInterval
+	}
+	for _, phase := range timeline {
+		if phase.Duration%config.Interval != 0 {
+			return ErrInvalidPromtoolInterval
+		}
+	}
+	for _, alert := range alerts {
+		if alert.AlertWindowSize%config.Interval != 0 {
+			return ErrInvalidPromtoolInterval
+		}
+	}
+	return nil
+}
+
+func writePromtoolTest(w io.Writer, timeline []ErrorPhase, expectations []promtoolExpectation, config PromtoolConfig) error {
+	interval := promDuration(config.Interval)
+	var b strings.Builder
+	fmt.Fprintf(&b, "rule_files:\n  - %s\n\nevaluation_interval: %s\n\ntests:\n  - interval: %s\n    input_series:\n", config.RuleFile, interval, interval)
+	fmt.Fprintf(&b, "      - series: '%s'\n        values: '%s'\n", promSelector(config.GoodMetric, config.Service), counterValues(timeline, config, true))
+	fmt.Fprintf(&b, "      - series: '%s'\n        values: '%s'\n", promSelector(config.TotalMetric, config.Service), counterValues(timeline, config, false))
+	b.WriteString("    alert_rule_test:\n")
+	for _, e := range expectations {
+		fmt.Fprintf(&b, "      - eval_time: %s\n        alertname: %s\n", promDuration(e.at), burnRateAlertName)
+		if len(e.firing) == 0 {
+			b.WriteString("        exp_alerts: []\n")
+			continue
+		}
+		b.WriteString("        exp_alerts:\n")
+		for _, alert := range e.firing {
+			b.WriteString("          - exp_labels:\n")
+			for _, label := range promtoolAlertLabels(alert, config) {
+				fmt.Fprintf(&b, "              %s: %q\n", label[0], label[1])
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Counter values in promtool's expanding notation, one value per interval starting at 0
+func counterValues(timeline []ErrorPhase, config PromtoolConfig, good bool) string {
+	values := []string{"0"}
+	counter := 0.0
+	for _, phase := range timeline {
+		n := int64(phase.Duration / config.Interval)
+		if n == 0 {
+			continue
+		}
+		increment := config.RequestsPerInterval
+		if good {
+			increment *= 1 - phase.ErrorRate
+		}
+		values = append(values, fmt.Sprintf("%s+%sx%d", promFloat(counter+increment), promFloat(increment), n-1))
+		counter += increment * float64(n)
+	}
+	return strings.Join(values, " ")
+}
+
+func promtoolAlertLabels(alert *SLOAlert, config PromtoolConfig) [][2]string {
+	return [][2]string{
+		{"burn_rate", strconv.FormatFloat(alert.BurnRate, 'g', -1, 64)},
+		{"service", config.Service},
+		{"window", promDuration(alert.AlertWindowSize)},
+	}
+}
+
+func promSelector(metric, service string) string {
+	return fmt.Sprintf("%s{service=%q}", metric, service)
+}
+
+func promFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Formats durations the way PromQL expects them, e.g. 90m instead of 1h30m0s
+func promDuration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "0s"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
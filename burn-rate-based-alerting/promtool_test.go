@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Expands promtool's "a+bxn" notation into the list of values it stands for
+func expandValues(t *testing.T, values string) []float64 {
+	var expanded []float64
+	for _, part := range strings.Fields(values) {
+		if !strings.Contains(part, "x") {
+			v, _ := strconv.ParseFloat(part, 64)
+			expanded = append(expanded, v)
+			continue
+		}
+		var start, increment float64
+		var n int
+		plus := strings.Index(part[1:], "+") + 1
+		x := strings.LastIndex(part, "x")
+		start, _ = strconv.ParseFloat(part[:plus], 64)
+		increment, _ = strconv.ParseFloat(part[plus+1:x], 64)
+		n, _ = strconv.Atoi(part[x+1:])
+		for i := 0; i <= n; i++ {
+			expanded = append(expanded, start+float64(i)*increment)
+		}
+	}
+	return expanded
+}
+
+func TestParsingTimeline(t *testing.T) {
+	timeline, err := ParseTimeline("1h:0, 30m:0.05")
+	if err != nil || len(timeline) != 2 || timeline[1].Duration != 30*time.Minute || timeline[1].ErrorRate != 0.05 {
+		t.Errorf("ParseTimeline returned %+v, %v", timeline, err)
+	}
+	for _, input := range []string{"1h", "1h:x", "soon:0.1", "1h:1.5"} {
+		if _, err := ParseTimeline(input); err == nil {
+			t.Errorf("Expected error parsing %q", input)
+		}
+	}
+}
+
+func TestCounterValuesMatchTimelineSeries(t *testing.T) {
+	config := DefaultPromtoolConfig("checkout")
+	timeline := []ErrorPhase{{30 * time.Minute, 0}, {10 * time.Minute, 0.25}, {time.Minute, 1}, {20 * time.Minute, 0}}
+	series := TimelineSeries(timeline, config)
+	good := expandValues(t, counterValues(timeline, config, true))
+	total := expandValues(t, counterValues(timeline, config, false))
+	if len(good) != len(series)+1 || len(total) != len(series)+1 {
+		t.Fatalf("Expected %d values but got %d and %d", len(series)+1, len(good), len(total))
+	}
+	var goodSum, totalSum float64
+	for i, sample := range series {
+		goodSum += sample.Good
+		totalSum += sample.Total
+		if math.Abs(good[i+1]-goodSum) > 1e-9 || math.Abs(total[i+1]-totalSum) > 1e-9 {
+			t.Fatalf("Counters diverge from the series at sample %d: %f/%f vs %f/%f", i, good[i+1], total[i+1], goodSum, totalSum)
+		}
+	}
+}
+
+func TestWritingPromRules(t *testing.T) {
+	fast, _ := NewSLOAlertFromBurnRate(0.999, 1*time.Hour, 14.4)
+	slow, _ := NewSLOAlertFromBurnRate(0.999, 90*time.Minute, 6)
+	var buf bytes.Buffer
+	if err := WritePromRules(&buf, []*SLOAlert{fast, slow}, DefaultPromtoolConfig("checkout")); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	rules := buf.String()
+	expected := `expr: (1 - sum(rate(slo_requests_good_total{service="checkout"}[90m])) / sum(rate(slo_requests_total{service="checkout"}[90m]))) > 6 * (1 - 0.999)`
+	if !strings.HasPrefix(rules, "groups:\n  - name: checkout-slo-burn-rate\n") || !strings.Contains(rules, expected) || strings.Count(rules, "- alert: SLOBurnRate") != 2 {
+		t.Errorf("Unexpected rules:\n%s", rules)
+	}
+}
+
+func TestWritingScenarioPromtoolTest(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.99, 1*time.Hour, 2.0)
+	config := DefaultPromtoolConfig("checkout")
+
+	t.Run("expects the alert around the detection time", func(t *testing.T) {
+		scenario, _ := NewScenario(alert, 0.05) // detects after 24m
+		var buf bytes.Buffer
+		if err := WriteScenarioPromtoolTest(&buf, scenario, config); err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		test := buf.String()
+		if !strings.Contains(test, "rule_files:\n  - rules.yml\n") || !strings.Contains(test, "values: '0 100+100x59 6100+100x61'") {
+			t.Errorf("Unexpected test header or series:\n%s", test)
+		}
+		if !strings.Contains(test, "- eval_time: 82m\n        alertname: SLOBurnRate\n        exp_alerts: []\n") {
+			t.Errorf("Expected no alert 2 intervals before detection:\n%s", test)
+		}
+		if !strings.Contains(test, "- eval_time: 86m\n        alertname: SLOBurnRate\n        exp_alerts:\n          - exp_labels:\n              burn_rate: \"2\"\n              service: \"checkout\"\n              window: \"1h\"\n") {
+			t.Errorf("Expected the alert 2 intervals after detection:\n%s", test)
+		}
+	})
+
+	t.Run("expects no alert when the scenario doesn't fire", func(t *testing.T) {
+		scenario, _ := NewScenario(alert, 0.01)
+		var buf bytes.Buffer
+		WriteScenarioPromtoolTest(&buf, scenario, config)
+		if strings.Count(buf.String(), "exp_alerts: []") != 1 || strings.Contains(buf.String(), "exp_labels") {
+			t.Errorf("Unexpected test:\n%s", buf.String())
+		}
+	})
+
+	t.Run("rejects intervals that don't divide the windows", func(t *testing.T) {
+		scenario, _ := NewScenario(alert, 0.05)
+		config := config
+		config.Interval = 7 * time.Minute
+		if err := WriteScenarioPromtoolTest(&bytes.Buffer{}, scenario, config); err != ErrInvalidPromtoolInterval {
+			t.Errorf("Expected ErrInvalidPromtoolInterval but got %v", err)
+		}
+	})
+}
+
+func TestWritingTimelinePromtoolTest(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.99, 1*time.Hour, 2.0)
+	timeline := []ErrorPhase{{2 * time.Hour, 0}, {time.Hour, 0.05}, {2 * time.Hour, 0}}
+	var buf bytes.Buffer
+	if err := WritePromtoolTest(&buf, []*SLOAlert{alert}, timeline, DefaultPromtoolConfig("checkout")); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	test := buf.String()
+	// same transitions as in TestBacktest: firing at 2h25m, resolved at 3h36m
+	for _, evalTime := range []string{"143m", "147m", "214m", "218m", "5h"} {
+		if !strings.Contains(test, "- eval_time: "+evalTime+"\n") {
+			t.Errorf("Expected an evaluation at %s:\n%s", evalTime, test)
+		}
+	}
+	if strings.Count(test, "exp_labels") != 2 {
+		t.Errorf("Expected the alert to be firing in exactly 2 evaluations:\n%s", test)
+	}
+
+	if err := WritePromtoolTest(&bytes.Buffer{}, []*SLOAlert{alert}, nil, DefaultPromtoolConfig("checkout")); err != ErrEmptyTimeline {
+		t.Errorf("Expected ErrEmptyTimeline but got %v", err)
+	}
+}
+
+func TestPromtoolCommand(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules.yml")
+	tests := filepath.Join(dir, "tests.yml")
+	var buf bytes.Buffer
+	err := runCommand(&buf, "promtool", []string{"-slo", "0.99", "-window", "1h", "-burn-rate", "2", "-error-rate", "0.05", "-rules-out", rules, "-out", tests})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	for _, path := range []string{rules, tests} {
+		if data, err := os.ReadFile(path); err != nil || len(data) == 0 {
+			t.Errorf("Expected %s to be written: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var ErrMissingSeriesColumns = errors.New("series csv must start with the columns timestamp,good,total")
+var ErrGoodAboveTotal = errors.New("good events cannot exceed total events")
+var ErrNegativeEvents = errors.New("good and total events cannot be negative")
+
+// A Sample holds the number of good and total events observed in the interval that ends at Time.
+// Labels are optional and identify e.g. the tenant or customer tier that the events belong to.
+type Sample struct {
+	Time   time.Time
+	Good   float64
+	Total  float64
+	Labels map[string]string
+}
+
+// A Series is a list of samples, ordered by time
+type Series []Sample
+
+// Sums up the good and total events of the samples in the (from, to] interval
+func (s Series) Window(from, to time.Time) (good, total float64) {
+	start := sort.Search(len(s), func(i int) bool { return s[i].Time.After(from) })
+	for i := start; i < len(s) && !s[i].Time.After(to); i++ {
+		good += s[i].Good
+		total += s[i].Total
+	}
+	return good, total
+}
+
+// The ratio of bad to total events in the (from, to] interval, 0 if there were no events
+func (s Series) ErrorRate(from, to time.Time) float64 {
+	return errorRate(s, from, to)
+}
+
+// The fraction of the error budget consumed by the events in the SLO window ending at `at`
+func (s Series) BudgetConsumed(slo float64, at time.Time) float64 {
+	return budgetConsumed(s, slo, at)
+}
+
+// The time of the last sample, or the zero time for an empty series
+func (s Series) End() time.Time {
+	if len(s) == 0 {
+		return time.Time{}
+	}
+	return s[len(s)-1].Time
+}
+
+// A source of good and total event counts over time, such as a recorded Series or a live Evaluator
+type EventCounter interface {
+	// Sums up the good and total events in the (from, to] interval
+	Window(from, to time.Time) (good, total float64)
+}
+
+func errorRate(c EventCounter, from, to time.Time) float64 {
+	good, total := c.Window(from, to)
+	if total == 0 {
+		return 0
+	}
+	return (total - good) / total
+}
+
+func budgetConsumed(c EventCounter, slo float64, at time.Time) float64 {
+	good, total := c.Window(at.Add(-SLOWindowSize), at)
+	if total == 0 {
+		return 0
+	}
+	errorBudget := (1.0 - slo) * total
+	if errorBudget == 0 {
+		if good < total {
+			return 1
+		}
+		return 0
+	}
+	return (total - good) / errorBudget
+}
+
+// The burn rate observed over the alert window ending at `at`, i.e. the error rate relative to the error budget
+func (a *SLOAlert) ObservedBurnRate(c EventCounter, at time.Time) float64 {
+	rate := errorRate(c, at.Add(-a.AlertWindowSize), at)
+	errorBudgetPercentage := 1.0 - a.SLO
+	if errorBudgetPercentage == 0 {
+		if rate > 0 {
+			return MaxBurnRate
+		}
+		return 0
+	}
+	return rate / errorBudgetPercentage
+}
+
+// Whether the alert condition holds for the alert window ending at `at` (same condition as Scenario.Check)
+func (a *SLOAlert) Firing(c EventCounter, at time.Time) bool {
+	rate := errorRate(c, at.Add(-a.AlertWindowSize), at)
+	return rate > a.BurnRate*(1.0-a.SLO)
+}
+
+// Reads a series from csv with the header timestamp,good,total followed by any number of label columns.
+// Timestamps are either RFC3339 or unix seconds. Samples are sorted by time.
+func ReadSeriesCSV(r io.Reader) (Series, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(header) < 3 || header[0] != "timestamp" || header[1] != "good" || header[2] != "total" {
+		return nil, ErrMissingSeriesColumns
+	}
+	labelNames := header[3:]
+
+	var series Series
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) != len(header) {
+			return nil, fmt.Errorf("line %d: expected %d columns but got %d", line, len(header), len(record))
+		}
+		sample, err := parseSample(record, labelNames)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		series = append(series, sample)
+	}
+	sort.SliceStable(series, func(i, j int) bool { return series[i].Time.Before(series[j].Time) })
+	return series, nil
+}
+
+func parseSample(record []string, labelNames []string) (Sample, error) {
+	t, err := parseTimestamp(record[0])
+	if err != nil {
+		return Sample{}, err
+	}
+	good, err := strconv.ParseFloat(record[1], 64)
+	if err != nil {
+		return Sample{}, err
+	}
+	total, err := strconv.ParseFloat(record[2], 64)
+	if err != nil {
+		return Sample{}, err
+	}
+	if good < 0 || total < 0 {
+		return Sample{}, ErrNegativeEvents
+	}
+	if good > total {
+		return Sample{}, ErrGoodAboveTotal
+	}
+	sample := Sample{Time: t, Good: good, Total: total}
+	if len(labelNames) > 0 {
+		sample.Labels = make(map[string]string, len(labelNames))
+		for i, name := range labelNames {
+			sample.Labels[name] = record[3+i]
+		}
+	}
+	return sample, nil
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// Writes the series in the format understood by ReadSeriesCSV, with one column per label name given
+func WriteSeriesCSV(w io.Writer, s Series, labelNames ...string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"timestamp", "good", "total"}, labelNames...)); err != nil {
+		return err
+	}
+	for _, sample := range s {
+		record := []string{
+			sample.Time.UTC().Format(time.RFC3339),
+			strconv.FormatFloat(sample.Good, 'g', -1, 64),
+			strconv.FormatFloat(sample.Total, 'g', -1, 64),
+		}
+		for _, name := range labelNames {
+			record = append(record, sample.Labels[name])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var seriesStart = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// One sample per minute with the given error rate, starting one minute after seriesStart
+func constantSeries(minutes int, total, errorRate float64) Series {
+	series := make(Series, minutes)
+	for i := range series {
+		series[i] = Sample{Time: seriesStart.Add(time.Duration(i+1) * time.Minute), Good: total * (1 - errorRate), Total: total}
+	}
+	return series
+}
+
+func TestSeriesWindow(t *testing.T) {
+	series := constantSeries(60, 100, 0.1)
+	good, total := series.Window(seriesStart, seriesStart.Add(10*time.Minute))
+	if good != 900 || total != 1000 {
+		t.Errorf("Expected 900 good and 1000 total events in the first 10 minutes but got %f and %f", good, total)
+	}
+	good, total = series.Window(seriesStart.Add(59*time.Minute), seriesStart.Add(2*time.Hour))
+	if good != 90 || total != 100 {
+		t.Errorf("Expected only the last sample in the window but got %f good and %f total", good, total)
+	}
+	if rate := series.ErrorRate(seriesStart.Add(-time.Hour), seriesStart); rate != 0 {
+		t.Errorf("Expected 0 error rate for window without events but got %f", rate)
+	}
+	if rate := series.ErrorRate(seriesStart, series.End()); math.Abs(rate-0.1) > 1e-9 {
+		t.Errorf("Expected error rate of 0.1 but got %f", rate)
+	}
+}
+
+func TestSeriesAlertEvaluation(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.99, 1*time.Hour, 2.0)
+	healthy := constantSeries(60, 100, 0.01)
+	failing := constantSeries(60, 100, 0.03)
+
+	if burnRate := alert.ObservedBurnRate(healthy, healthy.End()); math.Abs(burnRate-1.0) > 1e-9 {
+		t.Errorf("Expected observed burn rate 1 but got %f", burnRate)
+	}
+	if alert.Firing(healthy, healthy.End()) {
+		t.Errorf("Alert fired when it should not have (error rate: 1%%)")
+	}
+	if !alert.Firing(failing, failing.End()) {
+		t.Errorf("Alert failed to fire when it should have (error rate: 3%%)")
+	}
+	if budget := failing.BudgetConsumed(0.99, failing.End()); math.Abs(budget-3.0) > 1e-9 {
+		t.Errorf("Expected 3x the error budget consumed but got %f", budget)
+	}
+}
+
+func TestReadingAndWritingSeriesCSV(t *testing.T) {
+	input := "timestamp,good,total,tenant\n" +
+		"2023-01-01T00:02:00Z,9,10,acme\n" +
+		"1672531260,5,5,globex\n"
+	series, err := ReadSeriesCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	expected := Series{
+		{Time: seriesStart.Add(time.Minute), Good: 5, Total: 5, Labels: map[string]string{"tenant": "globex"}},
+		{Time: seriesStart.Add(2 * time.Minute), Good: 9, Total: 10, Labels: map[string]string{"tenant": "acme"}},
+	}
+	if !reflect.DeepEqual(series, expected) {
+		t.Errorf("Got unexpected series %+v", series)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSeriesCSV(&buf, series, "tenant"); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	roundTripped, err := ReadSeriesCSV(&buf)
+	if err != nil || !reflect.DeepEqual(roundTripped, expected) {
+		t.Errorf("Series did not survive a round trip: %+v (%v)", roundTripped, err)
+	}
+
+	badInputs := []string{
+		"time,good,total\n",
+		"timestamp,good,total\nyesterday,1,1\n",
+		"timestamp,good,total\n1672531260,2,1\n",
+		"timestamp,good,total\n1672531260,1\n",
+		"timestamp,good,total\n1672531260,-1,0\n",
+		"timestamp,good,total\n1672531260,0,-1\n",
+	}
+	for _, input := range badInputs {
+		if _, err := ReadSeriesCSV(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected error reading %q", input)
+		}
+	}
+}
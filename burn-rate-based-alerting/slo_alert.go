@@ -39,12 +39,17 @@ type Scenario struct {
 }
 
 func NewSLOAlertFromBurnRate(slo float64, alertWindowSize time.Duration, burnRate float64) (*SLOAlert, error) {
+	return NewSLOAlertForPeriod(slo, alertWindowSize, burnRate, SLOWindowSize)
+}
+
+// Like NewSLOAlertFromBurnRate, with the consumed error budget relative to an SLO period other than SLOWindowSize
+func NewSLOAlertForPeriod(slo float64, alertWindowSize time.Duration, burnRate float64, period time.Duration) (*SLOAlert, error) {
 	err := verifyAlertConfiguration(slo, alertWindowSize, burnRate)
 	if err != nil {
 		return nil, err
 	}
 
-	percentErrorBudgetConsumed := burnRate * float64(alertWindowSize) / float64(SLOWindowSize)
+	percentErrorBudgetConsumed := burnRate * float64(alertWindowSize) / float64(period)
 	return &SLOAlert{
 		SLO:                        slo,
 		AlertWindowSize:            alertWindowSize,
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrEmptySweepDimension = errors.New("every sweep dimension needs at least one value")
+var ErrInvalidSweepRange = errors.New("ranges must be a comma separated list or have the form min:max:step with step > 0 and min <= max")
+var ErrNonFiniteValue = errors.New("values must be finite numbers")
+
+// A sweep runs the SLOAlert/Scenario math over every combination of the configured values,
+// to show how sensitive the detection time is to each parameter
+type SweepConfig struct {
+	SLOs             []float64
+	AlertWindowSizes []time.Duration
+	BurnRates        []float64
+	ErrorRates       []float64
+	Workers          int // defaults to the number of CPUs when not set
+}
+
+// The outcome of a single point in the sweep grid.
+// Combinations which don't form a valid alert or scenario are kept, with Error set.
+type SweepResult struct {
+	SLO             float64
+	AlertWindowSize time.Duration
+	BurnRate        float64
+	ErrorRate       float64
+	Fires           bool
+	DetectionTime   time.Duration
+	Error           error
+}
+
+type sweepPoint struct {
+	idx             int
+	slo             float64
+	alertWindowSize time.Duration
+	burnRate        float64
+	errorRate       float64
+}
+
+func RunSweep(config SweepConfig) ([]SweepResult, error) {
+	if len(config.SLOs) == 0 || len(config.AlertWindowSizes) == 0 || len(config.BurnRates) == 0 || len(config.ErrorRates) == 0 {
+		return nil, ErrEmptySweepDimension
+	}
+	workers := config.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	size := len(config.SLOs) * len(config.AlertWindowSizes) * len(config.BurnRates) * len(config.ErrorRates)
+	results := make([]SweepResult, size)
+	points := make(chan sweepPoint)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range points {
+				results[p.idx] = evaluateSweepPoint(p)
+			}
+		}()
+	}
+
+	idx := 0
+	for _, slo := range config.SLOs {
+		for _, alertWindowSize := range config.AlertWindowSizes {
+			for _, burnRate := range config.BurnRates {
+				for _, errorRate := range config.ErrorRates {
+					points <- sweepPoint{idx: idx, slo: slo, alertWindowSize: alertWindowSize, burnRate: burnRate, errorRate: errorRate}
+					idx++
+				}
+			}
+		}
+	}
+	close(points)
+	wg.Wait()
+	return results, nil
+}
+
+func evaluateSweepPoint(p sweepPoint) SweepResult {
+	result := SweepResult{SLO: p.slo, AlertWindowSize: p.alertWindowSize, BurnRate: p.burnRate, ErrorRate: p.errorRate, DetectionTime: -1}
+	alert, err := NewSLOAlertFromBurnRate(p.slo, p.alertWindowSize, p.burnRate)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	scenario, err := NewScenario(alert, p.errorRate)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	result.Fires = scenario.Check()
+	result.DetectionTime = scenario.DetectionTime()
+	return result
+}
+
+var sweepCSVHeader = []string{"slo", "alert_window_size", "burn_rate", "error_rate", "fires", "detection_time", "error"}
+
+func WriteSweepCSV(w io.Writer, results []SweepResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(sweepCSVHeader); err != nil {
+		return err
+	}
+	for _, r := range results {
+		record := []string{
+			strconv.FormatFloat(r.SLO, 'g', -1, 64),
+			r.AlertWindowSize.String(),
+			strconv.FormatFloat(r.BurnRate, 'g', -1, 64),
+			strconv.FormatFloat(r.ErrorRate, 'g', -1, 64),
+			strconv.FormatBool(r.Fires),
+			"",
+			"",
+		}
+		if r.DetectionTime >= 0 {
+			record[5] = r.DetectionTime.String()
+		}
+		if r.Error != nil {
+			record[6] = r.Error.Error()
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type sweepResultDto struct {
+	SLO             float64 `json:"slo"`
+	AlertWindowSize string  `json:"alertWindowSize"`
+	BurnRate        float64 `json:"burnRate"`
+	ErrorRate       float64 `json:"errorRate"`
+	Fires           bool    `json:"fires"`
+	DetectionTime   string  `json:"detectionTime,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+func WriteSweepJSON(w io.Writer, results []SweepResult) error {
+	dtos := make([]sweepResultDto, 0, len(results))
+	for _, r := range results {
+		dto := sweepResultDto{
+			SLO:             r.SLO,
+			AlertWindowSize: r.AlertWindowSize.String(),
+			BurnRate:        r.BurnRate,
+			ErrorRate:       r.ErrorRate,
+			Fires:           r.Fires,
+		}
+		if r.DetectionTime >= 0 {
+			dto.DetectionTime = r.DetectionTime.String()
+		}
+		if r.Error != nil {
+			dto.Error = r.Error.Error()
+		}
+		dtos = append(dtos, dto)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dtos)
+}
+
+const (
+	heatmapCellWidth   = 48
+	heatmapCellHeight  = 24
+	heatmapLabelWidth  = 80
+	heatmapTitleHeight = 40
+)
+
+// Renders one heatmap panel per (AlertWindowSize, BurnRate) pair with SLOs as rows and error rates as columns.
+// Cells are coloured by detection time relative to the alert window, from green (fast) to red (slow).
+// Grey cells never fire and white cells are invalid configurations.
+func WriteSweepHeatmapSVG(w io.Writer, results []SweepResult) error {
+	type panelKey struct {
+		alertWindowSize time.Duration
+		burnRate        float64
+	}
+	var panels []panelKey
+	var slos, errorRates []float64
+	cells := make(map[panelKey]map[[2]float64]SweepResult)
+	for _, r := range results {
+		key := panelKey{r.AlertWindowSize, r.BurnRate}
+		if _, ok := cells[key]; !ok {
+			panels = append(panels, key)
+			cells[key] = make(map[[2]float64]SweepResult)
+		}
+		cells[key][[2]float64{r.SLO, r.ErrorRate}] = r
+		slos = appendUnique(slos, r.SLO)
+		errorRates = appendUnique(errorRates, r.ErrorRate)
+	}
+
+	panelHeight := heatmapTitleHeight + (len(slos)+1)*heatmapCellHeight
+	width := heatmapLabelWidth + len(errorRates)*heatmapCellWidth
+	height := len(panels) * panelHeight
+	if _, err := fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"10\">\n", width, height); err != nil {
+		return err
+	}
+	for p, key := range panels {
+		top := p * panelHeight
+		fmt.Fprintf(w, "<text x=\"4\" y=\"%d\" font-size=\"12\">window=%s burnRate=%g</text>\n", top+heatmapTitleHeight/2, key.alertWindowSize, key.burnRate)
+		for col, errorRate := range errorRates {
+			x := heatmapLabelWidth + col*heatmapCellWidth
+			fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\">%g</text>\n", x+2, top+heatmapTitleHeight-4, errorRate)
+		}
+		for row, slo := range slos {
+			y := top + heatmapTitleHeight + row*heatmapCellHeight
+			fmt.Fprintf(w, "<text x=\"4\" y=\"%d\">%g</text>\n", y+heatmapCellHeight/2+4, slo)
+			for col, errorRate := range errorRates {
+				x := heatmapLabelWidth + col*heatmapCellWidth
+				r, ok := cells[key][[2]float64{slo, errorRate}]
+				fill, label := heatmapCell(r, ok)
+				fmt.Fprintf(w, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"#ffffff\"/>\n", x, y, heatmapCellWidth, heatmapCellHeight, fill)
+				if label != "" {
+					fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\">%s</text>\n", x+2, y+heatmapCellHeight/2+4, label)
+				}
+			}
+		}
+	}
+	_, err := fmt.Fprintln(w, "</svg>")
+	return err
+}
+
+func heatmapCell(r SweepResult, ok bool) (fill string, label string) {
+	if !ok || r.Error != nil {
+		return "#ffffff", ""
+	}
+	if !r.Fires {
+		return "#bbbbbb", ""
+	}
+	ratio := math.Min(float64(r.DetectionTime)/float64(r.AlertWindowSize), 1.0)
+	red := int(255 * ratio)
+	green := int(255 * (1 - ratio))
+	return fmt.Sprintf("#%02x%02x40", red, green), shortDuration(r.DetectionTime)
+}
+
+func shortDuration(d time.Duration) string {
+	if d >= time.Hour {
+		return fmt.Sprintf("%.1fh", d.Hours())
+	}
+	if d >= time.Minute {
+		return fmt.Sprintf("%.1fm", d.Minutes())
+	}
+	return fmt.Sprintf("%.0fs", d.Seconds())
+}
+
+func appendUnique(values []float64, v float64) []float64 {
+	for _, existing := range values {
+		if existing == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
+
+// Parses either a comma separated list of values ("0.99,0.999") or an inclusive range ("0.99:0.999:0.001")
+func ParseFloatRange(s string) ([]float64, error) {
+	if !strings.Contains(s, ":") {
+		var values []float64
+		for _, part := range strings.Split(s, ",") {
+			v, err := parseFiniteFloat(part)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, ErrInvalidSweepRange
+	}
+	var bounds [3]float64
+	for i, part := range parts {
+		v, err := parseFiniteFloat(part)
+		if err != nil {
+			return nil, err
+		}
+		bounds[i] = v
+	}
+	from, to, step := bounds[0], bounds[1], bounds[2]
+	if step <= 0 || from > to {
+		return nil, ErrInvalidSweepRange
+	}
+	steps := int(math.Round((to - from) / step))
+	values := make([]float64, 0, steps+1)
+	for i := 0; i <= steps; i++ {
+		// rounding keeps 0.99 + 9*0.001 from printing as 0.9990000000000001
+		values = append(values, math.Round((from+float64(i)*step)*1e12)/1e12)
+	}
+	return values, nil
+}
+
+// NaN would slip through every range check, as comparisons with it are false
+func parseFiniteFloat(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%w: %q", ErrNonFiniteValue, s)
+	}
+	return v, nil
+}
+
+// Parses either a comma separated list of durations ("30m,1h") or an inclusive range ("30m:6h:30m")
+func ParseDurationRange(s string) ([]time.Duration, error) {
+	if !strings.Contains(s, ":") {
+		var values []time.Duration
+		for _, part := range strings.Split(s, ",") {
+			v, err := time.ParseDuration(strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, ErrInvalidSweepRange
+	}
+	var bounds [3]time.Duration
+	for i, part := range parts {
+		v, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		bounds[i] = v
+	}
+	from, to, step := bounds[0], bounds[1], bounds[2]
+	if step <= 0 || from > to {
+		return nil, ErrInvalidSweepRange
+	}
+	var values []time.Duration
+	for v := from; v <= to; v += step {
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsingRanges(t *testing.T) {
+	floatTests := []struct {
+		input          string
+		expectedValues []float64
+		expectError    bool
+	}{
+		{"0.99", []float64{0.99}, false},
+		{"0.99, 0.999", []float64{0.99, 0.999}, false},
+		{"0.99:0.995:0.001", []float64{0.99, 0.991, 0.992, 0.993, 0.994, 0.995}, false},
+		{"1:2", nil, true},
+		{"2:1:0.5", nil, true},
+		{"1:2:0", nil, true},
+		{"abc", nil, true},
+		{"NaN", nil, true},
+		{"0.99,Inf", nil, true},
+		{"0.9:NaN:0.01", nil, true},
+	}
+	for _, test := range floatTests {
+		values, err := ParseFloatRange(test.input)
+		if (err != nil) != test.expectError {
+			t.Errorf("ParseFloatRange(%q) returned error: %v", test.input, err)
+		}
+		if !reflect.DeepEqual(values, test.expectedValues) {
+			t.Errorf("ParseFloatRange(%q) = %v, expected %v", test.input, values, test.expectedValues)
+		}
+	}
+
+	durationTests := []struct {
+		input          string
+		expectedValues []time.Duration
+		expectError    bool
+	}{
+		{"1h", []time.Duration{time.Hour}, false},
+		{"30m,6h", []time.Duration{30 * time.Minute, 6 * time.Hour}, false},
+		{"30m:2h:30m", []time.Duration{30 * time.Minute, time.Hour, 90 * time.Minute, 2 * time.Hour}, false},
+		{"2h:1h:30m", nil, true},
+		{"1h:2h:0s", nil, true},
+	}
+	for _, test := range durationTests {
+		values, err := ParseDurationRange(test.input)
+		if (err != nil) != test.expectError {
+			t.Errorf("ParseDurationRange(%q) returned error: %v", test.input, err)
+		}
+		if !reflect.DeepEqual(values, test.expectedValues) {
+			t.Errorf("ParseDurationRange(%q) = %v, expected %v", test.input, values, test.expectedValues)
+		}
+	}
+}
+
+func TestRunSweep(t *testing.T) {
+	t.Run("returns an error when a dimension is empty", func(t *testing.T) {
+		_, err := RunSweep(SweepConfig{SLOs: []float64{0.99}, AlertWindowSizes: []time.Duration{time.Hour}, BurnRates: []float64{2}})
+		if err != ErrEmptySweepDimension {
+			t.Errorf("Expected ErrEmptySweepDimension but got %v", err)
+		}
+	})
+
+	t.Run("evaluates every point of the grid in order", func(t *testing.T) {
+		config := SweepConfig{
+			SLOs:             []float64{0.99, 0.999},
+			AlertWindowSizes: []time.Duration{time.Hour, 6 * time.Hour},
+			BurnRates:        []float64{2, 200},
+			ErrorRates:       []float64{0.001, 0.5, 1.0},
+			Workers:          3,
+		}
+		results, err := RunSweep(config)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		if len(results) != 24 {
+			t.Fatalf("Expected 24 results but got %d", len(results))
+		}
+		for _, r := range results {
+			if r.BurnRate == 200 {
+				if r.Error != ErrBurnRateOutOfRange {
+					t.Errorf("Expected ErrBurnRateOutOfRange for burn rate 200 but got %v", r.Error)
+				}
+				continue
+			}
+			alert, _ := NewSLOAlertFromBurnRate(r.SLO, r.AlertWindowSize, r.BurnRate)
+			scenario, _ := NewScenario(alert, r.ErrorRate)
+			if r.Fires != scenario.Check() || r.DetectionTime != scenario.DetectionTime() {
+				t.Errorf("Sweep result %+v does not match scenario", r)
+			}
+		}
+		first := results[0]
+		if first.SLO != 0.99 || first.AlertWindowSize != time.Hour || first.BurnRate != 2 || first.ErrorRate != 0.001 {
+			t.Errorf("Results are not in grid order, first result was %+v", first)
+		}
+		if results[2].DetectionTime != 1*time.Minute+12*time.Second {
+			t.Errorf("Expected detection time of 1m12s for a total outage but got %s", results[2].DetectionTime)
+		}
+	})
+}
+
+func TestWritingSweepResults(t *testing.T) {
+	results, _ := RunSweep(SweepConfig{
+		SLOs:             []float64{0.99},
+		AlertWindowSizes: []time.Duration{time.Hour},
+		BurnRates:        []float64{2, 101},
+		ErrorRates:       []float64{0.01, 1.0},
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteSweepCSV(&buf, results); err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to read csv output: %v", err)
+		}
+		if len(records) != 5 || !reflect.DeepEqual(records[0], sweepCSVHeader) {
+			t.Fatalf("Unexpected csv output: %v", records)
+		}
+		if records[1][4] != "false" || records[1][5] != "" {
+			t.Errorf("Expected non-firing row without detection time but got %v", records[1])
+		}
+		if records[2][5] != "1m12s" {
+			t.Errorf("Expected detection time 1m12s but got %v", records[2])
+		}
+		if records[3][6] != ErrBurnRateOutOfRange.Error() {
+			t.Errorf("Expected error column to be set but got %v", records[3])
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteSweepJSON(&buf, results); err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		var decoded []map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("Failed to decode json output: %v", err)
+		}
+		if len(decoded) != 4 || decoded[1]["detectionTime"] != "1m12s" || decoded[1]["alertWindowSize"] != "1h0m0s" {
+			t.Errorf("Unexpected json output: %v", decoded)
+		}
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteSweepHeatmapSVG(&buf, results); err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		svg := buf.String()
+		if !strings.HasPrefix(svg, "<svg") || strings.Count(svg, "window=1h0m0s") != 2 || !strings.Contains(svg, "1.2m") {
+			t.Errorf("Unexpected svg output: %s", svg)
+		}
+	})
+}
+
+func TestSweepCommand(t *testing.T) {
+	var buf bytes.Buffer
+	err := runCommand(&buf, "sweep", []string{"-slo", "0.99", "-window", "1h", "-burn-rate", "2", "-error-rate", "1", "-format", "json"})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\"detectionTime\": \"1m12s\"") {
+		t.Errorf("Unexpected command output: %s", buf.String())
+	}
+	if err := runCommand(&buf, "sweep", []string{"-format", "xml"}); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+	if err := runCommand(&buf, "nope", nil); err == nil {
+		t.Errorf("Expected error for unknown command")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The label set that the long tail of tenants is rolled up into
+const OtherLabelSet = "other"
+
+var ErrNoSplitLabels = errors.New("at least one label name is needed to split a series")
+var ErrMaxLabelSetsOutOfRange = errors.New("maxLabelSets must be at least 1")
+
+// Splits a series into one series per distinct combination of the given label values.
+// The cap on label sets is enforced while the samples are ingested: at most maxLabelSets label sets are tracked at
+// any time, ranked by their total events in the SLO window that ends with the series (older samples are dropped, as
+// no alert or budget looks at them). Samples of label sets that aren't tracked go to the OtherLabelSet series,
+// and so do the samples of a label set that loses its place to a busier one.
+func SplitSeriesByLabels(s Series, labelNames []string, maxLabelSets int) (map[string]Series, error) {
+	if len(labelNames) == 0 {
+		return nil, ErrNoSplitLabels
+	}
+	if maxLabelSets < 1 {
+		return nil, ErrMaxLabelSetsOutOfRange
+	}
+
+	oldest := s.End().Add(-SLOWindowSize)
+	tracker := newLabelSetTracker(maxLabelSets)
+	split := make(map[string]Series)
+	for _, sample := range s {
+		if sample.Good < 0 || sample.Total < 0 {
+			return nil, ErrNegativeEvents
+		}
+		if !sample.Time.After(oldest) {
+			continue
+		}
+		key := labelSetKey(sample.Labels, labelNames)
+		tracked, evicted := tracker.add(key, sample.Total)
+		for _, e := range evicted {
+			split[OtherLabelSet] = append(split[OtherLabelSet], split[e]...)
+			delete(split, e)
+		}
+		if !tracked {
+			key = OtherLabelSet
+		}
+		split[key] = append(split[key], sample)
+	}
+	other := split[OtherLabelSet]
+	sort.SliceStable(other, func(i, j int) bool { return other[i].Time.Before(other[j].Time) })
+	return split, nil
+}
+
+// Decides which label sets are tracked with the Misra-Gries heavy hitters algorithm, weighted by total events.
+// Once every place is taken, the events of an untracked label set wear down the counts of the tracked ones
+// instead of being counted, and a tracked label set whose count runs out makes room for the next new one.
+// Any label set with more than 1/(max+1) of all the events ends up tracked.
+type labelSetTracker struct {
+	max    int
+	counts map[string]float64
+}
+
+func newLabelSetTracker(max int) *labelSetTracker {
+	return &labelSetTracker{max: max, counts: make(map[string]float64, max)}
+}
+
+// Counts the events of a label set and returns whether it is tracked, along with the label sets that lost their place
+func (t *labelSetTracker) add(key string, total float64) (tracked bool, evicted []string) {
+	if _, ok := t.counts[key]; ok {
+		t.counts[key] += total
+		return true, nil
+	}
+	if len(t.counts) < t.max {
+		t.counts[key] = total
+		return true, nil
+	}
+	worn := total
+	for _, count := range t.counts {
+		worn = math.Min(worn, count)
+	}
+	for k := range t.counts {
+		t.counts[k] -= worn
+		if t.counts[k] <= 0 {
+			delete(t.counts, k)
+			evicted = append(evicted, k)
+		}
+	}
+	sort.Strings(evicted)
+	if total -= worn; total > 0 {
+		t.counts[key] = total // worn down the least tracked label set, so there is room
+		return true, evicted
+	}
+	return false, evicted
+}
+
+func labelSetKey(labels map[string]string, labelNames []string) string {
+	parts := make([]string, len(labelNames))
+	for i, name := range labelNames {
+		parts[i] = name + "=" + labels[name]
+	}
+	return strings.Join(parts, ",")
+}
+
+// The state of one SLOAlert for one tenant (label set)
+type TenantBurn struct {
+	LabelSet       string
+	Alert          *SLOAlert
+	BurnRate       float64 // observed over the alert window
+	Firing         bool
+	BudgetConsumed float64 // over the SLO window
+}
+
+// Evaluates every alert for every tenant at the given time.
+// The result is ordered with the tenants burning their error budget fastest first.
+func EvaluateTenants(alerts []*SLOAlert, tenants map[string]Series, at time.Time) []TenantBurn {
+	var burns []TenantBurn
+	for labelSet, series := range tenants {
+		for _, alert := range alerts {
+			burns = append(burns, TenantBurn{
+				LabelSet:       labelSet,
+				Alert:          alert,
+				BurnRate:       alert.ObservedBurnRate(series, at),
+				Firing:         alert.Firing(series, at),
+				BudgetConsumed: series.BudgetConsumed(alert.SLO, at),
+			})
+		}
+	}
+	sort.Slice(burns, func(i, j int) bool {
+		if burns[i].BurnRate != burns[j].BurnRate {
+			return burns[i].BurnRate > burns[j].BurnRate
+		}
+		if burns[i].LabelSet != burns[j].LabelSet {
+			return burns[i].LabelSet < burns[j].LabelSet
+		}
+		return burns[i].Alert.AlertWindowSize < burns[j].Alert.AlertWindowSize
+	})
+	return burns
+}
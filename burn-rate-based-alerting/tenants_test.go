@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func labelled(s Series, labels map[string]string) Series {
+	for i := range s {
+		s[i].Labels = labels
+	}
+	return s
+}
+
+func TestSplittingSeriesByLabels(t *testing.T) {
+	var series Series
+	series = append(series, labelled(constantSeries(10, 100, 0), map[string]string{"tier": "gold", "customer": "acme"})...)
+	series = append(series, labelled(constantSeries(10, 50, 0), map[string]string{"tier": "gold", "customer": "globex"})...)
+	series = append(series, labelled(constantSeries(10, 5, 0), map[string]string{"tier": "free", "customer": "a"})...)
+	series = append(series, labelled(constantSeries(10, 1, 0), map[string]string{"tier": "free", "customer": "b"})...)
+
+	t.Run("rejects invalid parameters", func(t *testing.T) {
+		if _, err := SplitSeriesByLabels(series, nil, 1); err != ErrNoSplitLabels {
+			t.Errorf("Expected ErrNoSplitLabels but got %v", err)
+		}
+		if _, err := SplitSeriesByLabels(series, []string{"tier"}, 0); err != ErrMaxLabelSetsOutOfRange {
+			t.Errorf("Expected ErrMaxLabelSetsOutOfRange but got %v", err)
+		}
+		negative := Series{{Time: seriesStart, Good: 0, Total: -1}}
+		if _, err := SplitSeriesByLabels(negative, []string{"tier"}, 1); err != ErrNegativeEvents {
+			t.Errorf("Expected ErrNegativeEvents but got %v", err)
+		}
+	})
+
+	t.Run("splits by a single label", func(t *testing.T) {
+		split, _ := SplitSeriesByLabels(series, []string{"tier"}, 10)
+		if len(split) != 2 || len(split["tier=gold"]) != 20 || len(split["tier=free"]) != 20 {
+			t.Errorf("Unexpected split: %v", split)
+		}
+	})
+
+	t.Run("rolls up the long tail into the other bucket", func(t *testing.T) {
+		split, _ := SplitSeriesByLabels(series, []string{"tier", "customer"}, 2)
+		if len(split) != 3 {
+			t.Fatalf("Expected 2 tracked label sets plus other but got %d", len(split))
+		}
+		if len(split["tier=gold,customer=acme"]) != 10 || len(split["tier=gold,customer=globex"]) != 10 {
+			t.Errorf("Expected the largest customers to be tracked individually: %v", split)
+		}
+		if _, total := split[OtherLabelSet].Window(seriesStart, seriesStart.Add(time.Hour)); total != 60 {
+			t.Errorf("Expected 60 total events in the other bucket but got %f", total)
+		}
+	})
+
+	t.Run("a busier label set takes the place of one seen earlier", func(t *testing.T) {
+		var series Series
+		series = append(series, labelled(constantSeries(10, 1, 0), map[string]string{"customer": "early"})...)
+		series = append(series, labelled(constantSeries(10, 100, 0), map[string]string{"customer": "busy"})...)
+		split, _ := SplitSeriesByLabels(series, []string{"customer"}, 1)
+		if len(split) != 2 || len(split["customer=busy"]) != 10 || len(split[OtherLabelSet]) != 10 {
+			t.Errorf("Expected the busy customer to be tracked and the early one rolled up: %v", split)
+		}
+	})
+
+	t.Run("ranks by the events in the SLO window", func(t *testing.T) {
+		old := labelled(constantSeries(10, 1000, 0), map[string]string{"customer": "churned"})
+		recent := labelled(constantSeries(10, 1, 0), map[string]string{"customer": "current"})
+		for i := range recent {
+			recent[i].Time = recent[i].Time.Add(SLOWindowSize)
+		}
+		split, _ := SplitSeriesByLabels(append(old, recent...), []string{"customer"}, 1)
+		if len(split) != 1 || len(split["customer=current"]) != 10 {
+			t.Errorf("Expected only the customer with events in the SLO window to be tracked: %v", split)
+		}
+	})
+}
+
+func TestLabelSetTrackerIsBounded(t *testing.T) {
+	tracker := newLabelSetTracker(3)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("customer=%d", i%50)
+		if i%2 == 0 {
+			key = "customer=heavy"
+		}
+		tracker.add(key, 1)
+		if len(tracker.counts) > 3 {
+			t.Fatalf("Expected at most 3 tracked label sets but got %d", len(tracker.counts))
+		}
+	}
+	if _, ok := tracker.counts["customer=heavy"]; !ok {
+		t.Errorf("Expected the label set with half of the events to be tracked: %v", tracker.counts)
+	}
+}
+
+func TestEvaluatingTenants(t *testing.T) {
+	alert, _ := NewSLOAlertFromBurnRate(0.99, 1*time.Hour, 2.0)
+	tenants := map[string]Series{
+		"tenant=healthy": constantSeries(60, 100, 0.001),
+		"tenant=burning": constantSeries(60, 100, 0.05),
+		"tenant=warm":    constantSeries(60, 100, 0.015),
+	}
+	burns := EvaluateTenants([]*SLOAlert{alert}, tenants, seriesStart.Add(time.Hour))
+	if len(burns) != 3 {
+		t.Fatalf("Expected 3 results but got %d", len(burns))
+	}
+	order := []string{burns[0].LabelSet, burns[1].LabelSet, burns[2].LabelSet}
+	if strings.Join(order, " ") != "tenant=burning tenant=warm tenant=healthy" {
+		t.Errorf("Tenants not ranked by burn rate: %v", order)
+	}
+	if !burns[0].Firing || burns[1].Firing || burns[2].Firing {
+		t.Errorf("Only the burning tenant should be firing: %+v", burns)
+	}
+}
+
+func TestTenantsCommand(t *testing.T) {
+	var series Series
+	series = append(series, labelled(constantSeries(60, 100, 0.05), map[string]string{"tenant": "acme"})...)
+	series = append(series, labelled(constantSeries(60, 100, 0), map[string]string{"tenant": "globex"})...)
+	path := filepath.Join(t.TempDir(), "series.csv")
+	var csvBuf bytes.Buffer
+	WriteSeriesCSV(&csvBuf, series, "tenant")
+	os.WriteFile(path, csvBuf.Bytes(), 0644)
+
+	var buf bytes.Buffer
+	err := runCommand(&buf, "tenants", []string{"-series", path, "-slo", "0.99", "-window", "1h", "-burn-rate", "2"})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "tenant=acme") || !strings.Contains(lines[1], "true") {
+		t.Errorf("Unexpected command output:\n%s", buf.String())
+	}
+}
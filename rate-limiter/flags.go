@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit"
+	"github.com/VladMinzatu/go-projects/rate-limiter/traffic"
+)
+
+// The parameters of the token bucket limiter. Tuning flags left at 0 keep the package defaults.
+type limiterFlags struct {
+	maxRpm          int
+	rampUpMinutes   int
+	refillInterval  time.Duration
+	scaleUp         float64
+	scaleDown       float64
+	initialCapacity float64
+	minCapacity     int
+}
+
+func addLimiterFlags(fs *flag.FlagSet) *limiterFlags {
+	f := &limiterFlags{}
+	fs.IntVar(&f.maxRpm, "max-rpm", 100, "peak requests per minute of the limiter")
+	fs.IntVar(&f.rampUpMinutes, "ramp-up-minutes", 5, "minutes to ramp up to the max rpm over")
+	fs.DurationVar(&f.refillInterval, "refill-interval", 0, "how often the capacity is scaled up or down (10s when 0)")
+	fs.Float64Var(&f.scaleUp, "scale-up", 0, "scale up below this share of the capacity left (0.4 when 0)")
+	fs.Float64Var(&f.scaleDown, "scale-down", 0, "scale down above this share of the capacity left (0.9 when 0)")
+	fs.Float64Var(&f.initialCapacity, "initial-capacity", 0, "share of the max rpm to start off with (0.1 when 0)")
+	fs.IntVar(&f.minCapacity, "min-capacity", 0, "never scale down below this rpm (1 when 0)")
+	return f
+}
+
+func (f *limiterFlags) options() []ratelimit.Option {
+	var opts []ratelimit.Option
+	if f.refillInterval != 0 {
+		opts = append(opts, ratelimit.WithRefillInterval(f.refillInterval))
+	}
+	if f.scaleUp != 0 {
+		opts = append(opts, ratelimit.WithScaleUpThreshold(f.scaleUp))
+	}
+	if f.scaleDown != 0 {
+		opts = append(opts, ratelimit.WithScaleDownThreshold(f.scaleDown))
+	}
+	if f.initialCapacity != 0 {
+		opts = append(opts, ratelimit.WithInitialCapacityPercentage(f.initialCapacity))
+	}
+	if f.minCapacity != 0 {
+		opts = append(opts, ratelimit.WithMinCapacity(f.minCapacity))
+	}
+	return opts
+}
+
+// The traffic pattern and its parameters. The defaults alternate between 10 minutes of 90 rpm and 10 quiet minutes.
+type patternFlags struct {
+	pattern    string
+	rpm        float64
+	rates      string
+	every      time.Duration
+	repeat     bool
+	amplitude  float64
+	period     time.Duration
+	burstSize  int
+	burstEvery time.Duration
+	replay     string
+	seed       int64
+}
+
+func addPatternFlags(fs *flag.FlagSet) *patternFlags {
+	f := &patternFlags{}
+	fs.StringVar(&f.pattern, "pattern", "step", "traffic pattern: constant, step, sinusoidal, poisson, bursty or replay")
+	fs.Float64Var(&f.rpm, "rpm", 90, "requests per minute of the constant and poisson patterns, and the mean of the sinusoidal one")
+	fs.StringVar(&f.rates, "rates", "90,0", "comma separated requests per minute of the step pattern")
+	fs.DurationVar(&f.every, "every", 10*time.Minute, "length of each step")
+	fs.BoolVar(&f.repeat, "repeat", true, "start the steps over after the last one instead of keeping its rate")
+	fs.Float64Var(&f.amplitude, "amplitude", 60, "how far the sinusoidal rate swings above and below -rpm")
+	fs.DurationVar(&f.period, "period", 10*time.Minute, "period of the sinusoidal pattern")
+	fs.IntVar(&f.burstSize, "burst-size", 50, "requests in each burst")
+	fs.DurationVar(&f.burstEvery, "burst-every", time.Minute, "time between bursts")
+	fs.StringVar(&f.replay, "replay", "", "CSV file of offset,requests rows to replay")
+	fs.Int64Var(&f.seed, "seed", 1, "seed of the poisson pattern")
+	return f
+}
+
+func (f *patternFlags) build() (traffic.Pattern, error) {
+	switch f.pattern {
+	case "constant":
+		return traffic.Constant(f.rpm)
+	case "step":
+		var rpms []float64
+		for _, field := range strings.Split(f.rates, ",") {
+			rpm, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rate %q in -rates", field)
+			}
+			rpms = append(rpms, rpm)
+		}
+		return traffic.Step(rpms, f.every, f.repeat)
+	case "sinusoidal":
+		return traffic.Sinusoidal(f.rpm, f.amplitude, f.period)
+	case "poisson":
+		return traffic.Poisson(f.rpm, rand.NewSource(f.seed))
+	case "bursty":
+		return traffic.Bursty(f.burstSize, f.burstEvery)
+	case "replay":
+		return traffic.LoadReplay(f.replay)
+	}
+	return nil, fmt.Errorf("unknown pattern %q", f.pattern)
+}
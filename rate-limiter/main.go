@@ -1,56 +1,70 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/VladMinzatu/go-projects/rate-limiter/middleware"
 	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit"
+	"github.com/VladMinzatu/go-projects/rate-limiter/traffic"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var (
-	requestsAcceptedCounter = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "requests_accepted",
-		Help: "Requests that the RateLimiter allowed to pass through",
-	})
-	requestsRejectedCounter = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "requests_rejected",
-		Help: "Requests that the RateLimiter blocked from passing through",
-	})
-)
-
-func makeRequestsAtConstantRpm(rpm int, rl *ratelimit.TokenBucketRateLimiter) {
-	go func() {
-		startTime := time.Now()
-		for {
-			if rl.Accept() {
-				requestsAcceptedCounter.Inc()
-			} else {
-				requestsRejectedCounter.Inc()
-			}
-			time.Sleep(time.Minute / time.Duration(rpm))
-			if time.Since(startTime) > 10*time.Minute {
-				time.Sleep(10 * time.Minute)
-				startTime = time.Now()
-			}
+// Serves the metrics of a limiter driven by a traffic pattern, or simulates it with "simulate"
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		if err := simulate(os.Args[2:]); errors.Is(err, flag.ErrHelp) {
+			return
+		} else if err != nil {
+			fmt.Printf("Error simulating: %s\n", err.Error())
+			os.Exit(1)
 		}
-	}()
-}
+		return
+	}
 
-func main() {
-	rl, err := ratelimit.NewTokenBucketRateLimiter(100, 5)
+	limiterParams := addLimiterFlags(flag.CommandLine)
+	patternParams := addPatternFlags(flag.CommandLine)
+	tick := flag.Duration("tick", 100*time.Millisecond, "how often the traffic generator sends the requests due")
+	policy := flag.String("policy", "", "JSON or YAML file with the maxRpm and rampUpMinutes, reloaded on change or SIGHUP")
+	flag.Parse()
+
+	pattern, err := patternParams.build()
+	if err != nil {
+		fmt.Printf("Error setting up the traffic pattern: %s\n", err.Error())
+		os.Exit(1)
+	}
+	metrics, err := ratelimit.NewMetrics(prometheus.DefaultRegisterer)
+	if err != nil {
+		fmt.Printf("Error registering rate limiter metrics: %s\n", err.Error())
+		os.Exit(1)
+	}
+	opts := append(limiterParams.options(), ratelimit.WithMetrics(metrics, "main"))
+	rl, err := ratelimit.NewTokenBucketRateLimiter(limiterParams.maxRpm, limiterParams.rampUpMinutes, opts...)
 	if err != nil {
 		fmt.Printf("Error initializing rate limiter: %s\n", err.Error())
 		os.Exit(1)
 	}
-	rl.Start()
+	if *policy != "" {
+		watcher, err := ratelimit.NewPolicyWatcher(*policy, rl, 5*time.Second)
+		if err != nil {
+			fmt.Printf("Error applying policy: %s\n", err.Error())
+			os.Exit(1)
+		}
+		go watcher.Run(context.Background())
+	}
 
-	go makeRequestsAtConstantRpm(90, rl)
+	go traffic.Run(context.Background(), pattern, *tick, func() { rl.Accept() })
 
+	limit := middleware.RateLimit(rl)
+	http.Handle("/", limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})))
 	http.Handle("/metrics", promhttp.Handler())
 	http.ListenAndServe(":2112", nil)
 }
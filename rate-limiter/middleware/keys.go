@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+)
+
+// A KeyFunc picks the key a request is rate limited by. Requests with an empty key share one limiter.
+type KeyFunc func(r *http.Request) string
+
+// Keys requests by the value of a header, e.g. "X-API-Key"
+func HeaderKey(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// Keys requests by the IP address of the client that sent them. Behind a proxy, the proxy's address is used,
+// so a HeaderKey on e.g. X-Real-IP set by the proxy is needed instead.
+func RemoteIPKey() KeyFunc {
+	return func(r *http.Request) string {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+}
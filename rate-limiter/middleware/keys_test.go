@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit"
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+)
+
+func TestHeaderKey(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-API-Key", "team-a")
+	if key := HeaderKey("X-API-Key")(r); key != "team-a" {
+		t.Errorf("Expected key team-a but got %q", key)
+	}
+	if key := HeaderKey("X-Tenant")(r); key != "" {
+		t.Errorf("Expected an empty key for a missing header but got %q", key)
+	}
+}
+
+func TestRemoteIPKey(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		key        string
+	}{
+		{"192.0.2.1:1234", "192.0.2.1"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"192.0.2.1", "192.0.2.1"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if key := RemoteIPKey()(r); key != test.key {
+			t.Errorf("Expected key %q for %q but got %q", test.key, test.remoteAddr, key)
+		}
+	}
+}
+
+func TestRateLimitByKey(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	keyed, err := ratelimit.NewKeyedRateLimiter(ratelimit.Template{MaxRpm: 1, Options: []ratelimit.Option{ratelimit.WithClock(clock)}}, 100, time.Hour)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	tenant := func(r *http.Request) string { return r.URL.Query().Get("tenant") }
+	h := RateLimitByKey(keyed, tenant)(ok)
+
+	tests := []struct {
+		tenant string
+		code   int
+	}{
+		{"a", http.StatusOK},
+		{"a", http.StatusTooManyRequests},
+		{"b", http.StatusOK},
+		{"", http.StatusOK},
+		{"", http.StatusTooManyRequests},
+	}
+	for i, test := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?tenant="+test.tenant, nil))
+		if rec.Code != test.code {
+			t.Errorf("Expected status %d for request %d of tenant %q but got %d", test.code, i+1, test.tenant, rec.Code)
+		}
+	}
+}
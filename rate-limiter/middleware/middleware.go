@@ -0,0 +1,168 @@
+/*
+HTTP middleware enforcing a rate limit on the requests to a handler.
+
+Rejected requests get a 429 response with a Retry-After header. All responses carry the RateLimit-Limit,
+RateLimit-Remaining and RateLimit-Reset headers of the IETF draft "RateLimit header fields for HTTP".
+
+Limiters of concurrent requests, like ratelimit.ConcurrencyLimiter, are released with the latency of the handler
+once it returns. A 503 or 504 response counts as dropped, telling the limiter that the backend is overloaded.
+
+WithPriority picks a priority for every request, which limiters implementing ratelimit.PriorityLimiter accept
+requests with, e.g. to keep a reserve of the capacity for health checks or the paid tier.
+*/
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type config struct {
+	onRejected http.Handler
+	priority   PriorityFunc // nil when requests are all of the normal priority
+	accepted   prometheus.Counter
+	rejected   prometheus.Counter
+}
+
+type Option func(*config)
+
+// Handles rejected requests instead of the default 429 response. The rate limit headers, including Retry-After,
+// are already set when it is called.
+func WithRejectionHandler(h http.Handler) Option {
+	return func(c *config) { c.onRejected = h }
+}
+
+// Counts the accepted and rejected requests
+func WithCounters(accepted, rejected prometheus.Counter) Option {
+	return func(c *config) {
+		c.accepted = accepted
+		c.rejected = rejected
+	}
+}
+
+// Accepts requests with the priority the function picks for them, if the limiter tells priorities apart.
+// Other limiters accept all requests alike.
+func WithPriority(priority PriorityFunc) Option {
+	return func(c *config) { c.priority = priority }
+}
+
+// Wraps handlers so that they only serve the requests the limiter accepts. Any of the ratelimit package's
+// limiters can be used, including the ConcurrencyLimiter.
+func RateLimit(limiter ratelimit.Limiter, opts ...Option) func(http.Handler) http.Handler {
+	return rateLimit(func(*http.Request) ratelimit.Limiter { return limiter }, opts)
+}
+
+// Like RateLimit, but with a separate limiter per key, e.g. per API key or client IP
+func RateLimitByKey(limiter *ratelimit.KeyedRateLimiter, key KeyFunc, opts ...Option) func(http.Handler) http.Handler {
+	return rateLimit(func(r *http.Request) ratelimit.Limiter { return limiter.Limiter(key(r)) }, opts)
+}
+
+func rateLimit(limiterFor func(*http.Request) ratelimit.Limiter, opts []Option) func(http.Handler) http.Handler {
+	c := config{onRejected: http.HandlerFunc(tooManyRequests)}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter := limiterFor(r)
+			accepted, status := c.accept(limiter, r)
+			reset := seconds(status.Reset)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(status.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+			if !accepted {
+				if c.rejected != nil {
+					c.rejected.Inc()
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(max(reset, 1)))
+				c.onRejected.ServeHTTP(w, r)
+				return
+			}
+			if c.accepted != nil {
+				c.accepted.Inc()
+			}
+			releaser, ok := limiter.(ratelimit.Releaser)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			start := time.Now()
+			defer func() {
+				releaser.Release(time.Since(start), rec.status == http.StatusServiceUnavailable || rec.status == http.StatusGatewayTimeout)
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// Accepts the request with its priority if the limiter tells priorities apart, and returns the status as seen by it
+func (c config) accept(limiter ratelimit.Limiter, r *http.Request) (bool, ratelimit.Status) {
+	if prioritized, ok := limiter.(ratelimit.PriorityLimiter); ok && c.priority != nil {
+		p := c.priority(r)
+		return prioritized.AcceptPriority(p), prioritized.StatusPriority(p)
+	}
+	return limiter.Accept(), limiter.Status()
+}
+
+// Records the status code a handler responds with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Lets http.ResponseController reach the wrapped writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Flushes the wrapped writer if it supports flushing, so that streamed responses aren't buffered
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := r.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Keeps the sendfile and splice paths of the wrapped writer, e.g. for http.ServeContent
+func (r *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(r.ResponseWriter, src)
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+// Delta-seconds as used by the headers, rounded up so that clients don't come back too early
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit"
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+})
+
+func newTestLimiter(t *testing.T, maxRpm int) (*ratelimit.TokenBucketRateLimiter, *ratelimittest.FakeClock) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	rl, err := ratelimit.NewTokenBucketRateLimiter(maxRpm, 0, ratelimit.WithClock(clock))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	return rl, clock
+}
+
+func serve(h http.Handler) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec
+}
+
+func TestRateLimit(t *testing.T) {
+	rl, clock := newTestLimiter(t, 2) // a token every 30s
+	accepted := prometheus.NewCounter(prometheus.CounterOpts{Name: "accepted"})
+	rejected := prometheus.NewCounter(prometheus.CounterOpts{Name: "rejected"})
+	h := RateLimit(rl, WithCounters(accepted, rejected))(ok)
+
+	tests := []struct {
+		after     time.Duration
+		code      int
+		remaining string
+		reset     string
+	}{
+		{0, http.StatusOK, "1", "30"},
+		{0, http.StatusOK, "0", "30"},
+		{3500 * time.Millisecond, http.StatusTooManyRequests, "0", "27"}, // rounded up from 26.5s
+	}
+	for i, test := range tests {
+		clock.Advance(test.after)
+		rec := serve(h)
+		if rec.Code != test.code {
+			t.Errorf("Expected status %d for request %d but got %d", test.code, i+1, rec.Code)
+		}
+		headers := map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": test.remaining, "RateLimit-Reset": test.reset}
+		for name, expected := range headers {
+			if got := rec.Header().Get(name); got != expected {
+				t.Errorf("Expected %s: %s for request %d but got %q", name, expected, i+1, got)
+			}
+		}
+		retryAfter := rec.Header().Get("Retry-After")
+		if test.code == http.StatusTooManyRequests && retryAfter != test.reset {
+			t.Errorf("Expected Retry-After: %s on the rejected request but got %q", test.reset, retryAfter)
+		}
+		if test.code == http.StatusOK && (retryAfter != "" || rec.Body.String() != "ok") {
+			t.Errorf("Expected the accepted request to be served without Retry-After but got %q, %q", retryAfter, rec.Body.String())
+		}
+	}
+	if testutil.ToFloat64(accepted) != 2 || testutil.ToFloat64(rejected) != 1 {
+		t.Errorf("Expected 2 accepted and 1 rejected requests to be counted but got %v and %v", testutil.ToFloat64(accepted), testutil.ToFloat64(rejected))
+	}
+}
+
+// A limiter that rejects everything with a fixed status
+type exhausted ratelimit.Status
+
+func (e exhausted) Accept() bool {
+	return false
+}
+
+func (e exhausted) Status() ratelimit.Status {
+	return ratelimit.Status(e)
+}
+
+func TestRetryAfterAtLeastOneSecond(t *testing.T) {
+	rec := serve(RateLimit(exhausted{Limit: 1})(ok))
+	if rec.Header().Get("Retry-After") != "1" || rec.Header().Get("RateLimit-Reset") != "0" {
+		t.Errorf("Expected Retry-After: 1 and RateLimit-Reset: 0 but got %q and %q", rec.Header().Get("Retry-After"), rec.Header().Get("RateLimit-Reset"))
+	}
+}
+
+func TestRejectionHandler(t *testing.T) {
+	rl, _ := newTestLimiter(t, 1)
+	rl.Accept()
+	custom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if w.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected the headers to be set before the rejection handler is called")
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	if rec := serve(RateLimit(rl, WithRejectionHandler(custom))(ok)); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the custom rejection handler to respond but got status %d", rec.Code)
+	}
+}
+
+func TestRateLimitWithOtherAlgorithms(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	gcra, _ := ratelimit.NewGCRALimiter(60, time.Minute, 2, ratelimit.WithClock(clock))
+	window, _ := ratelimit.NewSlidingWindowLogLimiter(2, time.Minute, ratelimit.WithClock(clock))
+	for _, limiter := range []ratelimit.Limiter{gcra, window} {
+		h := RateLimit(limiter)(ok)
+		codes := []int{serve(h).Code, serve(h).Code, serve(h).Code}
+		if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+			t.Errorf("Expected 2 requests to pass with %T but got %v", limiter, codes)
+		}
+	}
+}
+
+func TestRateLimitReleasesConcurrencyLimiter(t *testing.T) {
+	l, _ := ratelimit.NewConcurrencyLimiter(10, 1, 10, &ratelimit.AIMD{})
+	h := RateLimit(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.InFlight() != 1 {
+			t.Errorf("Expected the request to hold a slot while it is served but %d are in flight", l.InFlight())
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	if rec := serve(h); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("RateLimit-Limit") != "10" {
+		t.Errorf("Expected the handler's response with the rate limit headers but got %d and %q", rec.Code, rec.Header().Get("RateLimit-Limit"))
+	}
+	if status := l.Status(); l.InFlight() != 0 || status.Limit != 9 {
+		t.Errorf("Expected the slot to be released and the 503 to back the limit off to 9 but got %d in flight and %+v", l.InFlight(), status)
+	}
+}
+
+func TestConcurrencyLimitKeepsOptionalInterfaces(t *testing.T) {
+	l, _ := ratelimit.NewConcurrencyLimiter(10, 1, 10, &ratelimit.AIMD{})
+
+	rec := httptest.NewRecorder()
+	RateLimit(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() != rec {
+			t.Errorf("Expected the response writer to unwrap to the original one")
+		}
+		w.(http.Flusher).Flush()
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !rec.Flushed {
+		t.Errorf("Expected the flush to reach the original response writer")
+	}
+
+	ts := httptest.NewServer(RateLimit(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 418 I'm a teapot\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+		buf.Flush()
+	})))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("Expected the hijacked connection's response but got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit"
+)
+
+// A PriorityFunc picks the priority a request is rate limited with
+type PriorityFunc func(r *http.Request) ratelimit.Priority
+
+// A Matcher tells whether a request has some attribute, e.g. a path or header
+type Matcher func(r *http.Request) bool
+
+// Matches requests to paths starting with the prefix, e.g. "/healthz"
+func PathPrefix(prefix string) Matcher {
+	return func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	}
+}
+
+// Matches requests with the header set to the value, e.g. "X-Plan: paid"
+func HeaderEquals(name, value string) Matcher {
+	return func(r *http.Request) bool {
+		return r.Header.Get(name) == value
+	}
+}
+
+// Matches requests whose User-Agent contains any of the substrings, ignoring case, e.g. "bot" or "crawler"
+func UserAgentContains(substrings ...string) Matcher {
+	return func(r *http.Request) bool {
+		agent := strings.ToLower(r.UserAgent())
+		for _, s := range substrings {
+			if strings.Contains(agent, strings.ToLower(s)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Gives the requests a Matcher matches a priority
+type PriorityRule struct {
+	Match    Matcher
+	Priority ratelimit.Priority
+}
+
+// Picks the priority of the first rule that matches the request, or the fallback if none does, e.g.
+//
+//	FirstMatch(ratelimit.PriorityNormal,
+//		PriorityRule{Match: PathPrefix("/healthz"), Priority: ratelimit.PriorityCritical},
+//		PriorityRule{Match: HeaderEquals("X-Plan", "paid"), Priority: ratelimit.PriorityHigh},
+//		PriorityRule{Match: UserAgentContains("bot", "crawler"), Priority: ratelimit.PriorityLow})
+func FirstMatch(fallback ratelimit.Priority, rules ...PriorityRule) PriorityFunc {
+	return func(r *http.Request) ratelimit.Priority {
+		for _, rule := range rules {
+			if rule.Match(r) {
+				return rule.Priority
+			}
+		}
+		return fallback
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit"
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+)
+
+var priorities = FirstMatch(ratelimit.PriorityNormal,
+	PriorityRule{PathPrefix("/healthz"), ratelimit.PriorityCritical},
+	PriorityRule{HeaderEquals("X-Plan", "paid"), ratelimit.PriorityHigh},
+	PriorityRule{UserAgentContains("bot", "crawler"), ratelimit.PriorityLow},
+)
+
+func newRequest(path, plan, userAgent string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if plan != "" {
+		r.Header.Set("X-Plan", plan)
+	}
+	r.Header.Set("User-Agent", userAgent)
+	return r
+}
+
+func TestFirstMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		r        *http.Request
+		priority ratelimit.Priority
+	}{
+		{"health check", newRequest("/healthz/ready", "", "kube-probe/1.26"), ratelimit.PriorityCritical},
+		{"paid tier", newRequest("/api", "paid", "curl/8.0"), ratelimit.PriorityHigh},
+		{"crawler", newRequest("/api", "", "Googlebot/2.1"), ratelimit.PriorityLow},
+		{"paid crawler", newRequest("/api", "paid", "SomeCrawler/1.0"), ratelimit.PriorityHigh},
+		{"free tier", newRequest("/api", "free", "curl/8.0"), ratelimit.PriorityNormal},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if p := priorities(test.r); p != test.priority {
+				t.Errorf("Expected %s priority but got %s", test.priority, p)
+			}
+		})
+	}
+}
+
+func TestRateLimitWithPriority(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	rl, err := ratelimit.NewTokenBucketRateLimiter(4, 0, ratelimit.WithClock(clock), ratelimit.WithReserve(ratelimit.PriorityCritical, 0.5))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	h := RateLimit(rl, WithPriority(priorities))(ok)
+
+	tests := []struct {
+		path      string
+		code      int
+		remaining string
+	}{
+		{"/api", http.StatusOK, "1"},
+		{"/api", http.StatusOK, "0"},
+		{"/api", http.StatusTooManyRequests, "0"},
+		{"/healthz", http.StatusOK, "1"},
+		{"/healthz", http.StatusOK, "0"},
+		{"/healthz", http.StatusTooManyRequests, "0"},
+	}
+	for i, test := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newRequest(test.path, "", "curl/8.0"))
+		if rec.Code != test.code {
+			t.Errorf("Expected status %d for request %d to %s but got %d", test.code, i+1, test.path, rec.Code)
+		}
+		if remaining := rec.Header().Get("RateLimit-Remaining"); remaining != test.remaining {
+			t.Errorf("Expected %s remaining after request %d to %s but got %s", test.remaining, i+1, test.path, remaining)
+		}
+	}
+}
+
+func TestPriorityIgnoredByOtherLimiters(t *testing.T) {
+	rl, err := ratelimit.NewFixedWindowLimiter(1, time.Minute)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	h := RateLimit(rl, WithPriority(priorities))(ok)
+	if rec := serve(h); rec.Code != http.StatusOK {
+		t.Errorf("Expected the first request to be accepted but got %d", rec.Code)
+	}
+	if rec := serve(h); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second request to be rejected but got %d", rec.Code)
+	}
+}
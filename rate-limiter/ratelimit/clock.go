@@ -0,0 +1,23 @@
+package ratelimit
+
+import "time"
+
+// A Clock tells the time and waits for it to pass, so that tests can replace the real one
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Counts from when the process started on the monotonic clock alone, which is cheaper to read than time.Now
+// (the token bucket reads it on every call) and doesn't jump when the wall clock is set
+type realClock struct{}
+
+var processStart = time.Now()
+
+func (realClock) Now() time.Time {
+	return processStart.Add(time.Since(processStart))
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
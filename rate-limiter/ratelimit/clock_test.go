@@ -0,0 +1,10 @@
+package ratelimit
+
+import "testing"
+
+func BenchmarkRealClockNow(b *testing.B) {
+	var clock Clock = realClock{}
+	for i := 0; i < b.N; i++ {
+		clock.Now()
+	}
+}
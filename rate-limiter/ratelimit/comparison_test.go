@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+)
+
+// A traffic trace as the number of requests sent in each second
+type trace struct {
+	name    string
+	seconds int
+	at      func(second int) int
+}
+
+var traces = []trace{
+	{"steady half of the limit", 180, func(s int) int { return s % 2 }},
+	{"bursts a minute apart", 121, func(s int) int {
+		if s%60 == 0 {
+			return 100
+		}
+		return 0
+	}},
+	{"window boundary", 61, func(s int) int {
+		if s == 59 || s == 60 {
+			return 60
+		}
+		return 0
+	}},
+	{"overload", 120, func(s int) int { return 3 }},
+}
+
+type limiterUnderTest struct {
+	name string
+	// the most requests the limiter guarantees to accept in any minute, 0 if it only approximates a limit
+	maxPerMinute int
+	new          func(t *testing.T, clock *ratelimittest.FakeClock) Limiter
+}
+
+// All limiters allow 60 requests per minute. The token bucket can hold a minute's worth of tokens and the fixed
+// window allows a window's worth right before and after a boundary. GCRA and the leaky bucket allow 10 requests
+// ahead of schedule.
+var limitersUnderTest = []limiterUnderTest{
+	{"token bucket", 120, func(t *testing.T, clock *ratelimittest.FakeClock) Limiter {
+		rl, _ := NewTokenBucketRateLimiter(60, 0, WithClock(clock))
+		return rl
+	}},
+	{"fixed window", 120, func(t *testing.T, clock *ratelimittest.FakeClock) Limiter {
+		l, _ := NewFixedWindowLimiter(60, time.Minute, WithClock(clock))
+		return l
+	}},
+	{"sliding window log", 60, func(t *testing.T, clock *ratelimittest.FakeClock) Limiter {
+		l, _ := NewSlidingWindowLogLimiter(60, time.Minute, WithClock(clock))
+		return l
+	}},
+	{"sliding window counter", 0, func(t *testing.T, clock *ratelimittest.FakeClock) Limiter {
+		l, _ := NewSlidingWindowCounterLimiter(60, time.Minute, WithClock(clock))
+		return l
+	}},
+	{"leaky bucket", 69, func(t *testing.T, clock *ratelimittest.FakeClock) Limiter {
+		l, _ := NewLeakyBucketLimiter(60, time.Minute, 10, WithClock(clock))
+		return l
+	}},
+	{"gcra", 69, func(t *testing.T, clock *ratelimittest.FakeClock) Limiter {
+		l, _ := NewGCRALimiter(60, time.Minute, 10, WithClock(clock))
+		return l
+	}},
+}
+
+// Sends the trace through the limiter and returns the times of the accepted requests
+func replay(t *testing.T, lut limiterUnderTest, tr trace) []time.Time {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter := lut.new(t, clock)
+	var accepted []time.Time
+	for s := 0; s < tr.seconds; s++ {
+		if s > 0 {
+			clock.Advance(time.Second)
+		}
+		for i := 0; i < tr.at(s); i++ {
+			if limiter.Accept() {
+				accepted = append(accepted, clock.Now())
+			}
+		}
+	}
+	return accepted
+}
+
+// The most requests accepted in any minute
+func maxPerMinute(accepted []time.Time) int {
+	most, start := 0, 0
+	for end := range accepted {
+		for !accepted[start].After(accepted[end].Add(-time.Minute)) {
+			start++
+		}
+		if n := end - start + 1; n > most {
+			most = n
+		}
+	}
+	return most
+}
+
+func TestCompareLimiters(t *testing.T) {
+	expected := map[string]map[string]int{
+		// below the limit every algorithm lets everything through
+		"steady half of the limit": {"token bucket": 90, "fixed window": 90, "sliding window log": 90, "sliding window counter": 90, "leaky bucket": 90, "gcra": 90},
+		// the counter still weighs the previous burst fully at the start of the next window
+		"bursts a minute apart": {"token bucket": 180, "fixed window": 180, "sliding window log": 180, "sliding window counter": 120, "leaky bucket": 30, "gcra": 30},
+		// the fixed window lets two windows' worth through; the token bucket one more token on top of a full bucket
+		"window boundary": {"token bucket": 61, "fixed window": 120, "sliding window log": 60, "sliding window counter": 60, "leaky bucket": 11, "gcra": 11},
+		// in the long run they all converge on the rate, plus the burst they allow up front
+		"overload": {"token bucket": 179, "fixed window": 120, "sliding window log": 120, "sliding window counter": 119, "leaky bucket": 129, "gcra": 129},
+	}
+	for _, tr := range traces {
+		for _, lut := range limitersUnderTest {
+			accepted := replay(t, lut, tr)
+			if most := maxPerMinute(accepted); lut.maxPerMinute > 0 && most > lut.maxPerMinute {
+				t.Errorf("Expected %s to accept at most %d requests per minute of %s but it accepted %d", lut.name, lut.maxPerMinute, tr.name, most)
+			}
+			if want, ok := expected[tr.name][lut.name]; ok && len(accepted) != want {
+				t.Errorf("Expected %s to accept %d requests of %s but it accepted %d", lut.name, want, tr.name, len(accepted))
+			}
+		}
+	}
+}
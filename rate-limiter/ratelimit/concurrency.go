@@ -0,0 +1,242 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidConcurrencyLimits = errors.New("concurrency limits must satisfy 1 <= min <= initial <= max")
+	ErrMissingLimitAlgorithm    = errors.New("limit algorithm cannot be nil")
+)
+
+// A Sample is the outcome of a request that held a slot of a ConcurrencyLimiter
+type Sample struct {
+	Latency  time.Duration
+	InFlight int  // requests in flight when it completed, itself included
+	Dropped  bool // the backend was overloaded, e.g. the request timed out or was shed
+}
+
+// A LimitAlgorithm works out the next concurrency limit from the current one and a sample. The limiter calls it
+// under its lock, so implementations may keep state between samples without synchronizing.
+type LimitAlgorithm interface {
+	Update(limit float64, sample Sample) float64
+}
+
+// A ConcurrencyLimiter limits the requests in flight instead of their rate, and adapts that limit to the latency
+// the backend responds with: callers Accept a request, and Release it with its latency once it completes. Unlike
+// the ramping of the token bucket, which only follows demand, the limit backs off as soon as the backend slows down.
+// It is safe for concurrent use.
+type ConcurrencyLimiter struct {
+	minLimit  int
+	maxLimit  int
+	algorithm LimitAlgorithm
+	metrics   *limiterMetrics // nil without WithMetrics
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+}
+
+// Starts off allowing initialLimit requests in flight, then adapts the limit within [minLimit, maxLimit] with the
+// algorithm, e.g. NewConcurrencyLimiter(20, 1, 200, &Vegas{}). Only the WithMetrics option is supported.
+func NewConcurrencyLimiter(initialLimit, minLimit, maxLimit int, algorithm LimitAlgorithm, opts ...Option) (*ConcurrencyLimiter, error) {
+	if minLimit < 1 || initialLimit < minLimit || maxLimit < initialLimit {
+		return nil, ErrInvalidConcurrencyLimits
+	}
+	if algorithm == nil {
+		return nil, ErrMissingLimitAlgorithm
+	}
+	c, err := newConfig(maxLimit, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.verifyNoTokenBucketOptions(); err != nil {
+		return nil, err
+	}
+	if _, ok := c.clock.(realClock); !ok {
+		return nil, fmt.Errorf("%w: WithClock", ErrUnsupportedOption) // latencies come from the caller
+	}
+	l := &ConcurrencyLimiter{minLimit: minLimit, maxLimit: maxLimit, algorithm: algorithm, limit: float64(initialLimit)}
+	if c.metrics != nil {
+		l.metrics = c.metrics.limiter(c.name)
+		l.metrics.observe(initialLimit, initialLimit)
+	}
+	return l, nil
+}
+
+// Takes a slot if fewer requests than the limit are in flight. Every accepted request must be released.
+func (l *ConcurrencyLimiter) Accept() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	accepted := l.inFlight < int(l.limit)
+	if accepted {
+		l.inFlight++
+	}
+	l.metrics.request(accepted)
+	l.metrics.observe(int(l.limit)-l.inFlight, int(l.limit))
+	return accepted
+}
+
+// Frees the slot of a completed request and adapts the limit to its latency. A latency that isn't positive, e.g. from
+// a coarse clock, tells nothing about the backend, so the limit is only adapted to it if the request was dropped.
+func (l *ConcurrencyLimiter) Release(latency time.Duration, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight == 0 {
+		return
+	}
+	before := int(l.limit)
+	next := l.limit
+	if latency > 0 || dropped {
+		next = l.algorithm.Update(l.limit, Sample{Latency: latency, InFlight: l.inFlight, Dropped: dropped})
+	}
+	if math.IsNaN(next) || math.IsInf(next, 0) || (next > l.limit && l.inFlight*2 < before) {
+		// a broken algorithm, or too little demand to tell whether the backend could take more
+		next = l.limit
+	}
+	l.limit = math.Min(math.Max(next, float64(l.minLimit)), float64(l.maxLimit))
+	l.inFlight--
+	l.metrics.scaled(int(l.limit) - before)
+	l.metrics.observe(int(l.limit)-l.inFlight, int(l.limit))
+}
+
+// The limit and free slots. There is no reset time, a slot frees up whenever a request completes.
+func (l *ConcurrencyLimiter) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Status{Limit: int(l.limit), Remaining: max(int(l.limit)-l.inFlight, 0)}
+}
+
+// The number of requests in flight
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Additive increase, multiplicative decrease: the limit grows by one for every limit's worth of requests and is cut
+// back when a request is dropped or slower than the timeout.
+type AIMD struct {
+	Backoff float64       // the share of the limit kept on a drop (0.9 when 0)
+	Timeout time.Duration // requests slower than this count as dropped (none when 0)
+}
+
+func (a *AIMD) Update(limit float64, s Sample) float64 {
+	if s.Dropped || (a.Timeout > 0 && s.Latency > a.Timeout) {
+		return limit * orDefault(a.Backoff, 0.9)
+	}
+	return limit + 1/limit
+}
+
+// TCP Vegas: the limit grows while the backend queues fewer than Alpha requests and shrinks once it queues more
+// than Beta. The queue is estimated from how much slower requests are than the fastest one seen.
+type Vegas struct {
+	Alpha   float64 // (3 when 0)
+	Beta    float64 // (6 when 0)
+	Backoff float64 // the share of the limit kept on a drop (0.9 when 0)
+	Window  int     // samples after which a backend that stayed slower sets a new fastest latency (1000 when 0)
+	noLoad  minLatency
+}
+
+func (v *Vegas) Update(limit float64, s Sample) float64 {
+	if s.Dropped {
+		return limit * orDefault(v.Backoff, 0.9)
+	}
+	if s.Latency <= 0 {
+		return limit
+	}
+	v.noLoad.lower(s.Latency)
+	next := limit
+	queue := limit * (1 - float64(v.noLoad.min)/float64(s.Latency))
+	switch {
+	case queue < orDefault(v.Alpha, 3):
+		next = limit + 1/limit
+	case queue > orDefault(v.Beta, 6):
+		next = limit - 1/limit
+	}
+	v.noLoad.observe(s.Latency, next-limit, v.Window)
+	return next
+}
+
+// The limit follows the gradient between the fastest latency seen and the current one: it is scaled by their ratio
+// (tolerating some slowdown, and halving it at most) and given headroom of its square root for requests to queue.
+type Gradient struct {
+	Tolerance float64 // how much slower than the fastest requests may be before the limit shrinks (1.5 when 0)
+	Smoothing float64 // the weight of a limit's worth of samples in the limit (0.2 when 0)
+	Window    int     // samples after which a backend that stayed slower sets a new fastest latency (1000 when 0)
+	noLoad    minLatency
+}
+
+func (g *Gradient) Update(limit float64, s Sample) float64 {
+	if s.Latency <= 0 && !s.Dropped {
+		return limit
+	}
+	if s.Latency > 0 {
+		g.noLoad.lower(s.Latency)
+	}
+	gradient := 0.5
+	if !s.Dropped {
+		gradient = math.Max(0.5, math.Min(1, orDefault(g.Tolerance, 1.5)*float64(g.noLoad.min)/float64(s.Latency)))
+	}
+	next := limit*gradient + math.Sqrt(limit)
+	smoothing := orDefault(g.Smoothing, 0.2) / limit
+	next = limit*(1-smoothing) + next*smoothing
+	if s.Latency > 0 && !s.Dropped {
+		g.noLoad.observe(s.Latency, next-limit, g.Window)
+	}
+	return next
+}
+
+const defaultLatencyWindow = 1000
+
+// The fastest latency seen, which rises to the fastest of a window of samples if the limit was lowered but never
+// raised during it. Under load the limit grows until requests queue and shrinks until they no longer do, so if cutting
+// it didn't get a single request through fast enough to grow it again, the backend itself became slower, e.g. after
+// failing over to a farther region, and holding on to the old latency would starve it.
+type minLatency struct {
+	min       time.Duration // 0 before any sample
+	windowMin time.Duration
+	samples   int // in the current window
+	raised    int // samples of the current window that raised the limit
+	lowered   int // and that lowered it
+}
+
+func (m *minLatency) lower(latency time.Duration) {
+	if m.min == 0 || latency < m.min {
+		m.min = latency
+	}
+}
+
+// Takes a sample and how much the limit changed for it
+func (m *minLatency) observe(latency time.Duration, change float64, window int) {
+	if window <= 0 {
+		window = defaultLatencyWindow
+	}
+	if m.windowMin == 0 || latency < m.windowMin {
+		m.windowMin = latency
+	}
+	m.samples++
+	if change > 0 {
+		m.raised++
+	} else if change < 0 {
+		m.lowered++
+	}
+	if m.samples < window {
+		return
+	}
+	if m.raised == 0 && m.lowered > 0 {
+		m.min = m.windowMin
+	}
+	m.windowMin, m.samples, m.raised, m.lowered = 0, 0, 0, 0
+}
+
+func orDefault(value, fallback float64) float64 {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
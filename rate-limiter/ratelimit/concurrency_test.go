@@ -0,0 +1,286 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewConcurrencyLimiter(t *testing.T) {
+	tests := []struct {
+		initial, min, max int
+		algorithm         LimitAlgorithm
+		err               error
+	}{
+		{10, 0, 20, &AIMD{}, ErrInvalidConcurrencyLimits},
+		{10, 11, 20, &AIMD{}, ErrInvalidConcurrencyLimits},
+		{10, 1, 9, &AIMD{}, ErrInvalidConcurrencyLimits},
+		{10, 1, 20, nil, ErrMissingLimitAlgorithm},
+		{10, 1, 20, &AIMD{}, nil},
+	}
+	for _, test := range tests {
+		if _, err := NewConcurrencyLimiter(test.initial, test.min, test.max, test.algorithm); !errors.Is(err, test.err) {
+			t.Errorf("Expected %v for %+v but got %v", test.err, test, err)
+		}
+	}
+}
+
+func TestConcurrencyLimiterAcceptAndRelease(t *testing.T) {
+	l, _ := NewConcurrencyLimiter(2, 2, 2, &AIMD{})
+	if !l.Accept() || !l.Accept() || l.Accept() {
+		t.Fatalf("Expected exactly 2 requests to be accepted")
+	}
+	if status := l.Status(); status.Limit != 2 || status.Remaining != 0 || status.Reset != 0 {
+		t.Errorf("Expected a limit of 2 without free slots but got %+v", status)
+	}
+	l.Release(time.Millisecond, false)
+	if l.InFlight() != 1 || !l.Accept() {
+		t.Errorf("Expected a released slot to be available again")
+	}
+	for i := 0; i < 3; i++ {
+		l.Release(time.Millisecond, false) // releasing more than was accepted is ignored
+	}
+	if l.InFlight() != 0 || l.Status().Remaining != 2 {
+		t.Errorf("Expected no requests in flight but got %d", l.InFlight())
+	}
+}
+
+func TestLimitAlgorithms(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm LimitAlgorithm
+		sample    Sample
+		expected  float64
+	}{
+		{"aimd increases by one per limit's worth of samples", &AIMD{}, Sample{Latency: time.Second}, 10.1},
+		{"aimd backs off on a drop", &AIMD{}, Sample{Latency: time.Millisecond, Dropped: true}, 9},
+		{"aimd backs off on a timeout", &AIMD{Backoff: 0.5, Timeout: time.Second}, Sample{Latency: 2 * time.Second}, 5},
+		{"vegas grows without a queue", &Vegas{noLoad: minLatency{min: 10 * time.Millisecond}}, Sample{Latency: 10 * time.Millisecond}, 10.1},
+		{"vegas holds with a small queue", &Vegas{noLoad: minLatency{min: 10 * time.Millisecond}}, Sample{Latency: 20 * time.Millisecond}, 10},   // queue of 5
+		{"vegas shrinks with a long queue", &Vegas{noLoad: minLatency{min: 10 * time.Millisecond}}, Sample{Latency: 40 * time.Millisecond}, 9.9}, // queue of 7.5
+		{"vegas backs off on a drop", &Vegas{}, Sample{Latency: time.Millisecond, Dropped: true}, 9},
+		{"gradient grows within the tolerance", &Gradient{noLoad: minLatency{min: 10 * time.Millisecond}}, Sample{Latency: 15 * time.Millisecond}, 10.063245553203368},
+		{"gradient halves at most", &Gradient{noLoad: minLatency{min: 10 * time.Millisecond}}, Sample{Latency: time.Second}, 9.963245553203368},
+		{"vegas ignores a zero latency", &Vegas{}, Sample{}, 10},
+		{"gradient ignores a zero latency", &Gradient{}, Sample{}, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.algorithm.Update(10, test.sample); got != test.expected {
+				t.Errorf("Expected a limit of %v but got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+// Returns a limit that is not a number
+type brokenAlgorithm struct{}
+
+func (brokenAlgorithm) Update(limit float64, s Sample) float64 {
+	return math.NaN()
+}
+
+func TestReleaseWithZeroLatency(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm LimitAlgorithm
+	}{
+		{"vegas", &Vegas{}},
+		{"gradient", &Gradient{}},
+		{"broken", brokenAlgorithm{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, _ := NewConcurrencyLimiter(10, 1, 20, test.algorithm)
+			for i := 0; i < 10; i++ {
+				l.Accept()
+			}
+			l.Release(0, false)
+			l.Release(10*time.Millisecond, false)
+			l.Release(20*time.Millisecond, false)
+			if status := l.Status(); status.Limit < 1 || status.Limit > 20 || !l.Accept() {
+				t.Errorf("Expected the limiter to keep accepting after a zero latency but got %+v", status)
+			}
+		})
+	}
+}
+
+// A backend that serves up to capacity requests at a time within the base latency. Beyond that the requests
+// share it, so latency grows with every request in flight, and requests slower than the timeout are dropped.
+type simulatedBackend struct {
+	base     time.Duration
+	capacity int
+	timeout  time.Duration
+}
+
+func (b simulatedBackend) latency(inFlight int) time.Duration {
+	if inFlight <= b.capacity {
+		return b.base
+	}
+	return b.base * time.Duration(inFlight) / time.Duration(b.capacity)
+}
+
+type simulationResult struct {
+	limit      float64 // mean limit over the second half
+	latency    time.Duration
+	throughput float64 // requests completed per millisecond over the second half
+	dropped    int
+}
+
+// Sends arrivalsPerMs requests every millisecond of virtual time through the limiter to the backend
+func simulate(l *ConcurrencyLimiter, b simulatedBackend, arrivalsPerMs int, duration time.Duration) simulationResult {
+	type request struct {
+		done    time.Duration
+		latency time.Duration
+	}
+	var pending []request
+	var result simulationResult
+	var completed int
+	var latencies time.Duration
+	steps := int(duration / time.Millisecond)
+	for step := 0; step < steps; step++ {
+		now := time.Duration(step) * time.Millisecond
+		measured := step >= steps/2
+		kept := pending[:0]
+		for _, r := range pending {
+			if r.done > now {
+				kept = append(kept, r)
+				continue
+			}
+			dropped := b.timeout > 0 && r.latency > b.timeout
+			l.Release(r.latency, dropped)
+			if measured {
+				completed++
+				latencies += r.latency
+				if dropped {
+					result.dropped++
+				}
+			}
+		}
+		pending = kept
+		for i := 0; i < arrivalsPerMs; i++ {
+			if l.Accept() {
+				latency := b.latency(l.InFlight())
+				pending = append(pending, request{done: now + latency, latency: latency})
+			}
+		}
+		if measured {
+			result.limit += float64(l.Status().Limit)
+		}
+	}
+	for _, r := range pending {
+		l.Release(r.latency, b.timeout > 0 && r.latency > b.timeout)
+	}
+	result.limit /= float64(steps - steps/2)
+	result.throughput = float64(completed) / float64(steps-steps/2)
+	if completed > 0 {
+		result.latency = latencies / time.Duration(completed)
+	}
+	return result
+}
+
+func TestAdaptiveLimitUnderOverload(t *testing.T) {
+	// serves 20 requests per 10ms, i.e. 2 per ms, while 5 per ms arrive
+	backend := simulatedBackend{base: 10 * time.Millisecond, capacity: 20, timeout: 25 * time.Millisecond}
+	fixed, _ := NewConcurrencyLimiter(200, 200, 200, &AIMD{})
+	unlimited := simulate(fixed, backend, 5, 20*time.Second)
+	if unlimited.latency < 80*time.Millisecond || unlimited.dropped == 0 {
+		t.Fatalf("Expected the backend to slow down and drop requests without an adaptive limit but got %+v", unlimited)
+	}
+
+	for _, algorithm := range []LimitAlgorithm{&AIMD{Timeout: 15 * time.Millisecond}, &Vegas{}, &Gradient{}} {
+		l, _ := NewConcurrencyLimiter(10, 1, 200, algorithm)
+		result := simulate(l, backend, 5, 20*time.Second)
+		if result.limit < 15 || result.limit > 40 {
+			t.Errorf("Expected %T to settle near the backend's capacity of 20 but the limit was %v", algorithm, result.limit)
+		}
+		if result.latency > 2*backend.base {
+			t.Errorf("Expected %T to keep the latency below %v but it was %v", algorithm, 2*backend.base, result.latency)
+		}
+		if result.dropped > 0 || result.throughput < 1.5 {
+			t.Errorf("Expected %T to keep the backend busy without drops but %v requests per ms completed and %d were dropped", algorithm, result.throughput, result.dropped)
+		}
+	}
+}
+
+func TestAdaptiveLimitUnderLightLoad(t *testing.T) {
+	backend := simulatedBackend{base: 10 * time.Millisecond, capacity: 20}
+	for _, algorithm := range []LimitAlgorithm{&AIMD{}, &Vegas{}, &Gradient{}} {
+		l, _ := NewConcurrencyLimiter(30, 1, 200, algorithm)
+		// 10 requests in flight on average: no reason to change the limit, nor to grow it without demand
+		result := simulate(l, backend, 1, 5*time.Second)
+		if result.limit != 30 {
+			t.Errorf("Expected %T to keep the limit of 30 under light load but it was %v", algorithm, result.limit)
+		}
+	}
+}
+
+func TestConcurrencyLimiterMetrics(t *testing.T) {
+	metrics := newTestMetrics(t)
+	l, _ := NewConcurrencyLimiter(2, 1, 10, &AIMD{Backoff: 0.5}, WithMetrics(metrics, "backend"))
+	l.Accept()
+	l.Accept()
+	l.Accept()
+	l.Release(time.Millisecond, true)
+	tests := []struct {
+		metric   prometheus.Collector
+		expected float64
+	}{
+		{metrics.capacity.WithLabelValues("backend"), 1},
+		{metrics.tokens.WithLabelValues("backend"), 0}, // free slots
+		{metrics.ramping.WithLabelValues("backend"), -1},
+		{metrics.requests.WithLabelValues("backend", "accepted"), 2},
+		{metrics.requests.WithLabelValues("backend", "rejected"), 1},
+		{metrics.scaleEvents.WithLabelValues("backend", "down"), 1},
+	}
+	for _, test := range tests {
+		if got := testutil.ToFloat64(test.metric); got != test.expected {
+			t.Errorf("Expected %v but got %v", test.expected, got)
+		}
+	}
+}
+
+func TestAdaptiveLimitFollowsSlowerBackend(t *testing.T) {
+	// the same throughput of 2 requests per ms, but each request now takes 40ms, e.g. after a failover to a
+	// farther region, so the backend needs 80 requests in flight to keep up
+	fast := simulatedBackend{base: 10 * time.Millisecond, capacity: 20, timeout: 25 * time.Millisecond}
+	slow := simulatedBackend{base: 40 * time.Millisecond, capacity: 80, timeout: 100 * time.Millisecond}
+	for _, algorithm := range []LimitAlgorithm{&Vegas{}, &Gradient{}} {
+		l, _ := NewConcurrencyLimiter(10, 1, 200, algorithm)
+		simulate(l, fast, 5, 20*time.Second)
+		result := simulate(l, slow, 5, 20*time.Second)
+		if result.limit < 60 || result.limit > 160 {
+			t.Errorf("Expected %T to settle near the slower backend's capacity of 80 but the limit was %v", algorithm, result.limit)
+		}
+		if result.throughput < 1.5 {
+			t.Errorf("Expected %T to keep the slower backend busy but %v requests per ms completed", algorithm, result.throughput)
+		}
+	}
+}
+
+func TestMinLatencyRisesOnlyWhenTheLimitStoppedGrowing(t *testing.T) {
+	var m minLatency
+	m.lower(10 * time.Millisecond)
+	m.observe(40*time.Millisecond, -0.1, 3)
+	m.observe(30*time.Millisecond, 0.1, 3)
+	m.observe(30*time.Millisecond, 0, 3)
+	if m.min != 10*time.Millisecond {
+		t.Errorf("Expected a window in which the limit also grew to keep the fastest latency but got %v", m.min)
+	}
+	for i := 0; i < 3; i++ {
+		m.observe(40*time.Millisecond, 0, 3)
+	}
+	if m.min != 10*time.Millisecond {
+		t.Errorf("Expected a window in which the limit held to keep the fastest latency but got %v", m.min)
+	}
+	m.observe(40*time.Millisecond, -0.1, 3)
+	m.observe(30*time.Millisecond, 0, 3)
+	m.observe(30*time.Millisecond, -0.1, 3)
+	if m.min != 30*time.Millisecond {
+		t.Errorf("Expected the fastest latency to rise to the window's 30ms but got %v", m.min)
+	}
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// A FixedWindowLimiter accepts up to limit requests per window, with windows aligned to multiples of the window size.
+// It is the cheapest limiter, but lets up to twice the limit through around a window boundary.
+type FixedWindowLimiter struct {
+	limit   int
+	window  time.Duration
+	clock   Clock
+	metrics *limiterMetrics // nil without WithMetrics
+
+	mu          sync.Mutex
+	windowStart time.Time
+	count       int
+}
+
+// Only the WithClock and WithMetrics options apply
+func NewFixedWindowLimiter(limit int, window time.Duration, opts ...Option) (*FixedWindowLimiter, error) {
+	if err := verifyLimit(limit, window); err != nil {
+		return nil, err
+	}
+	clock, metrics, err := clockAndMetricsOf(limit, opts)
+	if err != nil {
+		return nil, err
+	}
+	metrics.observe(limit, limit)
+	return &FixedWindowLimiter{limit: limit, window: window, clock: clock, metrics: metrics}, nil
+}
+
+func (l *FixedWindowLimiter) Accept() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance()
+	accepted := l.count < l.limit
+	if accepted {
+		l.count++
+	}
+	l.metrics.request(accepted)
+	l.metrics.observe(l.limit-l.count, l.limit)
+	return accepted
+}
+
+func (l *FixedWindowLimiter) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.advance()
+	return Status{Limit: l.limit, Remaining: l.limit - l.count, Reset: l.windowStart.Add(l.window).Sub(now)}
+}
+
+// Moves to the window of the current time. Must be called with l.mu held.
+func (l *FixedWindowLimiter) advance() time.Time {
+	now := l.clock.Now()
+	if start := now.Truncate(l.window); start.After(l.windowStart) {
+		l.windowStart = start
+		l.count = 0
+	}
+	return now
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// A GCRALimiter implements the generic cell rate algorithm: requests are spaced out by window/limit on average,
+// with bursts of up to burst requests. It only keeps the theoretical arrival time of the next request.
+type GCRALimiter struct {
+	limit     int
+	interval  time.Duration // emission interval between requests at the sustained rate
+	tolerance time.Duration // how far ahead of schedule requests may be
+	clock     Clock
+	metrics   *limiterMetrics // nil without WithMetrics
+
+	mu  sync.Mutex
+	tat time.Time // theoretical arrival time
+}
+
+// Allows limit requests per window on average, with bursts of up to burst requests. Only the WithClock and WithMetrics
+// options apply, and the metrics report the requests the burst still allows as the tokens.
+func NewGCRALimiter(limit int, window time.Duration, burst int, opts ...Option) (*GCRALimiter, error) {
+	interval, err := emissionInterval(limit, window)
+	if err != nil {
+		return nil, err
+	}
+	if burst < 1 {
+		return nil, ErrInvalidBurst
+	}
+	clock, metrics, err := clockAndMetricsOf(limit, opts)
+	if err != nil {
+		return nil, err
+	}
+	metrics.observe(burst, limit)
+	return &GCRALimiter{limit: limit, interval: interval, tolerance: time.Duration(burst-1) * interval, clock: clock, metrics: metrics}, nil
+}
+
+func (l *GCRALimiter) Accept() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	tat := l.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	accepted := tat.Sub(now) <= l.tolerance
+	if accepted {
+		l.tat = tat.Add(l.interval)
+	}
+	l.metrics.request(accepted)
+	l.metrics.observe(l.remaining(now), l.limit)
+	return accepted
+}
+
+func (l *GCRALimiter) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	return Status{Limit: l.limit, Remaining: l.remaining(now), Reset: nonNegative(l.tat.Sub(now))}
+}
+
+// The requests the burst still allows now. Must be called with l.mu held.
+func (l *GCRALimiter) remaining(now time.Time) int {
+	ahead := nonNegative(l.tat.Sub(now))
+	if ahead > l.tolerance {
+		return 0
+	}
+	return int((l.tolerance-ahead)/l.interval) + 1
+}
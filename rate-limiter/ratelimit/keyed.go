@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidMaxKeys  = errors.New("max keys must be at least 1")
+	ErrNegativeIdleTTL = errors.New("idle ttl cannot be negative")
+)
+
+// The configuration every per-key limiter of a KeyedRateLimiter is created from
+type Template struct {
+	MaxRpm        int
+	RampUpMinutes int
+	Options       []Option
+}
+
+func (t Template) newLimiter() (*TokenBucketRateLimiter, error) {
+	return NewTokenBucketRateLimiter(t.MaxRpm, t.RampUpMinutes, t.Options...)
+}
+
+// A KeyedRateLimiter holds a separate limiter per key, e.g. per API key, client IP or tenant, created on first use.
+// At most maxKeys limiters are kept: the least recently used one is evicted to make room for a new key, and keys
+// that have been idle for longer than the idle ttl are evicted as other keys are used. An evicted key that comes back
+// starts over from the initial capacity. Like the limiters themselves it needs no background goroutine, and it is
+// safe for concurrent use.
+type KeyedRateLimiter struct {
+	template Template
+	config   config
+	maxKeys  int
+	idleTTL  time.Duration // no ttl when 0
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *keyedEntry, most recently used first
+}
+
+type keyedEntry struct {
+	key      string
+	limiter  *TokenBucketRateLimiter
+	lastUsed time.Time
+}
+
+func NewKeyedRateLimiter(template Template, maxKeys int, idleTTL time.Duration) (*KeyedRateLimiter, error) {
+	probe, err := template.newLimiter()
+	if err != nil {
+		return nil, err
+	}
+	if maxKeys < 1 {
+		return nil, ErrInvalidMaxKeys
+	}
+	if idleTTL < 0 {
+		return nil, ErrNegativeIdleTTL
+	}
+	return &KeyedRateLimiter{
+		template: template,
+		config:   probe.config,
+		maxKeys:  maxKeys,
+		idleTTL:  idleTTL,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}, nil
+}
+
+func (k *KeyedRateLimiter) Accept(key string) bool {
+	return k.Limiter(key).Accept()
+}
+
+func (k *KeyedRateLimiter) AcceptN(key string, n int) bool {
+	return k.Limiter(key).AcceptN(n)
+}
+
+// The limiter of the key, created from the template if the key is new
+func (k *KeyedRateLimiter) Limiter(key string) *TokenBucketRateLimiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := k.config.clock.Now()
+	k.evictIdle(now)
+	if element, ok := k.entries[key]; ok {
+		entry := element.Value.(*keyedEntry)
+		entry.lastUsed = now
+		k.lru.MoveToFront(element)
+		return entry.limiter
+	}
+	limiter, _ := k.template.newLimiter() // the template was validated by NewKeyedRateLimiter
+	k.entries[key] = k.lru.PushFront(&keyedEntry{key: key, limiter: limiter, lastUsed: now})
+	for k.lru.Len() > k.maxKeys {
+		k.evict(k.lru.Back())
+	}
+	return limiter
+}
+
+// Changes the limits of the template and of every key's limiter, as TokenBucketRateLimiter.SetLimits does.
+// Invalid limits are rejected without changing any.
+func (k *KeyedRateLimiter) SetLimits(maxRpm, rampUpMinutes int) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	template := k.template
+	template.MaxRpm = maxRpm
+	template.RampUpMinutes = rampUpMinutes
+	if _, err := template.newLimiter(); err != nil {
+		return err
+	}
+	k.template = template
+	for element := k.lru.Front(); element != nil; element = element.Next() {
+		element.Value.(*keyedEntry).limiter.SetLimits(maxRpm, rampUpMinutes) // validated with the template
+	}
+	return nil
+}
+
+// The number of keys with a limiter
+func (k *KeyedRateLimiter) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.evictIdle(k.config.clock.Now())
+	return k.lru.Len()
+}
+
+func (k *KeyedRateLimiter) evict(element *list.Element) {
+	k.lru.Remove(element)
+	delete(k.entries, element.Value.(*keyedEntry).key)
+}
+
+// Evicts the keys that have been idle for longer than the idle ttl. Must be called with k.mu held.
+func (k *KeyedRateLimiter) evictIdle(now time.Time) {
+	if k.idleTTL == 0 {
+		return
+	}
+	for element := k.lru.Back(); element != nil && now.Sub(element.Value.(*keyedEntry).lastUsed) > k.idleTTL; element = k.lru.Back() {
+		k.evict(element)
+	}
+}
@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"errors"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+)
+
+func newTestKeyedRateLimiter(t *testing.T, maxKeys int, idleTTL time.Duration) (*KeyedRateLimiter, *ratelimittest.FakeClock) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	k, err := NewKeyedRateLimiter(Template{MaxRpm: 60, RampUpMinutes: 1, Options: []Option{WithClock(clock)}}, maxKeys, idleTTL)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	return k, clock
+}
+
+func TestNewKeyedRateLimiter(t *testing.T) {
+	tests := []struct {
+		template Template
+		maxKeys  int
+		idleTTL  time.Duration
+		err      error
+	}{
+		{Template{MaxRpm: 0}, 10, 0, ErrInvalidMaxRpm},
+		{Template{MaxRpm: 10, Options: []Option{WithScaleUpThreshold(1)}}, 10, 0, ErrScaleUpAboveScaleDown},
+		{Template{MaxRpm: 10}, 0, 0, ErrInvalidMaxKeys},
+		{Template{MaxRpm: 10}, 10, -time.Second, ErrNegativeIdleTTL},
+		{Template{MaxRpm: 10}, 10, time.Minute, nil},
+	}
+	for _, test := range tests {
+		if _, err := NewKeyedRateLimiter(test.template, test.maxKeys, test.idleTTL); !errors.Is(err, test.err) {
+			t.Errorf("Expected %v for %+v but got %v", test.err, test, err)
+		}
+	}
+}
+
+func TestKeysAreLimitedSeparately(t *testing.T) {
+	k, clock := newTestKeyedRateLimiter(t, 10, 0)
+	// every key starts off with 6 tokens (10% of 60)
+	for i := 0; i < 6; i++ {
+		if !k.Accept("a") {
+			t.Fatalf("Expected token %d of key a to be accepted", i+1)
+		}
+	}
+	if k.Accept("a") {
+		t.Errorf("Expected key a to be out of tokens")
+	}
+	if !k.AcceptN("b", 2) {
+		t.Errorf("Expected key b to have its own tokens")
+	}
+
+	advanceRefillInterval(clock)
+	if tokens, capacity := state(k.Limiter("a")); capacity != 16 || tokens != 1 {
+		t.Errorf("Expected the busy key to ramp up to 16 with 1 token but got %d with %d tokens", capacity, tokens)
+	}
+	if _, capacity := state(k.Limiter("b")); capacity != 6 {
+		t.Errorf("Expected the quiet key to keep its capacity of 6 but got %d", capacity)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	k, _ := newTestKeyedRateLimiter(t, 2, 0)
+	k.AcceptN("a", 6)
+	k.Accept("b")
+	k.Accept("a") // b is now the least recently used key
+	k.Accept("c")
+	if k.Len() != 2 {
+		t.Fatalf("Expected 2 keys but got %d", k.Len())
+	}
+	if k.Accept("a") {
+		t.Errorf("Expected key a to be kept with its empty bucket")
+	}
+	if !k.Accept("b") {
+		t.Errorf("Expected the evicted key b to start over with a full bucket")
+	}
+}
+
+func TestIdleTTLEviction(t *testing.T) {
+	k, clock := newTestKeyedRateLimiter(t, 10, 25*time.Second)
+	k.Accept("idle")
+	k.Accept("busy")
+	for i := 0; i < 3; i++ {
+		advanceRefillInterval(clock)
+		k.Accept("busy")
+	}
+	if k.Len() != 1 {
+		t.Errorf("Expected the idle key to be evicted after 30s but %d keys are left", k.Len())
+	}
+	k.mu.Lock()
+	_, ok := k.entries["busy"]
+	k.mu.Unlock()
+	if !ok {
+		t.Errorf("Expected the busy key to be kept")
+	}
+}
+
+func TestNoGoroutinePerKey(t *testing.T) {
+	k, _ := newTestKeyedRateLimiter(t, 10_000, 0)
+	before := runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				k.Accept(strconv.Itoa(worker*1000 + j))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if k.Len() != 8000 {
+		t.Errorf("Expected 8000 keys but got %d", k.Len())
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected no goroutines per key but the count went from %d to %d", before, after)
+	}
+}
+
+func TestKeyedSetLimits(t *testing.T) {
+	k, _ := newTestKeyedRateLimiter(t, 10, 0)
+	k.Accept("existing")
+	if err := k.SetLimits(600, 0); err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	for _, key := range []string{"existing", "new"} {
+		if _, capacity := state(k.Limiter(key)); capacity != 600 {
+			t.Errorf("Expected key %s to get the new limit of 600 but got %d", key, capacity)
+		}
+	}
+	if err := k.SetLimits(0, 1); !errors.Is(err, ErrInvalidMaxRpm) {
+		t.Errorf("Expected ErrInvalidMaxRpm but got %v", err)
+	}
+	if _, capacity := state(k.Limiter("another")); capacity != 600 {
+		t.Errorf("Expected the rejected limits not to change the template but a new key got %d", capacity)
+	}
+}
+
+func BenchmarkKeyedAccept(b *testing.B) {
+	k, _ := NewKeyedRateLimiter(Template{MaxRpm: 600, RampUpMinutes: 1}, 10_000, 0)
+	keys := make([]string, 10_000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k.Accept(keys[i%len(keys)])
+	}
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrQueueFull = errors.New("leaky bucket queue is full")
+
+// A LeakyBucketLimiter queues up to capacity requests and lets them leak out at limit requests per window.
+// Used through Wait, it shapes traffic: every request is delayed until it leaks out, so bursts are smoothed into
+// an even rate. Used through Accept, as a meter, it admits the same requests as a GCRALimiter with a burst of capacity.
+type LeakyBucketLimiter struct {
+	limit    int
+	capacity int
+	interval time.Duration // between two requests leaking out
+	clock    Clock
+	metrics  *limiterMetrics // nil without WithMetrics
+
+	mu      sync.Mutex
+	nextOut time.Time // when the next queued request may leak out
+}
+
+// Only the WithClock and WithMetrics options apply. The metrics report the room left in the queue as the tokens.
+func NewLeakyBucketLimiter(limit int, window time.Duration, capacity int, opts ...Option) (*LeakyBucketLimiter, error) {
+	interval, err := emissionInterval(limit, window)
+	if err != nil {
+		return nil, err
+	}
+	if capacity < 1 {
+		return nil, ErrInvalidBurst
+	}
+	clock, metrics, err := clockAndMetricsOf(limit, opts)
+	if err != nil {
+		return nil, err
+	}
+	metrics.observe(capacity, limit)
+	return &LeakyBucketLimiter{limit: limit, capacity: capacity, interval: interval, clock: clock, metrics: metrics}, nil
+}
+
+// Queues the request if there is room, without waiting for it to leak out
+func (l *LeakyBucketLimiter) Accept() bool {
+	_, ok := l.enqueue()
+	return ok
+}
+
+// Queues the request and blocks until it leaks out. Returns ErrQueueFull right away if there is no room,
+// and the context's error if it is done first (the request keeps its place in the queue).
+func (l *LeakyBucketLimiter) Wait(ctx context.Context) error {
+	delay, ok := l.enqueue()
+	if !ok {
+		return ErrQueueFull
+	}
+	if delay == 0 {
+		return nil
+	}
+	select {
+	case <-l.clock.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Returns how long the request has to wait to leak out, and false if the queue is full
+func (l *LeakyBucketLimiter) enqueue() (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	out := l.nextOut
+	if out.Before(now) {
+		out = now
+	}
+	accepted := l.queued(now) < l.capacity
+	if accepted {
+		l.nextOut = out.Add(l.interval)
+	}
+	l.metrics.request(accepted)
+	l.metrics.observe(l.capacity-l.queued(now), l.limit)
+	if !accepted {
+		return 0, false
+	}
+	return out.Sub(now), true
+}
+
+// The number of requests waiting to leak out. Must be called with l.mu held.
+func (l *LeakyBucketLimiter) queued(now time.Time) int {
+	ahead := nonNegative(l.nextOut.Sub(now))
+	return int((ahead + l.interval - 1) / l.interval)
+}
+
+func (l *LeakyBucketLimiter) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	return Status{Limit: l.limit, Remaining: l.capacity - l.queued(now), Reset: nonNegative(l.nextOut.Sub(now))}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidLimit  = errors.New("limit must be at least 1")
+	ErrInvalidWindow = errors.New("window must be positive")
+	ErrInvalidBurst  = errors.New("burst must be at least 1")
+	ErrLimitTooHigh  = errors.New("limit cannot be more than one request per nanosecond of the window")
+)
+
+// A Limiter decides whether requests may pass. All implementations are safe for concurrent use.
+type Limiter interface {
+	Accept() bool
+	Status() Status
+}
+
+// Implemented by limiters of concurrent requests, which need to hear back when a request they accepted completes
+type Releaser interface {
+	Release(latency time.Duration, dropped bool)
+}
+
+var (
+	_ Limiter  = (*TokenBucketRateLimiter)(nil)
+	_ Limiter  = (*FixedWindowLimiter)(nil)
+	_ Limiter  = (*SlidingWindowLogLimiter)(nil)
+	_ Limiter  = (*SlidingWindowCounterLimiter)(nil)
+	_ Limiter  = (*LeakyBucketLimiter)(nil)
+	_ Limiter  = (*GCRALimiter)(nil)
+	_ Limiter  = (*ConcurrencyLimiter)(nil)
+	_ Releaser = (*ConcurrencyLimiter)(nil)
+)
+
+// The clock and metrics of the options, for the limiters that have no other tuning and reject the token bucket's.
+// Their metrics report the limit as the capacity and the requests still allowed as the tokens.
+func clockAndMetricsOf(limit int, opts []Option) (Clock, *limiterMetrics, error) {
+	c, err := newConfig(limit, opts)
+	if err == nil {
+		err = c.verifyNoTokenBucketOptions()
+	}
+	if err != nil || c.metrics == nil {
+		return c.clock, nil, err
+	}
+	return c.clock, c.metrics.limiter(c.name), nil
+}
+
+func verifyLimit(limit int, window time.Duration) error {
+	if limit < 1 {
+		return ErrInvalidLimit
+	}
+	if window <= 0 {
+		return ErrInvalidWindow
+	}
+	return nil
+}
+
+// The time between two requests at limit requests per window, for the limiters that space requests out
+func emissionInterval(limit int, window time.Duration) (time.Duration, error) {
+	if err := verifyLimit(limit, window); err != nil {
+		return 0, err
+	}
+	interval := window / time.Duration(limit)
+	if interval == 0 {
+		return 0, ErrLimitTooHigh
+	}
+	return interval, nil
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+)
+
+func TestLimiterConstructorErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		new  func() error
+		err  error
+	}{
+		{"fixed window limit", func() error { _, err := NewFixedWindowLimiter(0, time.Minute); return err }, ErrInvalidLimit},
+		{"fixed window window", func() error { _, err := NewFixedWindowLimiter(10, 0); return err }, ErrInvalidWindow},
+		{"sliding window log limit", func() error { _, err := NewSlidingWindowLogLimiter(0, time.Minute); return err }, ErrInvalidLimit},
+		{"sliding window counter window", func() error { _, err := NewSlidingWindowCounterLimiter(10, -time.Second); return err }, ErrInvalidWindow},
+		{"leaky bucket capacity", func() error { _, err := NewLeakyBucketLimiter(10, time.Minute, 0); return err }, ErrInvalidBurst},
+		{"gcra burst", func() error { _, err := NewGCRALimiter(10, time.Minute, 0); return err }, ErrInvalidBurst},
+		{"leaky bucket interval", func() error { _, err := NewLeakyBucketLimiter(11, 10*time.Nanosecond, 1); return err }, ErrLimitTooHigh},
+		{"gcra interval", func() error { _, err := NewGCRALimiter(11, 10*time.Nanosecond, 1); return err }, ErrLimitTooHigh},
+		{"gcra clock", func() error { _, err := NewGCRALimiter(10, time.Minute, 1, WithClock(realClock{})); return err }, nil},
+	}
+	for _, test := range tests {
+		if err := test.new(); !errors.Is(err, test.err) {
+			t.Errorf("Expected %v for %s but got %v", test.err, test.name, err)
+		}
+	}
+}
+
+func TestLimiterStatus(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		new      func(clock Clock) Limiter
+		accepts  int
+		expected Status // after the accepts, 15s into the minute
+	}{
+		{"fixed window", func(clock Clock) Limiter {
+			l, _ := NewFixedWindowLimiter(10, time.Minute, WithClock(clock))
+			return l
+		}, 4, Status{Limit: 10, Remaining: 6, Reset: 45 * time.Second}},
+		{"sliding window log", func(clock Clock) Limiter {
+			l, _ := NewSlidingWindowLogLimiter(10, time.Minute, WithClock(clock))
+			return l
+		}, 4, Status{Limit: 10, Remaining: 6, Reset: time.Minute}},
+		{"sliding window counter", func(clock Clock) Limiter {
+			l, _ := NewSlidingWindowCounterLimiter(10, time.Minute, WithClock(clock))
+			return l
+		}, 4, Status{Limit: 10, Remaining: 6, Reset: 45 * time.Second}},
+		{"leaky bucket", func(clock Clock) Limiter {
+			l, _ := NewLeakyBucketLimiter(10, time.Minute, 5, WithClock(clock))
+			return l
+		}, 4, Status{Limit: 10, Remaining: 1, Reset: 24 * time.Second}},
+		{"gcra", func(clock Clock) Limiter {
+			l, _ := NewGCRALimiter(10, time.Minute, 5, WithClock(clock))
+			return l
+		}, 4, Status{Limit: 10, Remaining: 1, Reset: 24 * time.Second}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := ratelimittest.NewFakeClock(start.Add(15 * time.Second))
+			l := test.new(clock)
+			for i := 0; i < test.accepts; i++ {
+				if !l.Accept() {
+					t.Fatalf("Expected request %d to be accepted", i+1)
+				}
+			}
+			if status := l.Status(); status != test.expected {
+				t.Errorf("Expected %+v but got %+v", test.expected, status)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowCounterWeighsPreviousWindow(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	l, _ := NewSlidingWindowCounterLimiter(10, time.Minute, WithClock(clock))
+	for i := 0; i < 10; i++ {
+		l.Accept()
+	}
+	clock.Advance(90 * time.Second) // half of the previous window overlaps the sliding window
+	accepted := 0
+	for l.Accept() {
+		accepted++
+	}
+	if accepted != 5 {
+		t.Errorf("Expected 5 requests to be accepted with half of the previous 10 counting but got %d", accepted)
+	}
+	clock.Advance(2 * time.Minute)
+	if status := l.Status(); status.Remaining != 10 {
+		t.Errorf("Expected the full limit after two idle windows but got %+v", status)
+	}
+}
+
+func TestLeakyBucketShapesTraffic(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	l, _ := NewLeakyBucketLimiter(60, time.Minute, 3, WithClock(clock))
+	done := make(chan time.Time, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			if err := l.Wait(context.Background()); err != nil {
+				t.Errorf("Got unexpected error: %v", err)
+			}
+			done <- clock.Now()
+		}()
+	}
+	clock.BlockUntil(2) // the first request leaks out right away, the others wait for their turn
+	if err := l.Wait(context.Background()); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull but got %v", err)
+	}
+	start := clock.Now()
+	for i := 0; i < 2; i++ {
+		clock.Advance(time.Second)
+	}
+	var delays []time.Duration
+	for i := 0; i < 3; i++ {
+		delays = append(delays, (<-done).Sub(start))
+	}
+	if delays[0] != 0 || delays[2] != 2*time.Second {
+		t.Errorf("Expected the requests to leak out a second apart but got %v", delays)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.Accept() // queued behind the last request, so the next one has to wait
+	errs := make(chan error)
+	go func() { errs <- l.Wait(ctx) }()
+	clock.BlockUntil(1)
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+}
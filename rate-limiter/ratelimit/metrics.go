@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ErrEmptyLimiterName = errors.New("limiter name for the metrics cannot be empty")
+
+// The Prometheus metrics of token bucket limiters, labelled with the name of each limiter so that any number of
+// limiters in a process can share them. Limiters report to them when created with WithMetrics.
+type Metrics struct {
+	capacity    *prometheus.GaugeVec
+	tokens      *prometheus.GaugeVec
+	ramping     *prometheus.GaugeVec
+	requests    *prometheus.CounterVec
+	priorities  *prometheus.CounterVec
+	scaleEvents *prometheus.CounterVec
+}
+
+// Creates the metrics and registers them with the registerer, e.g. prometheus.DefaultRegisterer or the
+// prometheus.NewRegistry() of a test
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		capacity: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rate_limiter_capacity",
+			Help: "The current capacity of the bucket measured in rpm",
+		}, []string{"limiter"}),
+		tokens: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rate_limiter_tokens",
+			Help: "The tokens in the bucket, negative while reservations wait for tokens to be added",
+		}, []string{"limiter"}),
+		ramping: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rate_limiter_ramping",
+			Help: "How the capacity was last adjusted: 1 scaled up, -1 scaled down, 0 held",
+		}, []string{"limiter"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rate_limiter_requests_total",
+			Help: "Requests the limiter accepted or rejected",
+		}, []string{"limiter", "result"}),
+		priorities: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rate_limiter_priority_requests_total",
+			Help: "Requests of each priority the limiter accepted or rejected",
+		}, []string{"limiter", "priority", "result"}),
+		scaleEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rate_limiter_scale_events_total",
+			Help: "Times the capacity was scaled up or down",
+		}, []string{"limiter", "direction"}),
+	}
+	for _, collector := range []prometheus.Collector{m.capacity, m.tokens, m.ramping, m.requests, m.priorities, m.scaleEvents} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// The metrics of a single limiter. A nil *limiterMetrics reports nothing.
+type limiterMetrics struct {
+	name       string
+	priorities *prometheus.CounterVec
+	capacity   prometheus.Gauge
+	tokens     prometheus.Gauge
+	ramping    prometheus.Gauge
+	accepted   prometheus.Counter
+	rejected   prometheus.Counter
+	scaledUp   prometheus.Counter
+	scaledDown prometheus.Counter
+}
+
+func (m *Metrics) limiter(name string) *limiterMetrics {
+	return &limiterMetrics{
+		name:       name,
+		priorities: m.priorities,
+		capacity:   m.capacity.WithLabelValues(name),
+		tokens:     m.tokens.WithLabelValues(name),
+		ramping:    m.ramping.WithLabelValues(name),
+		accepted:   m.requests.WithLabelValues(name, "accepted"),
+		rejected:   m.requests.WithLabelValues(name, "rejected"),
+		scaledUp:   m.scaleEvents.WithLabelValues(name, "up"),
+		scaledDown: m.scaleEvents.WithLabelValues(name, "down"),
+	}
+}
+
+func (m *limiterMetrics) observe(tokens, capacity int) {
+	if m == nil {
+		return
+	}
+	m.tokens.Set(float64(tokens))
+	m.capacity.Set(float64(capacity))
+}
+
+func (m *limiterMetrics) request(accepted bool) {
+	if m == nil {
+		return
+	}
+	if accepted {
+		m.accepted.Inc()
+	} else {
+		m.rejected.Inc()
+	}
+}
+
+// Records a request of the priority, on top of request
+func (m *limiterMetrics) prioritized(p Priority, accepted bool) {
+	if m == nil {
+		return
+	}
+	result := "rejected"
+	if accepted {
+		result = "accepted"
+	}
+	m.priorities.WithLabelValues(m.name, p.String(), result).Inc()
+}
+
+// Records a scaling of the capacity by delta, which is 0 when it was held
+func (m *limiterMetrics) scaled(delta int) {
+	if m == nil {
+		return
+	}
+	switch {
+	case delta > 0:
+		m.ramping.Set(1)
+		m.scaledUp.Inc()
+	case delta < 0:
+		m.ramping.Set(-1)
+		m.scaledDown.Inc()
+	default:
+		m.ramping.Set(0)
+	}
+}
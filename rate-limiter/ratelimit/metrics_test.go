@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestMetrics(t *testing.T) *Metrics {
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	return metrics
+}
+
+func TestMetricsPerLimiter(t *testing.T) {
+	metrics := newTestMetrics(t)
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	a, _ := NewTokenBucketRateLimiter(60, 1, WithClock(clock), WithMetrics(metrics, "a")) // starts at 6
+	b, _ := NewTokenBucketRateLimiter(600, 0, WithClock(clock), WithMetrics(metrics, "b"))
+
+	consume(a, 8)
+	b.AcceptN(100)
+	tests := []struct {
+		metric   prometheus.Collector
+		expected float64
+	}{
+		{metrics.capacity.WithLabelValues("a"), 6},
+		{metrics.capacity.WithLabelValues("b"), 600},
+		{metrics.tokens.WithLabelValues("a"), 0},
+		{metrics.tokens.WithLabelValues("b"), 500},
+		{metrics.requests.WithLabelValues("a", "accepted"), 6},
+		{metrics.requests.WithLabelValues("a", "rejected"), 1}, // consume stops at the first rejection
+		{metrics.requests.WithLabelValues("b", "accepted"), 1},
+	}
+	for _, test := range tests {
+		if got := testutil.ToFloat64(test.metric); got != test.expected {
+			t.Errorf("Expected %v but got %v", test.expected, got)
+		}
+	}
+}
+
+func TestScaleEventMetrics(t *testing.T) {
+	metrics := newTestMetrics(t)
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	rl, _ := NewTokenBucketRateLimiter(60, 1, WithClock(clock), WithMetrics(metrics, "rl"))
+	ramping := metrics.ramping.WithLabelValues("rl")
+
+	for i := 0; i < 3; i++ {
+		consume(rl, 1000)
+		advanceRefillInterval(clock)
+		rl.Status()
+	}
+	if got := testutil.ToFloat64(metrics.scaleEvents.WithLabelValues("rl", "up")); got != 3 {
+		t.Errorf("Expected 3 scale ups but got %v", got)
+	}
+	if got := testutil.ToFloat64(ramping); got != 1 {
+		t.Errorf("Expected the ramping state to be up but got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.capacity.WithLabelValues("rl")); got != 36 {
+		t.Errorf("Expected a capacity of 36 but got %v", got)
+	}
+
+	// idle: scales up three more times while the bucket fills up, then down from 60 to 1
+	clock.Advance(10 * time.Minute)
+	rl.Status()
+	if up, down := testutil.ToFloat64(metrics.scaleEvents.WithLabelValues("rl", "up")), testutil.ToFloat64(metrics.scaleEvents.WithLabelValues("rl", "down")); up != 6 || down != 6 {
+		t.Errorf("Expected 6 scale ups and 6 scale downs but got %v and %v", up, down)
+	}
+	if got := testutil.ToFloat64(ramping); got != 0 {
+		t.Errorf("Expected the capacity to be held at the min capacity but got %v", got)
+	}
+}
+
+func TestMetricsRegistration(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if _, err := NewMetrics(registry); err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if _, err := NewMetrics(registry); !errors.As(err, &alreadyRegistered) {
+		t.Errorf("Expected registering the metrics twice to fail but got %v", err)
+	}
+}
+
+func TestMetricsOfOtherLimiters(t *testing.T) {
+	metrics := newTestMetrics(t)
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name string
+		new  func(opts ...Option) (Limiter, error)
+	}{
+		{"fixed", func(opts ...Option) (Limiter, error) { return NewFixedWindowLimiter(3, time.Minute, opts...) }},
+		{"log", func(opts ...Option) (Limiter, error) { return NewSlidingWindowLogLimiter(3, time.Minute, opts...) }},
+		{"counter", func(opts ...Option) (Limiter, error) { return NewSlidingWindowCounterLimiter(3, time.Minute, opts...) }},
+		{"leaky", func(opts ...Option) (Limiter, error) { return NewLeakyBucketLimiter(3, time.Minute, 3, opts...) }},
+		{"gcra", func(opts ...Option) (Limiter, error) { return NewGCRALimiter(3, time.Minute, 3, opts...) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, err := test.new(WithClock(clock), WithMetrics(metrics, test.name))
+			if err != nil {
+				t.Fatalf("Got unexpected error: %q", err)
+			}
+			for i := 0; i < 4; i++ { // the last one is rejected
+				l.Accept()
+			}
+			expected := []struct {
+				metric   prometheus.Collector
+				expected float64
+			}{
+				{metrics.requests.WithLabelValues(test.name, "accepted"), 3},
+				{metrics.requests.WithLabelValues(test.name, "rejected"), 1},
+				{metrics.capacity.WithLabelValues(test.name), 3},
+				{metrics.tokens.WithLabelValues(test.name), 0},
+			}
+			for _, e := range expected {
+				if got := testutil.ToFloat64(e.metric); got != e.expected {
+					t.Errorf("Expected %v but got %v", e.expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultRefillInterval            = 10 * time.Second
+	defaultScaleUpThreshold          = 0.4 // available tokens vs capacity
+	defaultScaleDownThreshold        = 0.9 // available tokens vs capacity
+	defaultInitialCapacityPercentage = 0.1 // start off with 10% of the maxRpm
+	defaultMinCapacity               = 1
+)
+
+var (
+	ErrInvalidMaxRpm               = errors.New("maxRpm must be at least 1")
+	ErrNegativeRampUp              = errors.New("ramp up minutes cannot be negative")
+	ErrInvalidRefillInterval       = errors.New("refill interval must be positive and at most a minute")
+	ErrThresholdOutOfRange         = errors.New("scale thresholds must be between 0 and 1")
+	ErrScaleUpAboveScaleDown       = errors.New("scale up threshold cannot be above the scale down threshold")
+	ErrInvalidInitialCapacity      = errors.New("initial capacity percentage must be above 0 and at most 1")
+	ErrInvalidMinCapacity          = errors.New("min capacity must be at least 1 and at most maxRpm")
+	ErrInitialCapacityBelowMinimum = errors.New("initial capacity cannot be below the min capacity")
+	ErrUnsupportedOption           = errors.New("option is not supported by this limiter")
+)
+
+// Tuning of a TokenBucketRateLimiter, set through Options
+type config struct {
+	refillInterval            time.Duration
+	scaleUpThreshold          float64
+	scaleDownThreshold        float64
+	initialCapacityPercentage float64
+	minCapacity               int
+	clock                     Clock
+	metrics                   *Metrics
+	name                      string // of the limiter in the metrics
+	reserves                  []reserve
+	tokenBucketOptions        []string // names of the options set that only a TokenBucketRateLimiter supports
+}
+
+type Option func(*config)
+
+// How often the capacity is scaled up or down (10s by default). Tokens are added continuously in between.
+func WithRefillInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.refillInterval = d
+		c.tokenBucketOption("WithRefillInterval")
+	}
+}
+
+// The capacity is scaled up when less than this share of it is left in the bucket at a refill (0.4 by default)
+func WithScaleUpThreshold(threshold float64) Option {
+	return func(c *config) {
+		c.scaleUpThreshold = threshold
+		c.tokenBucketOption("WithScaleUpThreshold")
+	}
+}
+
+// The capacity is scaled down when more than this share of it is left in the bucket at a refill (0.9 by default)
+func WithScaleDownThreshold(threshold float64) Option {
+	return func(c *config) {
+		c.scaleDownThreshold = threshold
+		c.tokenBucketOption("WithScaleDownThreshold")
+	}
+}
+
+// The share of maxRpm to start off with when ramping up (0.1 by default)
+func WithInitialCapacityPercentage(percentage float64) Option {
+	return func(c *config) {
+		c.initialCapacityPercentage = percentage
+		c.tokenBucketOption("WithInitialCapacityPercentage")
+	}
+}
+
+// The capacity never scales down below this number of requests per minute (1 by default)
+func WithMinCapacity(rpm int) Option {
+	return func(c *config) {
+		c.minCapacity = rpm
+		c.tokenBucketOption("WithMinCapacity")
+	}
+}
+
+// Times the refills, e.g. with a FakeClock in tests
+func WithClock(clock Clock) Option {
+	return func(c *config) { c.clock = clock }
+}
+
+// Reports the limiter's capacity, tokens, scaling and requests to the metrics, labelled with the name.
+// Limiters with the same name, like those of a KeyedRateLimiter, add up their counters and overwrite each other's gauges.
+func WithMetrics(metrics *Metrics, name string) Option {
+	return func(c *config) {
+		c.metrics = metrics
+		c.name = name
+	}
+}
+
+func (c *config) tokenBucketOption(name string) {
+	c.tokenBucketOptions = append(c.tokenBucketOptions, name)
+}
+
+// Fails on the options that only a TokenBucketRateLimiter supports, for the other limiters
+func (c config) verifyNoTokenBucketOptions() error {
+	if len(c.tokenBucketOptions) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnsupportedOption, c.tokenBucketOptions[0])
+	}
+	return nil
+}
+
+func newConfig(maxRpm int, opts []Option) (config, error) {
+	c := config{
+		refillInterval:            defaultRefillInterval,
+		scaleUpThreshold:          defaultScaleUpThreshold,
+		scaleDownThreshold:        defaultScaleDownThreshold,
+		initialCapacityPercentage: defaultInitialCapacityPercentage,
+		minCapacity:               defaultMinCapacity,
+		clock:                     realClock{},
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.refillInterval <= 0 || c.refillInterval > time.Minute {
+		return c, ErrInvalidRefillInterval
+	}
+	if c.scaleUpThreshold < 0 || c.scaleUpThreshold > 1 || c.scaleDownThreshold < 0 || c.scaleDownThreshold > 1 {
+		return c, ErrThresholdOutOfRange
+	}
+	if c.scaleUpThreshold > c.scaleDownThreshold {
+		return c, ErrScaleUpAboveScaleDown
+	}
+	if c.initialCapacityPercentage <= 0 || c.initialCapacityPercentage > 1 {
+		return c, ErrInvalidInitialCapacity
+	}
+	if c.minCapacity < 1 || c.minCapacity > maxRpm {
+		return c, ErrInvalidMinCapacity
+	}
+	if c.metrics != nil && c.name == "" {
+		return c, ErrEmptyLimiterName
+	}
+	if err := verifyReserves(c.reserves); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// How much the capacity is scaled by at every refill interval to ramp up to maxRpm within rampUpMinutes, 0 without
+// ramp-up
+func (c config) rampingDelta(maxRpm, rampUpMinutes int) int {
+	if rampUpMinutes == 0 {
+		return 0
+	}
+	return max(c.perRefill(maxRpm)/rampUpMinutes, 1)
+}
+
+// Converts a per-minute rate to the amount per refill interval, rounded down
+func (c config) perRefill(rpm int) int {
+	return int(int64(rpm) * int64(c.refillInterval) / int64(time.Minute))
+}
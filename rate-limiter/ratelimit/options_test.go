@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+)
+
+func TestInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		err  error
+	}{
+		{"zero refill interval", []Option{WithRefillInterval(0)}, ErrInvalidRefillInterval},
+		{"refill interval above a minute", []Option{WithRefillInterval(2 * time.Minute)}, ErrInvalidRefillInterval},
+		{"negative scale up threshold", []Option{WithScaleUpThreshold(-0.1)}, ErrThresholdOutOfRange},
+		{"scale down threshold above 1", []Option{WithScaleDownThreshold(1.1)}, ErrThresholdOutOfRange},
+		{"scale up above scale down", []Option{WithScaleUpThreshold(0.8), WithScaleDownThreshold(0.5)}, ErrScaleUpAboveScaleDown},
+		{"scale up above default scale down", []Option{WithScaleUpThreshold(0.95)}, ErrScaleUpAboveScaleDown},
+		{"zero initial capacity", []Option{WithInitialCapacityPercentage(0)}, ErrInvalidInitialCapacity},
+		{"initial capacity above max", []Option{WithInitialCapacityPercentage(1.5)}, ErrInvalidInitialCapacity},
+		{"zero min capacity", []Option{WithMinCapacity(0)}, ErrInvalidMinCapacity},
+		{"min capacity above max rpm", []Option{WithMinCapacity(101)}, ErrInvalidMinCapacity},
+		{"metrics without a name", []Option{WithMetrics(&Metrics{}, "")}, ErrEmptyLimiterName},
+		{"zero reserve", []Option{WithReserve(PriorityHigh, 0)}, ErrInvalidReserve},
+		{"two reserves of a priority", []Option{WithReserve(PriorityHigh, 0.1), WithReserve(PriorityHigh, 0.2)}, ErrInvalidReserve},
+		{"reserves of the whole capacity", []Option{WithReserve(PriorityHigh, 0.5), WithReserve(PriorityCritical, 0.5)}, ErrInvalidReserve},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewTokenBucketRateLimiter(100, 5, test.opts...); !errors.Is(err, test.err) {
+				t.Errorf("Expected %v but got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestTokenBucketOptionsRejectedByOtherLimiters(t *testing.T) {
+	constructors := map[string]func(opts ...Option) error{
+		"fixed window": func(opts ...Option) error {
+			_, err := NewFixedWindowLimiter(100, time.Minute, opts...)
+			return err
+		},
+		"sliding window log": func(opts ...Option) error {
+			_, err := NewSlidingWindowLogLimiter(100, time.Minute, opts...)
+			return err
+		},
+		"sliding window counter": func(opts ...Option) error {
+			_, err := NewSlidingWindowCounterLimiter(100, time.Minute, opts...)
+			return err
+		},
+		"leaky bucket": func(opts ...Option) error {
+			_, err := NewLeakyBucketLimiter(100, time.Minute, 10, opts...)
+			return err
+		},
+		"gcra": func(opts ...Option) error {
+			_, err := NewGCRALimiter(100, time.Minute, 10, opts...)
+			return err
+		},
+		"concurrency": func(opts ...Option) error {
+			_, err := NewConcurrencyLimiter(10, 1, 100, &AIMD{}, opts...)
+			return err
+		},
+	}
+	metrics := newTestMetrics(t)
+	for name, newLimiter := range constructors {
+		for _, opt := range []Option{WithReserve(PriorityCritical, 0.1), WithRefillInterval(time.Second), WithMinCapacity(5)} {
+			if err := newLimiter(opt); !errors.Is(err, ErrUnsupportedOption) {
+				t.Errorf("Expected ErrUnsupportedOption from the %s limiter but got %v", name, err)
+			}
+		}
+		if err := newLimiter(WithMetrics(metrics, name)); err != nil {
+			t.Errorf("Got unexpected error from the %s limiter: %v", name, err)
+		}
+	}
+	if _, err := NewConcurrencyLimiter(10, 1, 100, &AIMD{}, WithClock(ratelimittest.NewFakeClock(time.Time{}))); !errors.Is(err, ErrUnsupportedOption) {
+		t.Errorf("Expected ErrUnsupportedOption for a clock of the concurrency limiter but got %v", err)
+	}
+}
+
+func TestValidOptions(t *testing.T) {
+	rl, err := NewTokenBucketRateLimiter(600, 2, WithRefillInterval(time.Second), WithScaleUpThreshold(0.5), WithScaleDownThreshold(0.5),
+		WithInitialCapacityPercentage(0.25), WithMinCapacity(100))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	if rl.currentCapacity != 150 {
+		t.Errorf("Expected initial capacity of 150 (0.25 * maxRpm) but got %d", rl.currentCapacity)
+	}
+	if rl.rampingDelta != 5 { // 10 tokens per refill spread over 2 minutes
+		t.Errorf("Expected delta to be 5 but it was %d", rl.rampingDelta)
+	}
+}
+
+func TestMinCapacityFloor(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	rl, err := NewTokenBucketRateLimiter(60, 1, WithClock(clock), WithMinCapacity(25), WithInitialCapacityPercentage(1))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+
+	// without demand the capacity scales down, but not below the floor
+	for i := 0; i < 20; i++ {
+		advanceRefillInterval(clock)
+	}
+	if _, capacity := state(rl); capacity != 25 {
+		t.Errorf("Expected the capacity to stop scaling down at 25 but got %d", capacity)
+	}
+}
+
+func TestMinCapacityAsStartCapacity(t *testing.T) {
+	rl, _ := NewTokenBucketRateLimiter(100, 5, WithMinCapacity(30))
+	if rl.currentCapacity != 30 || rl.tokens != 30 {
+		t.Errorf("Expected to start off at the min capacity of 30 but got capacity=%d and tokens=%d", rl.currentCapacity, rl.tokens)
+	}
+}
+
+func TestCustomRefillInterval(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	rl, _ := NewTokenBucketRateLimiter(600, 1, WithClock(clock), WithRefillInterval(time.Second))
+
+	// scaled 60 times per minute by 10 tokens each: ramps up from 60 to 600 within a minute under load
+	for i := 0; i < 60; i++ {
+		consume(rl, 1000)
+		clock.Advance(time.Second)
+	}
+	if _, capacity := state(rl); capacity != 600 {
+		t.Errorf("Expected to reach maxRpm within a minute but capacity is %d", capacity)
+	}
+}
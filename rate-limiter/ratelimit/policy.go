@@ -0,0 +1,166 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidPollInterval = errors.New("poll interval must be positive")
+
+// The limits of a rate limiter, as read from a JSON or YAML policy file, e.g.
+//
+//	maxRpm: 600
+//	rampUpMinutes: 5
+type Policy struct {
+	MaxRpm        int `json:"maxRpm" yaml:"maxRpm"`
+	RampUpMinutes int `json:"rampUpMinutes" yaml:"rampUpMinutes"`
+}
+
+func (p Policy) Validate() error {
+	if p.MaxRpm < 1 {
+		return ErrInvalidMaxRpm
+	}
+	if p.RampUpMinutes < 0 {
+		return ErrNegativeRampUp
+	}
+	return nil
+}
+
+// Implemented by the limiters whose limits can be changed at runtime
+type Reconfigurable interface {
+	SetLimits(maxRpm, rampUpMinutes int) error
+}
+
+var (
+	_ Reconfigurable = (*TokenBucketRateLimiter)(nil)
+	_ Reconfigurable = (*KeyedRateLimiter)(nil)
+)
+
+// Reads and validates a policy file: YAML if its extension is .yaml or .yml, JSON otherwise. Unknown fields are
+// rejected, so that a misspelt limit doesn't go unnoticed.
+func LoadPolicy(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, err
+	}
+	return parsePolicy(path, data)
+}
+
+func parsePolicy(path string, data []byte) (Policy, error) {
+	var p Policy
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err := decoder.Decode(&p)
+		if err != nil {
+			return p, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&p)
+		if err != nil {
+			return p, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return p, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// A PolicyWatcher keeps the limits of a limiter in line with a policy file. It reloads the file when its contents
+// change, and whenever the process receives SIGHUP, even if they didn't. A policy that fails to load or validate is
+// logged and ignored, and the limiter keeps its current limits.
+type PolicyWatcher struct {
+	path         string
+	target       Reconfigurable
+	pollInterval time.Duration
+	signals      chan os.Signal
+
+	mu     sync.Mutex // serializes reloads
+	loaded []byte     // contents of the policy file last applied or rejected
+
+	reloaded func(err error) // called by Run after every reload, for tests
+}
+
+// Applies the policy file to the target, and returns a watcher that keeps doing so once it runs. Fails if the
+// policy file can't be applied in the first place.
+func NewPolicyWatcher(path string, target Reconfigurable, pollInterval time.Duration) (*PolicyWatcher, error) {
+	if pollInterval <= 0 {
+		return nil, ErrInvalidPollInterval
+	}
+	w := &PolicyWatcher{path: path, target: target, pollInterval: pollInterval, signals: make(chan os.Signal, 1)}
+	if err := w.reload(true); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Loads the policy file and applies it to the target if its contents changed since they were last loaded.
+// A rejected policy is only reported once, and tried again when the file changes.
+func (w *PolicyWatcher) Reload() error {
+	return w.reload(false)
+}
+
+// Like Reload, but when forced also applies or reports contents that were already loaded
+func (w *PolicyWatcher) reload(force bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+	if !force && w.loaded != nil && bytes.Equal(data, w.loaded) {
+		return nil
+	}
+	w.loaded = data
+	p, err := parsePolicy(w.path, data)
+	if err != nil {
+		return err
+	}
+	if err := w.target.SetLimits(p.MaxRpm, p.RampUpMinutes); err != nil {
+		return fmt.Errorf("%s: %w", w.path, err)
+	}
+	log.Infof("Applied policy %s: %+v", w.path, p)
+	return nil
+}
+
+// Polls the policy file and listens for SIGHUP until the context is done
+func (w *PolicyWatcher) Run(ctx context.Context) {
+	signal.Notify(w.signals, syscall.SIGHUP)
+	defer signal.Stop(w.signals)
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	for {
+		force := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.signals:
+			log.Infof("Reloading policy %s on SIGHUP", w.path)
+			force = true
+		}
+		err := w.reload(force)
+		if err != nil {
+			log.Errorf("Keeping the current limits: %s", err)
+		}
+		if w.reloaded != nil {
+			w.reloaded(err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writePolicy(t *testing.T, path, contents string) {
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		file     string
+		contents string
+		expected Policy
+		err      error
+	}{
+		{"policy.json", `{"maxRpm": 600, "rampUpMinutes": 5}`, Policy{600, 5}, nil},
+		{"policy.yaml", "maxRpm: 600\nrampUpMinutes: 5\n", Policy{600, 5}, nil},
+		{"policy.yml", "maxRpm: 60\n", Policy{60, 0}, nil},
+		{"policy.json", `{"maxRpm": 0}`, Policy{}, ErrInvalidMaxRpm},
+		{"policy.yaml", "maxRpm: 60\nrampUpMinutes: -1\n", Policy{}, ErrNegativeRampUp},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), test.file)
+		writePolicy(t, path, test.contents)
+		p, err := LoadPolicy(path)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Expected %v for %q but got %v", test.err, test.contents, err)
+		}
+		if err == nil && p != test.expected {
+			t.Errorf("Expected %+v for %q but got %+v", test.expected, test.contents, p)
+		}
+	}
+
+	for _, invalid := range []struct{ file, contents string }{
+		{"policy.json", `{"maxRpm": 600, "rampUpMinute": 5}`},
+		{"policy.yaml", "maxRpm: 600\nrampUpMinute: 5\n"},
+		{"policy.json", `{"maxRpm": "fast"}`},
+	} {
+		path := filepath.Join(t.TempDir(), invalid.file)
+		writePolicy(t, path, invalid.contents)
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("Expected an error for %q", invalid.contents)
+		}
+	}
+}
+
+// Records the limits applied to it
+type limitsRecorder chan Policy
+
+func (r limitsRecorder) SetLimits(maxRpm, rampUpMinutes int) error {
+	r <- Policy{maxRpm, rampUpMinutes}
+	return nil
+}
+
+func expectLimits(t *testing.T, r limitsRecorder, expected Policy) {
+	select {
+	case p := <-r:
+		if p != expected {
+			t.Errorf("Expected %+v to be applied but got %+v", expected, p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected %+v to be applied", expected)
+	}
+}
+
+func runWatcher(t *testing.T, w *PolicyWatcher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		w.Run(ctx)
+		done <- true
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestPolicyWatcherReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, "maxRpm: 600\nrampUpMinutes: 5\n")
+	recorder := make(limitsRecorder, 10)
+	w, err := NewPolicyWatcher(path, recorder, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	expectLimits(t, recorder, Policy{600, 5})
+	rejected := make(chan error, 10)
+	w.reloaded = func(err error) {
+		if err != nil {
+			rejected <- err
+		}
+	}
+	runWatcher(t, w)
+
+	writePolicy(t, path, "maxRpm: 1200\nrampUpMinutes: 5\n")
+	expectLimits(t, recorder, Policy{1200, 5})
+
+	// an invalid policy is ignored until it is fixed
+	writePolicy(t, path, "maxRpm: 0\n")
+	for timeout := time.After(5 * time.Second); ; {
+		select {
+		case err := <-rejected:
+			if !errors.Is(err, ErrInvalidMaxRpm) {
+				continue // e.g. a file that is only partly written
+			}
+		case <-timeout:
+			t.Fatalf("Expected the invalid policy to be rejected")
+		}
+		break
+	}
+	writePolicy(t, path, "maxRpm: 300\n")
+	expectLimits(t, recorder, Policy{300, 0})
+	if len(recorder) != 0 {
+		t.Errorf("Expected unchanged policies not to be applied again but got %+v", <-recorder)
+	}
+}
+
+func TestPolicyWatcherReportsRejectedPolicyOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, "maxRpm: 600\n")
+	recorder := make(limitsRecorder, 10)
+	w, err := NewPolicyWatcher(path, recorder, time.Hour)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	expectLimits(t, recorder, Policy{600, 0})
+
+	writePolicy(t, path, "maxRpm: 0\n")
+	if err := w.Reload(); !errors.Is(err, ErrInvalidMaxRpm) {
+		t.Errorf("Expected ErrInvalidMaxRpm but got %v", err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Errorf("Expected the unchanged rejected policy not to be reported again but got %v", err)
+	}
+	writePolicy(t, path, "maxRpm: 0\nrampUpMinutes: 1\n")
+	if err := w.Reload(); !errors.Is(err, ErrInvalidMaxRpm) {
+		t.Errorf("Expected a changed policy to be tried again but got %v", err)
+	}
+	if len(recorder) != 0 {
+		t.Errorf("Expected no rejected policy to be applied but got %+v", <-recorder)
+	}
+}
+
+func TestPolicyWatcherReloadsOnSIGHUP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, path, `{"maxRpm": 600, "rampUpMinutes": 5}`)
+	recorder := make(limitsRecorder, 10)
+	w, _ := NewPolicyWatcher(path, recorder, time.Hour)
+	expectLimits(t, recorder, Policy{600, 5})
+	runWatcher(t, w)
+
+	writePolicy(t, path, `{"maxRpm": 60, "rampUpMinutes": 1}`)
+	w.signals <- syscall.SIGHUP
+	expectLimits(t, recorder, Policy{60, 1})
+
+	// e.g. to restore limits that were changed by other means since
+	w.signals <- syscall.SIGHUP
+	expectLimits(t, recorder, Policy{60, 1})
+}
+
+func TestNewPolicyWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, path, `{"maxRpm": 600}`)
+	rl, _ := NewTokenBucketRateLimiter(100, 0)
+	if _, err := NewPolicyWatcher(path, rl, 0); err != ErrInvalidPollInterval {
+		t.Errorf("Expected ErrInvalidPollInterval but got %v", err)
+	}
+	if _, err := NewPolicyWatcher(filepath.Join(t.TempDir(), "missing.json"), rl, time.Second); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing policy file to fail but got %v", err)
+	}
+	if _, err := NewPolicyWatcher(path, rl, time.Second); err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	if _, capacity := state(rl); capacity != 600 {
+		t.Errorf("Expected the policy to be applied right away but the capacity is %d", capacity)
+	}
+}
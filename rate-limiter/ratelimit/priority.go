@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"errors"
+	"strconv"
+)
+
+var ErrInvalidReserve = errors.New("reserves must be above 0, one per priority, and add up to less than 1")
+
+// How important a request is. While the bucket runs low, requests of a priority are only accepted as long as the
+// tokens reserved for the priorities above it are left in the bucket. Priorities are ordered by their value, so
+// any int works, but the named ones cover the usual classes of traffic.
+type Priority int
+
+const (
+	PriorityLow      Priority = -1 // e.g. batch jobs and crawlers
+	PriorityNormal   Priority = 0  // what Accept, AcceptN and Status use
+	PriorityHigh     Priority = 1  // e.g. the paid tier
+	PriorityCritical Priority = 2  // e.g. health checks
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	}
+	return strconv.Itoa(int(p))
+}
+
+// Implemented by limiters that tell requests of different priorities apart, e.g. a TokenBucketRateLimiter created
+// with WithReserve
+type PriorityLimiter interface {
+	Limiter
+	AcceptPriority(p Priority) bool
+	StatusPriority(p Priority) Status
+}
+
+var _ PriorityLimiter = (*TokenBucketRateLimiter)(nil)
+
+// A share of the capacity that only requests of the priority or above may take
+type reserve struct {
+	priority Priority
+	share    float64
+}
+
+// Holds back a share of the current capacity for requests of the priority or above, e.g.
+// WithReserve(PriorityCritical, 0.05) keeps 5% of the tokens for health checks and WithReserve(PriorityHigh, 0.3)
+// another 30% for the paid tier, so that lower priorities can only take the remaining 65%. The reserves are shares
+// of the current capacity, so they ramp up and down with it.
+func WithReserve(p Priority, share float64) Option {
+	return func(c *config) {
+		c.reserves = append(c.reserves, reserve{priority: p, share: share})
+		c.tokenBucketOption("WithReserve")
+	}
+}
+
+func verifyReserves(reserves []reserve) error {
+	var total float64
+	seen := make(map[Priority]bool)
+	for _, r := range reserves {
+		if r.share <= 0 || seen[r.priority] {
+			return ErrInvalidReserve
+		}
+		seen[r.priority] = true
+		total += r.share
+	}
+	if total >= 1 {
+		return ErrInvalidReserve
+	}
+	return nil
+}
+
+// The share of the capacity that requests of the priority cannot take
+func (c config) reservedAbove(p Priority) float64 {
+	var share float64
+	for _, r := range c.reserves {
+		if r.priority > p {
+			share += r.share
+		}
+	}
+	return share
+}
+
+// The share of the capacity held back from the lowest priority
+func (c config) reservedTotal() float64 {
+	var share float64
+	for _, r := range c.reserves {
+		share += r.share
+	}
+	return share
+}
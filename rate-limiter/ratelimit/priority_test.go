@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newReservingLimiter(t *testing.T, maxRpm, rampUpMinutes int, opts ...Option) (*TokenBucketRateLimiter, *ratelimittest.FakeClock) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	rl, err := NewTokenBucketRateLimiter(maxRpm, rampUpMinutes, append(opts, WithClock(clock))...)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	return rl, clock
+}
+
+func consumePriority(rl *TokenBucketRateLimiter, p Priority, n int) int {
+	accepted := 0
+	for i := 0; i < n && rl.AcceptPriority(p); i++ {
+		accepted++
+	}
+	return accepted
+}
+
+func TestReserves(t *testing.T) {
+	// of the 100 tokens, 10 are reserved for critical and 30 more for high priority
+	rl, _ := newReservingLimiter(t, 100, 0, WithReserve(PriorityCritical, 0.1), WithReserve(PriorityHigh, 0.3))
+
+	tests := []struct {
+		priority Priority
+		accepted int
+	}{
+		{PriorityLow, 60},
+		{PriorityNormal, 0},
+		{PriorityHigh, 30},
+		{PriorityCritical, 10},
+	}
+	for _, test := range tests {
+		if accepted := consumePriority(rl, test.priority, 1000); accepted != test.accepted {
+			t.Errorf("Expected %d requests of %s priority to be accepted but got %d", test.accepted, test.priority, accepted)
+		}
+	}
+}
+
+func TestHigherPrioritiesTakeFromLowerOnes(t *testing.T) {
+	rl, _ := newReservingLimiter(t, 100, 0, WithReserve(PriorityCritical, 0.1))
+	consumePriority(rl, PriorityCritical, 50)
+	if accepted := consume(rl, 1000); accepted != 40 {
+		t.Errorf("Expected 40 tokens left for the normal priority but got %d", accepted)
+	}
+}
+
+func TestStatusPriority(t *testing.T) {
+	rl, clock := newReservingLimiter(t, 60, 0, WithReserve(PriorityHigh, 0.5)) // a token per second
+	consume(rl, 1000)
+
+	tests := []struct {
+		priority Priority
+		expected Status
+	}{
+		{PriorityNormal, Status{Limit: 60, Remaining: 0, Reset: time.Second}},
+		{PriorityHigh, Status{Limit: 60, Remaining: 30, Reset: time.Second}},
+	}
+	for _, test := range tests {
+		if status := rl.StatusPriority(test.priority); status != test.expected {
+			t.Errorf("Expected %+v for %s priority but got %+v", test.expected, test.priority, status)
+		}
+	}
+
+	consumePriority(rl, PriorityHigh, 10)
+	if status := rl.Status(); status.Reset != 11*time.Second {
+		t.Errorf("Expected 11s until a token is open to the normal priority but got %v", status.Reset)
+	}
+	clock.Advance(11 * time.Second)
+	if !rl.Accept() {
+		t.Error("Expected a token for the normal priority once the reserve is refilled")
+	}
+}
+
+func TestAcceptNAndReserveNKeepReserves(t *testing.T) {
+	rl, _ := newReservingLimiter(t, 60, 0, WithReserve(PriorityHigh, 0.5))
+	if rl.AcceptN(31) {
+		t.Error("Expected AcceptN to leave the reserve alone")
+	}
+	if !rl.AcceptN(30) {
+		t.Error("Expected AcceptN to take the tokens open to the normal priority")
+	}
+	if delay := rl.ReserveN(3).Delay(); delay != 3*time.Second {
+		t.Errorf("Expected to wait 3s for the tokens to come from refills rather than the reserve but got %v", delay)
+	}
+}
+
+func TestRejectionsKeepingReservesRampUp(t *testing.T) {
+	// starts at 10 with 5 tokens reserved, so the bucket never drops below the default scale up threshold of 40%
+	rl, clock := newReservingLimiter(t, 100, 1, WithReserve(PriorityCritical, 0.5))
+	consumePriority(rl, PriorityLow, 1000)
+	advanceRefillInterval(clock)
+	if _, capacity := state(rl); capacity != 26 {
+		t.Errorf("Expected the capacity to scale up to 26 but got %d", capacity)
+	}
+}
+
+func TestPriorityMetrics(t *testing.T) {
+	metrics := newTestMetrics(t)
+	rl, _ := newReservingLimiter(t, 10, 0, WithReserve(PriorityHigh, 0.5), WithMetrics(metrics, "api"))
+	consumePriority(rl, PriorityLow, 1000)
+	consumePriority(rl, PriorityHigh, 2)
+	rl.Accept()
+
+	tests := []struct {
+		priority Priority
+		result   string
+		expected float64
+	}{
+		{PriorityLow, "accepted", 5},
+		{PriorityLow, "rejected", 1},
+		{PriorityHigh, "accepted", 2},
+		{PriorityNormal, "rejected", 1},
+	}
+	for _, test := range tests {
+		if got := testutil.ToFloat64(metrics.priorities.WithLabelValues("api", test.priority.String(), test.result)); got != test.expected {
+			t.Errorf("Expected %v %s requests of %s priority but got %v", test.expected, test.result, test.priority, got)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.requests.WithLabelValues("api", "accepted")); got != 7 {
+		t.Errorf("Expected 7 accepted requests in all but got %v", got)
+	}
+}
+
+func TestPriorityString(t *testing.T) {
+	if s := PriorityCritical.String(); s != "critical" {
+		t.Errorf("Expected critical but got %s", s)
+	}
+	if s := Priority(5).String(); s != "5" {
+		t.Errorf("Expected 5 but got %s", s)
+	}
+}
@@ -0,0 +1,52 @@
+package ratelimittest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	short := clock.After(time.Second)
+	long := clock.After(time.Minute)
+
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-short:
+		t.Fatalf("Expected the waiter not to fire before its deadline")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	select {
+	case now := <-short:
+		if !now.Equal(start.Add(time.Second)) {
+			t.Errorf("Expected the waiter to receive %v but got %v", start.Add(time.Second), now)
+		}
+	default:
+		t.Fatalf("Expected the waiter to fire at its deadline")
+	}
+
+	clock.Advance(time.Hour)
+	select {
+	case <-long:
+	default:
+		t.Fatalf("Expected the waiter to fire once the deadline has passed")
+	}
+	if !clock.Now().Equal(start.Add(time.Hour + time.Second)) {
+		t.Errorf("Unexpected time %v", clock.Now())
+	}
+}
+
+func TestFakeClockBlockUntil(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	done := make(chan struct{})
+	go func() {
+		<-clock.After(time.Second)
+		close(done)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-done
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrExceedsMaxRpm       = errors.New("cannot take more tokens than maxRpm at once")
+	ErrWaitExceedsDeadline = errors.New("waiting for the tokens would exceed the context deadline")
+)
+
+// Takes n tokens from the bucket if all of them are available to the normal priority, or none at all
+func (rl *TokenBucketRateLimiter) AcceptN(n int) bool {
+	if n <= 0 {
+		return true
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.advance(rl.clock.Now())
+	accepted := n <= rl.tokens-rl.reserved(PriorityNormal)
+	if accepted {
+		rl.tokens -= n
+		log.Debugf("%d tokens retrieved from bucket. Tokens left: %d", n, rl.tokens)
+	} else {
+		log.Debugf("Not enough tokens available for %d", n)
+	}
+	rl.metrics.request(accepted)
+	rl.metrics.prioritized(PriorityNormal, accepted)
+	rl.metrics.observe(rl.tokens, rl.currentCapacity)
+	return accepted
+}
+
+// A Reservation holds tokens that the holder may use once its delay has passed
+type Reservation struct {
+	rl        *TokenBucketRateLimiter
+	ok        bool
+	tokens    int
+	timeToAct time.Time
+}
+
+// Whether the tokens could be reserved. If not, the reservation has no delay and cancelling it does nothing.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// How long the holder has to wait before using the tokens
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return 0
+	}
+	if delay := r.timeToAct.Sub(r.rl.clock.Now()); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// Returns the reserved tokens to the bucket, e.g. when the holder won't wait for them after all.
+// Once the delay has passed the tokens count as used, and cancelling does nothing.
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+	r.rl.mu.Lock()
+	defer r.rl.mu.Unlock()
+	now := r.rl.clock.Now()
+	if r.tokens == 0 || !now.Before(r.timeToAct) {
+		return
+	}
+	r.rl.advance(now)
+	r.rl.tokens = min(r.rl.tokens+r.tokens, r.rl.currentCapacity)
+	r.rl.metrics.observe(r.rl.tokens, r.rl.currentCapacity)
+	r.tokens = 0
+	log.Debugf("Reservation cancelled. Tokens left: %d", r.rl.tokens)
+}
+
+func (rl *TokenBucketRateLimiter) Reserve() *Reservation {
+	return rl.ReserveN(1)
+}
+
+// Reserves n tokens, borrowing from the tokens still to be added if the bucket doesn't hold enough of them.
+// The delay lasts until the bucket is back above the reserves of higher priorities, and assumes the current capacity; scaling the capacity up (which the borrowed tokens make more likely)
+// pays the tokens back sooner.
+func (rl *TokenBucketRateLimiter) ReserveN(n int) *Reservation {
+	now := rl.clock.Now()
+	if n <= 0 {
+		return &Reservation{rl: rl, ok: true, timeToAct: now}
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if n > rl.maxRpm {
+		return &Reservation{rl: rl}
+	}
+	rl.advance(now)
+	rl.tokens -= n
+	r := &Reservation{rl: rl, ok: true, tokens: n, timeToAct: now}
+	if short := rl.reserved(PriorityNormal) - rl.tokens; short > 0 {
+		r.timeToAct = now.Add(rl.untilTokens(short))
+	}
+	rl.metrics.observe(rl.tokens, rl.currentCapacity)
+	log.Debugf("%d tokens reserved. Tokens left: %d", n, rl.tokens)
+	return r
+}
+
+func (rl *TokenBucketRateLimiter) Wait(ctx context.Context) error {
+	return rl.WaitN(ctx, 1)
+}
+
+// Blocks until n tokens are available and takes them. Returns an error without taking any tokens if the context
+// is done first, or if its deadline is too close for the tokens to become available.
+func (rl *TokenBucketRateLimiter) WaitN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r := rl.ReserveN(n)
+	if !r.OK() {
+		return ErrExceedsMaxRpm
+	}
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		r.Cancel()
+		return ErrWaitExceedsDeadline
+	}
+	select {
+	case <-rl.clock.After(delay):
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+)
+
+func TestAcceptN(t *testing.T) {
+	rl, _ := NewTokenBucketRateLimiter(60, 1) // starts off with 6 tokens
+	if !rl.AcceptN(4) {
+		t.Errorf("Expected 4 of the 6 tokens to be accepted")
+	}
+	if rl.AcceptN(3) {
+		t.Errorf("Expected 3 tokens to be rejected with only 2 left")
+	}
+	if rl.tokens != 2 {
+		t.Errorf("Expected a rejected AcceptN not to take any tokens but %d are left", rl.tokens)
+	}
+	if !rl.AcceptN(2) || !rl.AcceptN(0) || rl.Accept() {
+		t.Errorf("Expected the last 2 tokens to be accepted and the bucket to be empty")
+	}
+}
+
+func TestReserve(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 60, 0) // 60 tokens, one added every second
+	r := rl.ReserveN(60)
+	if !r.OK() || r.Delay() != 0 {
+		t.Fatalf("Expected the full bucket to be reserved without delay but got ok=%t, delay=%v", r.OK(), r.Delay())
+	}
+
+	tests := []struct {
+		n     int
+		delay time.Duration
+	}{
+		{1, time.Second},       // the next token
+		{9, 10 * time.Second},  // the nine after it
+		{25, 35 * time.Second}, // 25 more
+	}
+	for _, test := range tests {
+		r := rl.ReserveN(test.n)
+		if !r.OK() || r.Delay() != test.delay {
+			t.Errorf("Expected a delay of %v for %d tokens but got ok=%t, delay=%v", test.delay, test.n, r.OK(), r.Delay())
+		}
+	}
+
+	clock.Advance(10500 * time.Millisecond)
+	if r := rl.Reserve(); r.Delay() != 25500*time.Millisecond {
+		t.Errorf("Expected the tokens added meanwhile to shorten the delay to 25.5s but got %v", r.Delay())
+	}
+	if r := rl.ReserveN(61); r.OK() || r.Delay() != 0 {
+		t.Errorf("Expected reserving more than maxRpm to fail")
+	}
+}
+
+func TestCancelReservation(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 60, 0)
+	rl.AcceptN(55)
+	r := rl.ReserveN(10)
+	if r.Delay() != 5*time.Second {
+		t.Fatalf("Expected a delay of 5s but got %v", r.Delay())
+	}
+	r.Cancel()
+	r.Cancel() // cancelling twice only returns the tokens once
+	if !rl.AcceptN(5) || rl.Accept() {
+		t.Errorf("Expected the 5 tokens left before the reservation to be available again")
+	}
+
+	r = rl.ReserveN(10)
+	clock.Advance(r.Delay())
+	r.Cancel() // too late, the tokens are used
+	if rl.Accept() {
+		t.Errorf("Expected the tokens added meanwhile to pay back the used reservation, leaving none")
+	}
+}
+
+func TestWait(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 60, 0)
+	if err := rl.WaitN(context.Background(), 60); err != nil {
+		t.Fatalf("Expected the full bucket to be taken without waiting but got %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- rl.WaitN(context.Background(), 15) }()
+	clock.BlockUntil(1)
+	clock.Advance(15*time.Second - time.Nanosecond)
+	select {
+	case err := <-done:
+		t.Fatalf("Expected Wait to block until the tokens are added but it returned %v", err)
+	default:
+	}
+	clock.Advance(time.Nanosecond)
+	if err := <-done; err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	if err := rl.WaitN(context.Background(), 61); err != ErrExceedsMaxRpm {
+		t.Errorf("Expected ErrExceedsMaxRpm but got %v", err)
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 60, 0)
+	rl.AcceptN(60)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- rl.Wait(ctx) }()
+	clock.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+	if rl.tokens != 0 {
+		t.Errorf("Expected the cancelled wait to return its token but tokens are %d", rl.tokens)
+	}
+
+	if err := rl.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a done context to fail right away but got %v", err)
+	}
+}
+
+func TestWaitDeadline(t *testing.T) {
+	// the context's deadline is on the real clock, however far the limiter's clock is from it
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	rl, _ := NewTokenBucketRateLimiter(60, 0, WithClock(clock))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rl.AcceptN(60)
+	if err := rl.WaitN(ctx, 10); err != ErrWaitExceedsDeadline {
+		t.Errorf("Expected ErrWaitExceedsDeadline for a 10s wait 5s before the deadline but got %v", err)
+	}
+	if tokens, _ := state(rl); tokens != 0 {
+		t.Errorf("Expected no tokens to be taken but tokens are %d", tokens)
+	}
+}
+
+func TestReservationsRampUpCapacity(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 600, 1) // starts at 60, delta of 100
+	rl.ReserveN(100)
+	advanceRefillInterval(clock)
+	if _, capacity := state(rl); capacity != 160 {
+		t.Errorf("Expected waiting reservations to count as demand and scale up the capacity to 160 but got %d", capacity)
+	}
+}
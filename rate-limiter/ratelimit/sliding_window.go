@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// A SlidingWindowLogLimiter accepts up to limit requests in any window ending now, by remembering the time of every
+// accepted request. It is exact, at the cost of memory proportional to the limit.
+type SlidingWindowLogLimiter struct {
+	limit   int
+	window  time.Duration
+	clock   Clock
+	metrics *limiterMetrics // nil without WithMetrics
+
+	mu  sync.Mutex
+	log []time.Time // accepted requests in the current window, oldest first
+}
+
+// Only the WithClock and WithMetrics options apply
+func NewSlidingWindowLogLimiter(limit int, window time.Duration, opts ...Option) (*SlidingWindowLogLimiter, error) {
+	if err := verifyLimit(limit, window); err != nil {
+		return nil, err
+	}
+	clock, metrics, err := clockAndMetricsOf(limit, opts)
+	if err != nil {
+		return nil, err
+	}
+	metrics.observe(limit, limit)
+	return &SlidingWindowLogLimiter{limit: limit, window: window, clock: clock, metrics: metrics}, nil
+}
+
+func (l *SlidingWindowLogLimiter) Accept() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.expire()
+	accepted := len(l.log) < l.limit
+	if accepted {
+		l.log = append(l.log, now)
+	}
+	l.metrics.request(accepted)
+	l.metrics.observe(l.limit-len(l.log), l.limit)
+	return accepted
+}
+
+func (l *SlidingWindowLogLimiter) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.expire()
+	status := Status{Limit: l.limit, Remaining: l.limit - len(l.log)}
+	if len(l.log) > 0 {
+		status.Reset = nonNegative(l.log[0].Add(l.window).Sub(now)) // the oldest request leaves the window
+	}
+	return status
+}
+
+// Drops the requests that left the window. Must be called with l.mu held.
+func (l *SlidingWindowLogLimiter) expire() time.Time {
+	now := l.clock.Now()
+	expired := 0
+	for expired < len(l.log) && !l.log[expired].After(now.Add(-l.window)) {
+		expired++
+	}
+	l.log = append(l.log[:0], l.log[expired:]...)
+	return now
+}
+
+// A SlidingWindowCounterLimiter approximates a sliding window from the counts of the current and the previous
+// fixed window, weighting the previous count by how much of it still overlaps the sliding window.
+// It needs constant memory and smooths out the bursts a FixedWindowLimiter allows at window boundaries.
+type SlidingWindowCounterLimiter struct {
+	limit   int
+	window  time.Duration
+	clock   Clock
+	metrics *limiterMetrics // nil without WithMetrics
+
+	mu            sync.Mutex
+	windowStart   time.Time
+	count         int
+	previousCount int
+}
+
+// Only the WithClock and WithMetrics options apply
+func NewSlidingWindowCounterLimiter(limit int, window time.Duration, opts ...Option) (*SlidingWindowCounterLimiter, error) {
+	if err := verifyLimit(limit, window); err != nil {
+		return nil, err
+	}
+	clock, metrics, err := clockAndMetricsOf(limit, opts)
+	if err != nil {
+		return nil, err
+	}
+	metrics.observe(limit, limit)
+	return &SlidingWindowCounterLimiter{limit: limit, window: window, clock: clock, metrics: metrics}, nil
+}
+
+func (l *SlidingWindowCounterLimiter) Accept() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.advance()
+	accepted := l.estimate(now)+1 <= float64(l.limit)
+	if accepted {
+		l.count++
+	}
+	l.metrics.request(accepted)
+	l.metrics.observe(l.remaining(now), l.limit)
+	return accepted
+}
+
+func (l *SlidingWindowCounterLimiter) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.advance()
+	return Status{Limit: l.limit, Remaining: l.remaining(now), Reset: l.windowStart.Add(l.window).Sub(now)}
+}
+
+// Must be called with l.mu held
+func (l *SlidingWindowCounterLimiter) remaining(now time.Time) int {
+	return max(int(float64(l.limit)-l.estimate(now)), 0)
+}
+
+// The estimated number of requests in the sliding window ending now. Must be called with l.mu held.
+func (l *SlidingWindowCounterLimiter) estimate(now time.Time) float64 {
+	overlap := 1 - float64(now.Sub(l.windowStart))/float64(l.window)
+	return float64(l.previousCount)*overlap + float64(l.count)
+}
+
+// Moves to the window of the current time. Must be called with l.mu held.
+func (l *SlidingWindowCounterLimiter) advance() time.Time {
+	now := l.clock.Now()
+	start := now.Truncate(l.window)
+	switch {
+	case !start.After(l.windowStart):
+	case start.Sub(l.windowStart) == l.window:
+		l.previousCount = l.count
+		l.count = 0
+		l.windowStart = start
+	default: // more than a window passed without requests
+		l.previousCount = 0
+		l.count = 0
+		l.windowStart = start
+	}
+	return now
+}
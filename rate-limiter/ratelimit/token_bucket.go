@@ -3,105 +3,225 @@ A token-bucket rate limiter with ramp-up functionality.
 
 Set a maximum number of requests per minute to be supported and the capacity will scale up and down with the demand,
 smoothly over time, according to the ramp-up interval.
+
+Requests can be accepted with a priority, and WithReserve holds back a share of the capacity for the higher ones,
+so that e.g. health checks and the paid tier still get through while batch traffic is rejected.
+
+The bucket is refilled lazily: tokens and capacity are computed from the time elapsed whenever the limiter is used,
+so tokens trickle in continuously and there is no background goroutine to start or stop.
+
+The rate limiter is safe for concurrent use.
 */
 package ratelimit
 
 import (
-	"errors"
+	"sync"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	log "github.com/sirupsen/logrus"
 )
 
-var (
-	rcurrentCapacityGauge = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "current_capacity",
-		Help: "The current capacity of the bucket measured in rpm",
-	})
-)
-
-const (
-	refillIntervalSeconds     = 10
-	refillsPerMinute          = 60 / refillIntervalSeconds
-	scaleUpThreshold          = 0.4 // available tokens vs capacity
-	scaleDownThreshold        = 0.9 // available tokens vs capacity
-	initialCapacityPercentage = 0.1 // start off with 10% of the maxRpm
-)
-
 type TokenBucketRateLimiter struct {
 	maxRpm        int // peak number of requests per minute allowed e.g. 60 * 500rps = 30_000
 	rampUpMinutes int // number of minutes over which to smoothly ramp up to the max rpm
 
-	tokens          int // current number of tokens in the bucket
+	mu              sync.Mutex // guards the state below, which is brought up to date by every call that reads it
+	tokens          int        // current number of tokens in the bucket, negative while reservations are waiting for refills
+	credit          int64      // progress towards the next token, in tokens times nanoseconds: a token per minute of credit
+	refilled        int        // tokens added since the capacity was last scaled, which count from the next scaling on
 	currentCapacity int
+	lastUpdate      time.Time // when tokens were last added
+	nextRamp        time.Time // when the capacity is next scaled up or down
 	rampingDelta    int
-	stop            chan bool
+	metrics         *limiterMetrics // nil without WithMetrics
+	config
 }
 
-func NewTokenBucketRateLimiter(maxRpm, rampUpMinutes int) (*TokenBucketRateLimiter, error) {
+// Creates a rate limiter with the default tuning, which can be changed with options, e.g.
+// NewTokenBucketRateLimiter(600, 5, WithRefillInterval(time.Second), WithMinCapacity(60))
+func NewTokenBucketRateLimiter(maxRpm, rampUpMinutes int, opts ...Option) (*TokenBucketRateLimiter, error) {
 	if maxRpm < 1 {
-		return nil, errors.New("maxRpm must be at least 1")
+		return nil, ErrInvalidMaxRpm
 	}
 	if rampUpMinutes < 0 {
-		return nil, errors.New("ramp up minutes cannot be negative")
+		return nil, ErrNegativeRampUp
 	}
-	var rampingDelta int
-	var startCapacity int
+	config, err := newConfig(maxRpm, opts)
+	if err != nil {
+		return nil, err
+	}
+	rampingDelta := config.rampingDelta(maxRpm, rampUpMinutes)
+	startCapacity := maxRpm
 	if rampUpMinutes > 0 {
-		rampingDelta = max(maxRpm/(rampUpMinutes*refillsPerMinute), 1)
-		startCapacity = max(int(float64(maxRpm)*initialCapacityPercentage), 1)
-	} else {
-		rampingDelta = 0
-		startCapacity = maxRpm
+		startCapacity = max(int(float64(maxRpm)*config.initialCapacityPercentage), config.minCapacity)
 	}
-	stop := make(chan bool)
-	return &TokenBucketRateLimiter{maxRpm: maxRpm, rampUpMinutes: rampUpMinutes, currentCapacity: startCapacity, tokens: startCapacity, rampingDelta: rampingDelta, stop: stop}, nil
+	now := config.clock.Now()
+	rl := &TokenBucketRateLimiter{maxRpm: maxRpm, rampUpMinutes: rampUpMinutes, currentCapacity: startCapacity, tokens: startCapacity,
+		lastUpdate: now, nextRamp: now.Add(config.refillInterval), rampingDelta: rampingDelta, config: config}
+	if config.metrics != nil {
+		rl.metrics = config.metrics.limiter(config.name)
+		rl.metrics.observe(rl.tokens, rl.currentCapacity)
+	}
+	return rl, nil
 }
 
 func (rl *TokenBucketRateLimiter) Accept() bool {
-	if rl.tokens > 0 {
+	return rl.AcceptPriority(PriorityNormal)
+}
+
+// Takes a token unless only the tokens reserved for higher priorities are left in the bucket
+func (rl *TokenBucketRateLimiter) AcceptPriority(p Priority) bool {
+	now := rl.clock.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.advance(now)
+	accepted := rl.tokens > rl.reserved(p)
+	if accepted {
 		rl.tokens -= 1
-		log.Debugf("Token retrieved from bucket. Tokens left: %d", rl.tokens)
-		return true
+		log.Debugf("Token retrieved from bucket for %s priority. Tokens left: %d", p, rl.tokens)
+	} else {
+		log.Debugf("No tokens available for %s priority", p)
 	}
-	log.Debug("No tokens available")
-	return false
+	rl.metrics.request(accepted)
+	rl.metrics.prioritized(p, accepted)
+	rl.metrics.observe(rl.tokens, rl.currentCapacity)
+	return accepted
+}
+
+// A snapshot of the limiter's state, e.g. for rate limit response headers
+type Status struct {
+	Limit     int           // current capacity, in requests per minute
+	Remaining int           // tokens left in the bucket
+	Reset     time.Duration // until the next token is added, 0 while the bucket is full
+}
+
+func (rl *TokenBucketRateLimiter) Status() Status {
+	return rl.StatusPriority(PriorityNormal)
 }
 
-func (rl *TokenBucketRateLimiter) Start() {
-	go rl.refill()
+// The status as seen by requests of the priority: the tokens reserved for higher priorities don't count as
+// remaining, and while none are left Reset is the time until one is
+func (rl *TokenBucketRateLimiter) StatusPriority(p Priority) Status {
+	now := rl.clock.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.advance(now)
+	reserved := rl.reserved(p)
+	var reset time.Duration
+	if rl.tokens < rl.currentCapacity {
+		reset = rl.untilTokens(max(reserved+1-rl.tokens, 1))
+	}
+	return Status{Limit: rl.currentCapacity, Remaining: max(rl.tokens-reserved, 0), Reset: reset}
 }
 
-func (rl *TokenBucketRateLimiter) Stop() {
-	rl.stop <- true
+// Changes the limits at runtime, keeping the capacity ramped up so far: a raised maxRpm is ramped up to with demand
+// as usual, while a capacity above a lowered maxRpm steps down to it by the ramping delta at every refill interval.
+// Without ramp-up the capacity moves to the new maxRpm right away. Invalid limits are rejected without changing any.
+func (rl *TokenBucketRateLimiter) SetLimits(maxRpm, rampUpMinutes int) error {
+	if maxRpm < 1 {
+		return ErrInvalidMaxRpm
+	}
+	if rampUpMinutes < 0 {
+		return ErrNegativeRampUp
+	}
+	if rl.minCapacity > maxRpm {
+		return ErrInvalidMinCapacity
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.advance(rl.clock.Now())
+	rl.maxRpm = maxRpm
+	rl.rampUpMinutes = rampUpMinutes
+	rl.rampingDelta = rl.config.rampingDelta(maxRpm, rampUpMinutes)
+	if rampUpMinutes == 0 {
+		rl.currentCapacity = maxRpm
+		rl.tokens = min(rl.tokens, maxRpm)
+	}
+	rl.metrics.observe(rl.tokens, rl.currentCapacity)
+	log.Infof("Limits set to %d rpm with a ramp-up of %d minutes", maxRpm, rampUpMinutes)
+	return nil
 }
 
-func (rl *TokenBucketRateLimiter) refill() {
-	for {
-		select {
-		case <-rl.stop:
-			return
-		case <-time.After(refillIntervalSeconds * time.Second):
-			rl.rampUp()
-			tokensToAdd := max(rl.currentCapacity/refillsPerMinute, 1)
-			rl.tokens = min(rl.tokens+tokensToAdd, rl.currentCapacity)
-			log.Debugf("Adding %d tokens to bucket. New capacity: %d", tokensToAdd, rl.currentCapacity)
+// Brings the bucket up to date with the time elapsed since it was last used: tokens are added continuously at the
+// current capacity per minute, and the capacity is scaled up or down at every refill interval that has passed, based
+// on the tokens in the bucket at the time other than those added since the previous scaling. That way the scaling
+// sees the bucket as if each interval's tokens were added up front, when it was last scaled. Returns the net change
+// in tokens, which is negative when scaling down the capacity drops tokens. Must be called with rl.mu held.
+func (rl *TokenBucketRateLimiter) advance(now time.Time) int {
+	before := rl.tokens
+	for !now.Before(rl.nextRamp) {
+		rl.addTokens(rl.nextRamp)
+		capacity := rl.currentCapacity
+		settled := rl.tokens == capacity && rl.refilled == 0 // was already full when last scaled
+		rl.rampUp()
+		rl.refilled = 0
+		rl.nextRamp = rl.nextRamp.Add(rl.refillInterval)
+		if settled && rl.currentCapacity == capacity && now.After(rl.nextRamp) {
+			// a full bucket that no longer scales down stays as it is, however long it is idle
+			skipped := now.Sub(rl.nextRamp) / rl.refillInterval
+			rl.nextRamp = rl.nextRamp.Add(skipped * rl.refillInterval)
+			rl.lastUpdate = rl.nextRamp
 		}
 	}
+	rl.addTokens(now)
+	rl.metrics.observe(rl.tokens, rl.currentCapacity)
+	return rl.tokens - before
 }
 
-// Adjust the current capacity up or down depending on the rate of consumption of tokens in the bucket and the ramp-up rate configured
+// Adds the tokens accrued since the last update, up to the capacity. Must be called with rl.mu held.
+func (rl *TokenBucketRateLimiter) addTokens(now time.Time) {
+	elapsed := now.Sub(rl.lastUpdate)
+	if elapsed <= 0 {
+		return
+	}
+	rl.lastUpdate = now
+	before := rl.tokens
+	if rl.tokens >= rl.currentCapacity || elapsed >= rl.untilTokens(rl.currentCapacity-rl.tokens) {
+		rl.tokens = rl.currentCapacity
+		rl.credit = 0
+	} else {
+		rl.credit += int64(elapsed) * int64(rl.currentCapacity)
+		rl.tokens += int(rl.credit / int64(time.Minute))
+		rl.credit %= int64(time.Minute)
+	}
+	rl.refilled += rl.tokens - before
+}
+
+// How long it takes at the current capacity until n more tokens are in the bucket. Must be called with rl.mu held.
+func (rl *TokenBucketRateLimiter) untilTokens(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	credit := int64(n)*int64(time.Minute) - rl.credit
+	capacity := int64(rl.currentCapacity)
+	return time.Duration((credit + capacity - 1) / capacity)
+}
+
+// Adjust the current capacity up or down depending on the rate of consumption of tokens in the bucket and the ramp-up rate configured.
+// The thresholds apply to the tokens open to all priorities, so that requests rejected to keep the reserves still
+// ramp the capacity up. Tokens above a reduced capacity are dropped. Must be called with rl.mu held.
 func (rl *TokenBucketRateLimiter) rampUp() {
-	if float64(rl.tokens) > scaleDownThreshold*float64(rl.currentCapacity) {
-		rl.currentCapacity = max(rl.currentCapacity-rl.rampingDelta, 1)
+	capacity := rl.currentCapacity
+	reserved := int(rl.reservedTotal() * float64(capacity))
+	free, unreserved := float64(rl.tokens-rl.refilled-reserved), float64(capacity-reserved)
+	if rl.currentCapacity > rl.maxRpm {
+		rl.currentCapacity = max(rl.currentCapacity-rl.rampingDelta, rl.maxRpm)
+		rl.tokens = min(rl.tokens, rl.currentCapacity)
+		log.Debugf("Stepped down capacity to %d towards the lowered maxRpm", rl.currentCapacity)
+	} else if free > rl.scaleDownThreshold*unreserved {
+		rl.currentCapacity = max(rl.currentCapacity-rl.rampingDelta, rl.minCapacity)
+		rl.tokens = min(rl.tokens, rl.currentCapacity)
 		log.Debugf("Scaled down capacity to %d", rl.currentCapacity)
-	} else if float64(rl.tokens) < scaleUpThreshold*float64(rl.currentCapacity) {
+	} else if free < rl.scaleUpThreshold*unreserved {
 		rl.currentCapacity = min(rl.currentCapacity+rl.rampingDelta, rl.maxRpm)
 		log.Debugf("Scaled up capacity to %d", rl.currentCapacity)
 	}
-	rcurrentCapacityGauge.Set(float64(rl.currentCapacity))
+	rl.metrics.scaled(rl.currentCapacity - capacity)
+}
+
+// The tokens of the current capacity that requests of the priority cannot take. Must be called with rl.mu held.
+func (rl *TokenBucketRateLimiter) reserved(p Priority) int {
+	return int(rl.reservedAbove(p) * float64(rl.currentCapacity))
 }
 
 func min(a, b int) int {
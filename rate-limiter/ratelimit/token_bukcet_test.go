@@ -1,7 +1,13 @@
 package ratelimit
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
 )
 
 func TestRateLimiterWithIncorrectParams(t *testing.T) {
@@ -66,8 +72,6 @@ func TestRampUpDeltaAndInitialCapacityInitialization(t *testing.T) {
 func TestRateLimitingLogic(t *testing.T) {
 	t.Run("test that rate limit is enforced", func(t *testing.T) {
 		rl, _ := NewTokenBucketRateLimiter(20, 1)
-		rl.Start()
-		defer rl.Stop()
 		if rl.currentCapacity != 2 || rl.tokens != 2 {
 			t.Errorf("Expected to start off with 2 tokens (10 percent of max), but currentCapacity=%d and tokens=%d", rl.currentCapacity, rl.tokens)
 		}
@@ -82,3 +86,333 @@ func TestRateLimitingLogic(t *testing.T) {
 		}
 	})
 }
+
+func TestConcurrentAcceptAndRefill(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 6000, 1)
+	initialTokens := rl.tokens
+
+	const workers = 16
+	const acceptsPerWorker = 2000
+	const steps = 500
+	const step = 100 * time.Millisecond
+	var accepted int64
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < acceptsPerWorker; j++ {
+				if rl.Accept() {
+					atomic.AddInt64(&accepted, 1)
+				}
+			}
+		}()
+	}
+	var refilled int
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < steps; i++ {
+			// the clock moves under the lock, so that every token added is counted here rather than by an Accept
+			rl.mu.Lock()
+			clock.Advance(step)
+			refilled += rl.advance(clock.Now())
+			rl.mu.Unlock()
+		}
+	}()
+	wg.Wait()
+
+	tokens, capacity := state(rl)
+	if tokens < 0 || tokens > capacity {
+		t.Errorf("Expected tokens to stay within [0, %d] but got %d", capacity, tokens)
+	}
+	if capacity < 1 || capacity > rl.maxRpm {
+		t.Errorf("Expected capacity to stay within [1, %d] but got %d", rl.maxRpm, capacity)
+	}
+	// every token handed out must have been in the bucket: no token is lost or handed out twice
+	if int(accepted)+tokens != initialTokens+refilled {
+		t.Errorf("Expected accepted (%d) + remaining (%d) tokens to equal initial (%d) + refilled (%d) tokens",
+			accepted, tokens, initialTokens, refilled)
+	}
+}
+
+func TestConcurrentAcceptDoesNotOverAdmit(t *testing.T) {
+	rl, _ := NewTokenBucketRateLimiter(1000, 0)
+	var accepted int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if rl.Accept() {
+					atomic.AddInt64(&accepted, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1000 {
+		t.Errorf("Expected exactly the 1000 tokens in the bucket to be handed out but got %d", accepted)
+	}
+}
+
+func TestRampUpUnderConcurrentLoad(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 600, 1)
+	// with demand far above capacity, concurrent callers drain the bucket before every refill, so every refill scales up
+	for i := 0; i < int(time.Minute/rl.refillInterval); i++ {
+		var wg sync.WaitGroup
+		for j := 0; j < 8; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for rl.Accept() {
+				}
+			}()
+		}
+		wg.Wait()
+		advanceRefillInterval(clock)
+	}
+
+	if _, capacity := state(rl); capacity != rl.maxRpm {
+		t.Errorf("Expected to ramp up to %d within a minute of refills but capacity is %d", rl.maxRpm, capacity)
+	}
+}
+
+func newFakeClockRateLimiter(t *testing.T, maxRpm, rampUpMinutes int) (*TokenBucketRateLimiter, *ratelimittest.FakeClock) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	rl, err := NewTokenBucketRateLimiter(maxRpm, rampUpMinutes, WithClock(clock))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	return rl, clock
+}
+
+// Advances the clock by one refill interval, to the next scale up or down
+func advanceRefillInterval(clock *ratelimittest.FakeClock) {
+	clock.Advance(defaultRefillInterval)
+}
+
+func consume(rl *TokenBucketRateLimiter, n int) int {
+	accepted := 0
+	for i := 0; i < n && rl.Accept(); i++ {
+		accepted++
+	}
+	return accepted
+}
+
+// The tokens and capacity as of now
+func state(rl *TokenBucketRateLimiter) (tokens, capacity int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.advance(rl.clock.Now())
+	return rl.tokens, rl.currentCapacity
+}
+
+func TestFullRampUpCycle(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 60, 1) // delta of 10 per refill, starting at 6
+
+	// demand above capacity: the bucket is drained before every refill, scaling up until maxRpm
+	expectedUp := []int{16, 26, 36, 46, 56, 60, 60}
+	for i, expected := range expectedUp {
+		consume(rl, 1000)
+		advanceRefillInterval(clock)
+		if _, capacity := state(rl); capacity != expected {
+			t.Fatalf("Expected capacity %d after %d refills under load but got %d", expected, i+1, capacity)
+		}
+	}
+
+	// no demand: the capacity holds while the bucket fills up, then scales down to a single request per minute
+	// once the tokens stay above the scale-down threshold
+	expectedDown := []int{60, 60, 60, 60, 60, 50, 40, 30, 20, 10, 1, 1}
+	for i, expected := range expectedDown {
+		advanceRefillInterval(clock)
+		tokens, capacity := state(rl)
+		if capacity != expected {
+			t.Fatalf("Expected capacity %d after %d idle refills but got %d", expected, i+1, capacity)
+		}
+		if tokens > capacity {
+			t.Fatalf("Expected tokens to be capped by the capacity but got %d > %d", tokens, capacity)
+		}
+	}
+
+	// demand resumes: ramp-up is enforced again
+	expectedUpAgain := []int{11, 21, 31}
+	for i, expected := range expectedUpAgain {
+		consume(rl, 1000)
+		advanceRefillInterval(clock)
+		if _, capacity := state(rl); capacity != expected {
+			t.Fatalf("Expected capacity %d after %d refills once demand resumed but got %d", expected, i+1, capacity)
+		}
+	}
+}
+
+func TestScaleThresholds(t *testing.T) {
+	tests := []struct {
+		name             string
+		tokensBefore     int // tokens left in a bucket of capacity 100 when it is scaled
+		expectedCapacity int
+	}{
+		{"scale up below the scale-up threshold", 39, 116},
+		{"stay at the scale-up threshold", 40, 100},
+		{"stay between the thresholds", 65, 100},
+		{"stay at the scale-down threshold", 90, 100},
+		{"scale down above the scale-down threshold", 91, 84},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl, clock := newFakeClockRateLimiter(t, 1000, 1) // delta of 1000/6 = 166
+			rl.mu.Lock()
+			rl.rampingDelta = 16
+			rl.currentCapacity = 100
+			rl.tokens = test.tokensBefore
+			rl.lastUpdate = rl.nextRamp // no tokens are added before the bucket is scaled
+			rl.mu.Unlock()
+
+			advanceRefillInterval(clock)
+			tokens, capacity := state(rl)
+			if capacity != test.expectedCapacity {
+				t.Errorf("Expected capacity %d but got %d", test.expectedCapacity, capacity)
+			}
+			if expectedTokens := min(test.tokensBefore, capacity); tokens != expectedTokens {
+				t.Errorf("Expected %d tokens when scaled but got %d", expectedTokens, tokens)
+			}
+		})
+	}
+}
+
+func TestSmoothRefill(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 600, 0) // a token every 100ms
+	consume(rl, 1000)
+	clock.Advance(100*time.Millisecond - time.Nanosecond)
+	if rl.Accept() {
+		t.Errorf("Expected no token before its share of the minute has passed")
+	}
+	clock.Advance(time.Nanosecond)
+	if !rl.Accept() || rl.Accept() {
+		t.Errorf("Expected exactly one token after 100ms")
+	}
+	clock.Advance(2550 * time.Millisecond)
+	if accepted := consume(rl, 1000); accepted != 25 {
+		t.Errorf("Expected 25 tokens after 2.55s but got %d", accepted)
+	}
+	clock.Advance(50 * time.Millisecond)
+	if !rl.Accept() {
+		t.Errorf("Expected the half token left over to count towards the next one")
+	}
+}
+
+func TestLongIdle(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 60, 1)
+	consume(rl, 1000)
+	clock.Advance(30 * 24 * time.Hour)
+	if tokens, capacity := state(rl); capacity != 1 || tokens != 1 {
+		t.Errorf("Expected a month of idling to scale down to a full bucket of 1 but got %d tokens of %d", tokens, capacity)
+	}
+	// the bucket is scaled at the same instants as if it had been used all along
+	rl.mu.Lock()
+	next := rl.nextRamp
+	rl.mu.Unlock()
+	if expected := clock.Now().Add(defaultRefillInterval); !next.Equal(expected) {
+		t.Errorf("Expected the next scaling at %v but got %v", expected, next)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 60, 1)
+	rl.AcceptN(4)
+	clock.Advance(4 * time.Second)
+	status := rl.Status()
+	if status.Limit != 6 || status.Remaining != 2 || status.Reset != 6*time.Second {
+		t.Errorf("Expected a limit of 6 with 2 remaining and 6s until the next token but got %+v", status)
+	}
+	rl.ReserveN(5)
+	if status := rl.Status(); status.Remaining != 0 {
+		t.Errorf("Expected no remaining tokens while a reservation is waiting but got %d", status.Remaining)
+	}
+	clock.Advance(time.Hour)
+	if status := rl.Status(); status.Remaining != status.Limit || status.Reset != 0 {
+		t.Errorf("Expected a full bucket with nothing to wait for but got %+v", status)
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	rl, clock := newFakeClockRateLimiter(t, 60, 1) // delta of 10 per refill, starting at 6
+	for i := 0; i < 6; i++ {
+		consume(rl, 1000)
+		advanceRefillInterval(clock)
+	}
+	if _, capacity := state(rl); capacity != 60 {
+		t.Fatalf("Expected to ramp up to 60 but got %d", capacity)
+	}
+
+	// raised: the capacity ramped up so far is kept, and ramps up further with the new delta of 20
+	if err := rl.SetLimits(120, 1); err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	expectedUp := []int{60, 80, 100, 120, 120}
+	for i, expected := range expectedUp {
+		if _, capacity := state(rl); capacity != expected {
+			t.Fatalf("Expected capacity %d after %d refills under load but got %d", expected, i, capacity)
+		}
+		consume(rl, 1000)
+		advanceRefillInterval(clock)
+	}
+
+	// lowered: the capacity steps down even under load
+	if err := rl.SetLimits(60, 2); err != nil { // delta of 5
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	expectedDown := []int{115, 110, 105}
+	for i, expected := range expectedDown {
+		consume(rl, 1000)
+		advanceRefillInterval(clock)
+		if _, capacity := state(rl); capacity != expected {
+			t.Fatalf("Expected capacity %d after %d refills under load but got %d", expected, i+1, capacity)
+		}
+	}
+
+	// without ramp-up the new limit applies right away
+	if err := rl.SetLimits(30, 0); err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	if tokens, capacity := state(rl); capacity != 30 || tokens > 30 {
+		t.Errorf("Expected the capacity to move to 30 right away but got %d tokens of %d", tokens, capacity)
+	}
+}
+
+func TestSetInvalidLimits(t *testing.T) {
+	rl, _ := NewTokenBucketRateLimiter(100, 5, WithMinCapacity(20))
+	tests := []struct {
+		maxRpm, rampUpMinutes int
+		err                   error
+	}{
+		{0, 5, ErrInvalidMaxRpm},
+		{100, -1, ErrNegativeRampUp},
+		{10, 5, ErrInvalidMinCapacity},
+	}
+	for _, test := range tests {
+		if err := rl.SetLimits(test.maxRpm, test.rampUpMinutes); !errors.Is(err, test.err) {
+			t.Errorf("Expected %v for %+v but got %v", test.err, test, err)
+		}
+	}
+	if rl.maxRpm != 100 || rl.rampUpMinutes != 5 || rl.rampingDelta != 3 {
+		t.Errorf("Expected rejected limits to leave the limiter unchanged but got maxRpm=%d, rampUpMinutes=%d, delta=%d", rl.maxRpm, rl.rampUpMinutes, rl.rampingDelta)
+	}
+}
+
+func BenchmarkAccept(b *testing.B) {
+	rl, _ := NewTokenBucketRateLimiter(1_000_000, 1)
+	for i := 0; i < b.N; i++ {
+		rl.Accept()
+	}
+}
+
+func BenchmarkAcceptParallel(b *testing.B) {
+	rl, _ := NewTokenBucketRateLimiter(1_000_000, 1)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rl.Accept()
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit"
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+	"github.com/VladMinzatu/go-projects/rate-limiter/traffic"
+)
+
+// Runs the token bucket against a traffic pattern on a virtual clock, writing the trace of every step to -out
+// and the summary to stderr
+func simulate(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	limiterParams := addLimiterFlags(fs)
+	patternParams := addPatternFlags(fs)
+	step := fs.Duration("step", time.Second, "length of each simulation step")
+	duration := fs.Duration("duration", 20*time.Minute, "virtual time to simulate")
+	format := fs.String("format", "csv", "trace format: csv or json")
+	out := fs.String("out", "", "file to write the trace to (stdout if empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *step <= 0 || *duration <= 0 {
+		return fmt.Errorf("step and duration must be positive")
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	pattern, err := patternParams.build()
+	if err != nil {
+		return err
+	}
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	opts := append(limiterParams.options(), ratelimit.WithClock(clock))
+	rl, err := ratelimit.NewTokenBucketRateLimiter(limiterParams.maxRpm, limiterParams.rampUpMinutes, opts...)
+	if err != nil {
+		return err
+	}
+
+	steps := traffic.Simulate(rl, clock, pattern, *step, *duration)
+	summary := traffic.Summarize(steps, limiterParams.maxRpm)
+
+	if *out == "" {
+		err = writeTrace(os.Stdout, *format, steps, summary)
+	} else {
+		f, createErr := os.Create(*out)
+		if createErr != nil {
+			return createErr
+		}
+		err = writeTrace(f, *format, steps, summary)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	writeSummary(os.Stderr, summary)
+	return nil
+}
+
+func writeTrace(w io.Writer, format string, steps []traffic.TraceStep, summary traffic.Summary) error {
+	if format == "json" {
+		return json.NewEncoder(w).Encode(struct {
+			Steps   []traffic.TraceStep `json:"steps"`
+			Summary traffic.Summary     `json:"summary"`
+		}{steps, summary})
+	}
+	return traffic.WriteCSV(w, steps)
+}
+
+func writeSummary(w io.Writer, s traffic.Summary) {
+	if s.ReachedMax {
+		fmt.Fprintf(w, "time to max:        %v\n", time.Duration(s.SecondsToMax*float64(time.Second)))
+	} else {
+		fmt.Fprintf(w, "time to max:        not reached\n")
+	}
+	fmt.Fprintf(w, "rejection ratio:    %.3f (%d of %d)\n", s.RejectionRatio, s.Rejected, s.Arrived)
+	fmt.Fprintf(w, "capacity reversals: %d\n", s.CapacityReversals)
+	fmt.Fprintf(w, "capacity swing:     %d rpm\n", s.CapacitySwing)
+}
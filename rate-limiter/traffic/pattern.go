@@ -0,0 +1,162 @@
+/*
+Traffic patterns to drive a rate limiter with, e.g. to watch it ramp up.
+
+A Pattern tells how many requests arrive in any interval of time since the traffic started. Run plays a pattern in
+real time, and the same patterns can be stepped through on a virtual clock.
+*/
+package traffic
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+var (
+	ErrNegativeRate     = errors.New("rates cannot be negative")
+	ErrInvalidPeriod    = errors.New("periods must be positive")
+	ErrMissingRates     = errors.New("step pattern needs at least one rate")
+	ErrInvalidBurst     = errors.New("burst size must be at least 1")
+	ErrInvalidAmplitude = errors.New("amplitude must be between 0 and the base rate")
+)
+
+// A Pattern tells how many requests arrive over time
+type Pattern interface {
+	// The number of requests arriving in [from, to), both measured from the start of the traffic
+	Requests(from, to time.Duration) int
+}
+
+// A pattern with a rate that varies over time, given by the number of requests up to any point in time. Arrivals are
+// spread out evenly: a request arrives whenever the running total reaches a whole number.
+type cumulative func(t time.Duration) float64
+
+func (c cumulative) Requests(from, to time.Duration) int {
+	if to <= from {
+		return 0
+	}
+	return int(math.Floor(c(to)) - math.Floor(c(from)))
+}
+
+// rpm requests per minute, evenly spaced
+func Constant(rpm float64) (Pattern, error) {
+	if rpm < 0 {
+		return nil, ErrNegativeRate
+	}
+	return cumulative(func(t time.Duration) float64 { return rpm * t.Minutes() }), nil
+}
+
+// Each rate in turn for the length of a step. After the last one the rates start over if repeat is set, or the last
+// rate carries on otherwise. E.g. Step([]float64{90, 0}, 10*time.Minute, true) alternates between 10 minutes of
+// 90 rpm and 10 quiet minutes.
+func Step(rpms []float64, every time.Duration, repeat bool) (Pattern, error) {
+	if len(rpms) == 0 {
+		return nil, ErrMissingRates
+	}
+	if every <= 0 {
+		return nil, ErrInvalidPeriod
+	}
+	var perCycle float64
+	for _, rpm := range rpms {
+		if rpm < 0 {
+			return nil, ErrNegativeRate
+		}
+		perCycle += rpm * every.Minutes()
+	}
+	cycle := time.Duration(len(rpms)) * every
+	return cumulative(func(t time.Duration) float64 {
+		var total float64
+		if repeat {
+			total = float64(t/cycle) * perCycle
+			t %= cycle
+		}
+		for _, rpm := range rpms {
+			if t <= every {
+				return total + rpm*t.Minutes()
+			}
+			total += rpm * every.Minutes()
+			t -= every
+		}
+		return total + rpms[len(rpms)-1]*t.Minutes()
+	}), nil
+}
+
+// A rate that swings between rpm-amplitude and rpm+amplitude over every period, starting at rpm on the way up
+func Sinusoidal(rpm, amplitude float64, period time.Duration) (Pattern, error) {
+	if rpm < 0 {
+		return nil, ErrNegativeRate
+	}
+	if amplitude < 0 || amplitude > rpm {
+		return nil, ErrInvalidAmplitude
+	}
+	if period <= 0 {
+		return nil, ErrInvalidPeriod
+	}
+	omega := 2 * math.Pi / period.Minutes()
+	return cumulative(func(t time.Duration) float64 {
+		return rpm*t.Minutes() + amplitude/omega*(1-math.Cos(omega*t.Minutes()))
+	}), nil
+}
+
+// Requests arriving independently of each other at rpm requests per minute on average, as from many clients.
+// The counts are drawn from the source, so the same seed gives the same traffic.
+func Poisson(rpm float64, source rand.Source) (Pattern, error) {
+	if rpm < 0 {
+		return nil, ErrNegativeRate
+	}
+	return &poisson{rpm: rpm, rand: rand.New(source)}, nil
+}
+
+type poisson struct {
+	rpm  float64
+	rand *rand.Rand
+}
+
+func (p *poisson) Requests(from, to time.Duration) int {
+	if to <= from {
+		return 0
+	}
+	mean := p.rpm * (to - from).Minutes()
+	if mean > 500 {
+		// the normal approximation, as the product of uniforms below underflows for large means
+		return int(math.Max(0, math.Round(mean+math.Sqrt(mean)*p.rand.NormFloat64())))
+	}
+	// Knuth: count the uniforms it takes for their product to drop below e^-mean
+	limit := math.Exp(-mean)
+	n := 0
+	for product := p.rand.Float64(); product > limit; product *= p.rand.Float64() {
+		n++
+	}
+	return n
+}
+
+// size requests at once at the start of every period, and none in between
+func Bursty(size int, every time.Duration) (Pattern, error) {
+	if size < 1 {
+		return nil, ErrInvalidBurst
+	}
+	if every <= 0 {
+		return nil, ErrInvalidPeriod
+	}
+	return bursty{size: size, every: every}, nil
+}
+
+type bursty struct {
+	size  int
+	every time.Duration
+}
+
+func (b bursty) Requests(from, to time.Duration) int {
+	if to <= from {
+		return 0
+	}
+	// bursts at the multiples of every in [from, to)
+	return int(ceilDiv(to, b.every)-ceilDiv(from, b.every)) * b.size
+}
+
+func ceilDiv(t, d time.Duration) time.Duration {
+	if t <= 0 {
+		return -(-t / d)
+	}
+	return (t + d - 1) / d
+}
@@ -0,0 +1,134 @@
+package traffic
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// The requests arriving in each of n intervals of the given length
+func perInterval(p Pattern, interval time.Duration, n int) []int {
+	counts := make([]int, n)
+	for i := range counts {
+		counts[i] = p.Requests(time.Duration(i)*interval, time.Duration(i+1)*interval)
+	}
+	return counts
+}
+
+func sum(counts []int) int {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	return total
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestConstant(t *testing.T) {
+	p, _ := Constant(90)
+	if got := perInterval(p, 10*time.Second, 6); !equal(got, []int{15, 15, 15, 15, 15, 15}) {
+		t.Errorf("Expected 15 requests every 10s but got %v", got)
+	}
+	if got := perInterval(p, time.Second, 4); !equal(got, []int{1, 2, 1, 2}) {
+		t.Errorf("Expected 1.5 requests per second to alternate between 1 and 2 but got %v", got)
+	}
+	if p.Requests(time.Minute, time.Minute) != 0 || p.Requests(time.Minute, 0) != 0 {
+		t.Errorf("Expected no requests in empty intervals")
+	}
+}
+
+func TestStep(t *testing.T) {
+	repeating, _ := Step([]float64{60, 0, 120}, time.Minute, true)
+	if got := perInterval(repeating, time.Minute, 7); !equal(got, []int{60, 0, 120, 60, 0, 120, 60}) {
+		t.Errorf("Expected the steps to repeat but got %v", got)
+	}
+	lasting, _ := Step([]float64{60, 0, 120}, time.Minute, false)
+	if got := perInterval(lasting, time.Minute, 5); !equal(got, []int{60, 0, 120, 120, 120}) {
+		t.Errorf("Expected the last step to carry on but got %v", got)
+	}
+	if got := repeating.Requests(30*time.Second, 150*time.Second); got != 30+60 {
+		t.Errorf("Expected an interval across steps to add them up to 90 but got %d", got)
+	}
+}
+
+func TestSinusoidal(t *testing.T) {
+	p, _ := Sinusoidal(60, 30, 4*time.Minute)
+	got := perInterval(p, time.Minute, 8)
+	// quarters of the period: mostly above the mean, the peak, mostly below it, the trough
+	if sum(got[:4]) != 240 || sum(got) != 480 {
+		t.Errorf("Expected the mean rate over every period but got %v", got)
+	}
+	if !(got[0] > 60 && got[1] > 60 && got[2] < 60 && got[3] < 60) {
+		t.Errorf("Expected the rate to swing above the mean and then below it but got %v", got)
+	}
+}
+
+func TestPoisson(t *testing.T) {
+	p, _ := Poisson(600, rand.NewSource(1))
+	got := perInterval(p, time.Second, 600) // a mean of 10 per second
+	mean := float64(sum(got)) / float64(len(got))
+	var variance float64
+	for _, c := range got {
+		variance += (float64(c) - mean) * (float64(c) - mean)
+	}
+	variance /= float64(len(got))
+	if math.Abs(mean-10) > 0.5 || math.Abs(variance-10) > 2 {
+		t.Errorf("Expected a mean and variance of 10 per second but got %v and %v", mean, variance)
+	}
+
+	same, _ := Poisson(600, rand.NewSource(1))
+	if !equal(got, perInterval(same, time.Second, 600)) {
+		t.Errorf("Expected the same seed to give the same traffic")
+	}
+
+	large, _ := Poisson(6_000_000, rand.NewSource(1))
+	if got := large.Requests(0, time.Second); math.Abs(float64(got)-100_000) > 2000 {
+		t.Errorf("Expected about 100000 requests but got %d", got)
+	}
+}
+
+func TestBursty(t *testing.T) {
+	p, _ := Bursty(50, time.Minute)
+	if got := perInterval(p, 30*time.Second, 5); !equal(got, []int{50, 0, 50, 0, 50}) {
+		t.Errorf("Expected bursts at the start of every minute but got %v", got)
+	}
+	if got := p.Requests(time.Second, 3*time.Minute); got != 100 {
+		t.Errorf("Expected 2 bursts after the first one but got %d requests", got)
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		name string
+		new  func() (Pattern, error)
+		err  error
+	}{
+		{"negative constant", func() (Pattern, error) { return Constant(-1) }, ErrNegativeRate},
+		{"no steps", func() (Pattern, error) { return Step(nil, time.Minute, true) }, ErrMissingRates},
+		{"negative step", func() (Pattern, error) { return Step([]float64{1, -1}, time.Minute, true) }, ErrNegativeRate},
+		{"zero step length", func() (Pattern, error) { return Step([]float64{1}, 0, true) }, ErrInvalidPeriod},
+		{"amplitude above the mean", func() (Pattern, error) { return Sinusoidal(10, 20, time.Minute) }, ErrInvalidAmplitude},
+		{"zero period", func() (Pattern, error) { return Sinusoidal(10, 5, 0) }, ErrInvalidPeriod},
+		{"negative poisson", func() (Pattern, error) { return Poisson(-1, rand.NewSource(1)) }, ErrNegativeRate},
+		{"empty bursts", func() (Pattern, error) { return Bursty(0, time.Minute) }, ErrInvalidBurst},
+		{"zero burst period", func() (Pattern, error) { return Bursty(10, 0) }, ErrInvalidPeriod},
+	}
+	for _, test := range tests {
+		if _, err := test.new(); !errors.Is(err, test.err) {
+			t.Errorf("Expected %v for %s but got %v", test.err, test.name, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package traffic
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidReplay = errors.New("replay rows must be an offset and a non-negative number of requests, in time order")
+
+// Replays recorded traffic from CSV rows of an offset from the start and the number of requests that arrived then,
+// e.g. "90s,12" or "90,12" (seconds). A header row is skipped. There are no requests after the last row.
+func Replay(r io.Reader) (Pattern, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	var rp replay
+	var total int
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		at, errAt := parseOffset(record[0])
+		requests, errRequests := strconv.Atoi(record[1])
+		if line == 1 && (errAt != nil || errRequests != nil) {
+			continue // header
+		}
+		if errAt != nil || errRequests != nil || requests < 0 || (len(rp.at) > 0 && at < rp.at[len(rp.at)-1]) {
+			return nil, fmt.Errorf("line %d: %w", line, ErrInvalidReplay)
+		}
+		total += requests
+		rp.at = append(rp.at, at)
+		rp.total = append(rp.total, total)
+	}
+	return rp, nil
+}
+
+func LoadReplay(path string) (Pattern, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := Replay(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Either a duration like 1m30s or a number of seconds
+func parseOffset(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+type replay struct {
+	at    []time.Duration
+	total []int // running total of requests up to and including each row
+}
+
+func (r replay) Requests(from, to time.Duration) int {
+	if to <= from {
+		return 0
+	}
+	return r.before(to) - r.before(from)
+}
+
+// The number of requests that arrived before t
+func (r replay) before(t time.Duration) int {
+	i := sort.Search(len(r.at), func(i int) bool { return r.at[i] >= t })
+	if i == 0 {
+		return 0
+	}
+	return r.total[i-1]
+}
@@ -0,0 +1,62 @@
+package traffic
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	p, err := Replay(strings.NewReader("offset,requests\n0,5\n1.5,3\n1m,10\n1m,2\n"))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	tests := []struct {
+		from, to time.Duration
+		expected int
+	}{
+		{0, time.Second, 5},
+		{time.Second, 2 * time.Second, 3},
+		{0, time.Minute, 8},
+		{time.Minute, time.Minute + time.Nanosecond, 12},
+		{2 * time.Minute, time.Hour, 0},
+	}
+	for _, test := range tests {
+		if got := p.Requests(test.from, test.to); got != test.expected {
+			t.Errorf("Expected %d requests in [%v, %v) but got %d", test.expected, test.from, test.to, got)
+		}
+	}
+}
+
+func TestInvalidReplay(t *testing.T) {
+	for _, contents := range []string{
+		"0,5\nsoon,3\n",
+		"0,5\n10,-1\n",
+		"10,5\n5,3\n",
+		"0,5,1\n",
+	} {
+		if _, err := Replay(strings.NewReader(contents)); err == nil {
+			t.Errorf("Expected an error for %q", contents)
+		}
+	}
+	if _, err := Replay(strings.NewReader("0,5\n10,-1\n")); !errors.Is(err, ErrInvalidReplay) || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("Expected the line of the invalid row in the error but got %v", err)
+	}
+}
+
+func TestLoadReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.csv")
+	if err := os.WriteFile(path, []byte("0,5\n"), 0o644); err != nil {
+		t.Fatalf("Got unexpected error: %q", err)
+	}
+	p, err := LoadReplay(path)
+	if err != nil || p.Requests(0, time.Second) != 5 {
+		t.Errorf("Expected the trace to be loaded but got %v", err)
+	}
+	if _, err := LoadReplay(filepath.Join(t.TempDir(), "missing.csv")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing file to fail but got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package traffic
+
+import (
+	"context"
+	"time"
+)
+
+// Plays the pattern in real time until the context is done: every tick, send is called once for each request that
+// arrived since the previous one.
+func Run(ctx context.Context, pattern Pattern, tick time.Duration, send func()) {
+	start := time.Now()
+	var last time.Duration
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			elapsed := now.Sub(start)
+			for i := pattern.Requests(last, elapsed); i > 0; i-- {
+				send()
+			}
+			last = elapsed
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package traffic
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	p, _ := Constant(60_000) // a request every millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	sent := 0
+	Run(ctx, p, 10*time.Millisecond, func() { sent++ })
+	if sent < 150 || sent > 200 {
+		t.Errorf("Expected about 200 requests within 200ms but got %d", sent)
+	}
+}
@@ -0,0 +1,135 @@
+package traffic
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit"
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+)
+
+// The state of a limiter at the end of a simulation step, and the requests of the step
+type TraceStep struct {
+	Seconds  float64 `json:"seconds"` // since the start of the simulation
+	Arrived  int     `json:"arrived"`
+	Accepted int     `json:"accepted"`
+	Rejected int     `json:"rejected"`
+	Tokens   int     `json:"tokens"`   // left, as in Status().Remaining
+	Capacity int     `json:"capacity"` // as in Status().Limit
+}
+
+// Plays the pattern through the limiter on the virtual clock the limiter was created with, one step at a time.
+// The requests of a step are spread out evenly over it. Takes no real time, so hours of traffic simulate in a blink.
+func Simulate(limiter ratelimit.Limiter, clock *ratelimittest.FakeClock, pattern Pattern, step, duration time.Duration) []TraceStep {
+	start := clock.Now()
+	var steps []TraceStep
+	for from := time.Duration(0); from < duration; from += step {
+		s := TraceStep{Arrived: pattern.Requests(from, from+step)}
+		for i := 0; i < s.Arrived; i++ {
+			clock.Advance(start.Add(from + step*time.Duration(i)/time.Duration(s.Arrived)).Sub(clock.Now()))
+			if limiter.Accept() {
+				s.Accepted++
+			} else {
+				s.Rejected++
+			}
+		}
+		clock.Advance(start.Add(from + step).Sub(clock.Now()))
+		status := limiter.Status()
+		s.Seconds = (from + step).Seconds()
+		s.Tokens = status.Remaining
+		s.Capacity = status.Limit
+		steps = append(steps, s)
+	}
+	return steps
+}
+
+// What a simulation shows about the ramping
+type Summary struct {
+	ReachedMax        bool    `json:"reachedMax"`
+	SecondsToMax      float64 `json:"secondsToMax"` // until the capacity first reached the max, if it did
+	Arrived           int     `json:"arrived"`
+	Rejected          int     `json:"rejected"`
+	RejectionRatio    float64 `json:"rejectionRatio"`
+	CapacityReversals int     `json:"capacityReversals"` // times the capacity turned from scaling up to down or back
+	CapacitySwing     int     `json:"capacitySwing"`     // largest change of the capacity between two reversals
+}
+
+// Summarizes the steps of a simulation of a limiter with the given max capacity. Capacity reversals under steady
+// traffic point at a band between the scale-up and scale-down thresholds too narrow for the traffic's rate.
+func Summarize(steps []TraceStep, maxCapacity int) Summary {
+	var s Summary
+	for _, step := range steps {
+		s.Arrived += step.Arrived
+		s.Rejected += step.Rejected
+		if !s.ReachedMax && step.Capacity >= maxCapacity {
+			s.ReachedMax = true
+			s.SecondsToMax = step.Seconds
+		}
+	}
+	if s.Arrived > 0 {
+		s.RejectionRatio = float64(s.Rejected) / float64(s.Arrived)
+	}
+
+	// the capacities at which the scaling turned around
+	var reversals []int
+	direction := 0
+	for i := 1; i < len(steps); i++ {
+		change := sign(steps[i].Capacity - steps[i-1].Capacity)
+		if change == 0 {
+			continue
+		}
+		if direction != 0 && change != direction {
+			reversals = append(reversals, steps[i-1].Capacity)
+		}
+		direction = change
+	}
+	s.CapacityReversals = len(reversals)
+	for i := 1; i < len(reversals); i++ {
+		s.CapacitySwing = max(s.CapacitySwing, abs(reversals[i]-reversals[i-1]))
+	}
+	return s
+}
+
+// Writes the steps as CSV with a header row
+func WriteCSV(w io.Writer, steps []TraceStep) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"seconds", "arrived", "accepted", "rejected", "tokens", "capacity"})
+	for _, s := range steps {
+		writer.Write([]string{
+			strconv.FormatFloat(s.Seconds, 'f', -1, 64),
+			strconv.Itoa(s.Arrived),
+			strconv.Itoa(s.Accepted),
+			strconv.Itoa(s.Rejected),
+			strconv.Itoa(s.Tokens),
+			strconv.Itoa(s.Capacity),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,91 @@
+package traffic
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit"
+	"github.com/VladMinzatu/go-projects/rate-limiter/ratelimit/ratelimittest"
+)
+
+func TestSimulate(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	rl, err := ratelimit.NewTokenBucketRateLimiter(60, 1, ratelimit.WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := Constant(120)
+	steps := Simulate(rl, clock, p, 10*time.Second, 5*time.Minute)
+
+	if len(steps) != 30 {
+		t.Fatalf("Expected 30 steps but got %d", len(steps))
+	}
+	arrived := 0
+	for i, s := range steps {
+		if s.Seconds != float64(10*(i+1)) {
+			t.Errorf("Expected step %d to end at %ds but got %v", i, 10*(i+1), s.Seconds)
+		}
+		if s.Accepted+s.Rejected != s.Arrived {
+			t.Errorf("Expected every request of step %d to be accepted or rejected but got %+v", i, s)
+		}
+		arrived += s.Arrived
+	}
+	if arrived != 600 {
+		t.Errorf("Expected 600 requests but got %d", arrived)
+	}
+	last := steps[len(steps)-1]
+	if last.Capacity != 60 || last.Accepted != 10 {
+		t.Errorf("Expected the limiter to have ramped up to 60 rpm but got %+v", last)
+	}
+
+	summary := Summarize(steps, 60)
+	if !summary.ReachedMax || summary.SecondsToMax > 90 {
+		t.Errorf("Expected the max to be reached within 90s but got %+v", summary)
+	}
+	if summary.CapacityReversals != 0 {
+		t.Errorf("Expected no reversals under constant overload but got %+v", summary)
+	}
+	if summary.RejectionRatio < 0.5 || summary.RejectionRatio > 0.6 {
+		t.Errorf("Expected a bit over half of the requests to be rejected but got %+v", summary)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name       string
+		capacities []int
+		expected   Summary
+	}{
+		{"ramp up", []int{10, 20, 30, 30}, Summary{ReachedMax: true, SecondsToMax: 3, CapacityReversals: 0}},
+		{"never max", []int{10, 20, 20}, Summary{}},
+		{"oscillating", []int{10, 30, 30, 20, 10, 20, 30, 20}, Summary{ReachedMax: true, SecondsToMax: 2, CapacityReversals: 3, CapacitySwing: 20}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var steps []TraceStep
+			for i, c := range test.capacities {
+				steps = append(steps, TraceStep{Seconds: float64(i + 1), Arrived: 4, Accepted: 3, Rejected: 1, Capacity: c})
+			}
+			summary := Summarize(steps, 30)
+			test.expected.Arrived = 4 * len(steps)
+			test.expected.Rejected = len(steps)
+			test.expected.RejectionRatio = 0.25
+			if summary != test.expected {
+				t.Errorf("Expected %+v but got %+v", test.expected, summary)
+			}
+		})
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, []TraceStep{{Seconds: 0.5, Arrived: 3, Accepted: 2, Rejected: 1, Tokens: 0, Capacity: 6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "seconds,arrived,accepted,rejected,tokens,capacity\n0.5,3,2,1,0,6\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, buf.String())
+	}
+}